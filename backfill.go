@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"stocky/internal/services"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const backfillUsage = `usage: stocky backfill-snapshots -from YYYY-MM-DD [-to YYYY-MM-DD] [-user USER_ID]
+
+Regenerates portfolio_snapshots for every date in the range, valued at the price
+effective on each date. Existing rows are overwritten, so it is safe to rerun.`
+
+// runBackfillSnapshots handles the "backfill-snapshots" subcommand and returns the process exit code
+func runBackfillSnapshots(portfolioService *services.PortfolioService, location *time.Location, args []string, logger *logrus.Logger) int {
+	flags := flag.NewFlagSet("backfill-snapshots", flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, backfillUsage) }
+	fromFlag := flags.String("from", "", "first date to regenerate")
+	toFlag := flags.String("to", time.Now().In(location).AddDate(0, 0, -1).Format("2006-01-02"), "last date to regenerate, defaults to yesterday")
+	userFlag := flags.String("user", "", "only regenerate this user's snapshots")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	from, err := time.Parse("2006-01-02", *fromFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-from must be a date in YYYY-MM-DD format")
+		return 2
+	}
+	to, err := time.Parse("2006-01-02", *toFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "-to must be a date in YYYY-MM-DD format")
+		return 2
+	}
+
+	var userIDs []string
+	if *userFlag != "" {
+		userIDs = []string{*userFlag}
+	}
+
+	result, err := portfolioService.BackfillSnapshots(context.Background(), userIDs, from, to)
+	if errors.Is(err, services.ErrInvalidBackfillRange) {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if err != nil {
+		logger.WithError(err).Error("Snapshot backfill failed")
+		return 1
+	}
+
+	fmt.Printf("Backfilled %s to %s: %d users, %d days, %d snapshots written\n",
+		result.From, result.To, result.Users, result.Days, result.SnapshotsWritten)
+	return 0
+}
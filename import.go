@@ -0,0 +1,540 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"stocky/internal/handlers"
+	"stocky/internal/services"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const importUsage = `usage: stocky import rewards|prices|instruments -file PATH [-format csv|jsonl] [-dry-run] [-rejects PATH]
+
+Streams rewards, historical prices or the instrument master from a CSV file with a header
+row or from JSON Lines, using the same field names as the API. Reward rows are validated
+like POST /reward and must carry an event_id, so rerunning an import skips rewards that
+already exist. Price rows need stock_symbol, price and an RFC3339 price_timestamp; a price
+stored for the same symbol and timestamp is replaced. Instrument rows are validated like
+POST /admin/instruments and replace the reference data of an existing symbol, keeping its
+status; status only applies to new symbols.
+
+Rows that cannot be imported are written to the rejects file (default PATH.rejects.csv)
+with their line number and the reason. -dry-run validates everything without writing.`
+
+// importChunkSize is how many reward rows are sent to RewardService per batch
+const importChunkSize = 500
+
+// maxImportLine bounds a single JSON Lines record
+const maxImportLine = 1 << 20
+
+var rewardImportFields = []string{"user_id", "stock_symbol", "quantity", "reward_timestamp", "event_id", "exchange"}
+
+var priceImportFields = []string{"stock_symbol", "price", "price_timestamp"}
+
+var instrumentImportFields = []string{"stock_symbol", "isin", "exchange", "company_name", "sector", "face_value", "tick_size", "status"}
+
+// priceImportRow is one row of a price import
+type priceImportRow struct {
+	StockSymbol    string `json:"stock_symbol"`
+	Price          string `json:"price"`
+	PriceTimestamp string `json:"price_timestamp"`
+}
+
+// importRecord is one data row of an import file
+type importRecord struct {
+	line   int               // Line the row starts on, from 1
+	raw    string            // Row as it appeared in the file, for the rejects file
+	fields map[string]string // CSV cells by column name; empty cells are left out
+	data   []byte            // JSON Lines object
+	err    error             // The row could not be parsed
+}
+
+// decode unmarshals the row into v
+func (r *importRecord) decode(v interface{}) error {
+	if r.err != nil {
+		return r.err
+	}
+	data := r.data
+	if r.fields != nil {
+		var err error
+		if data, err = json.Marshal(r.fields); err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid record: %v", err)
+	}
+	return nil
+}
+
+// importReader yields the data rows of a file, returning io.EOF after the last one
+type importReader interface {
+	next() (*importRecord, error)
+}
+
+// csvImportReader reads a CSV file whose header row names the fields
+type csvImportReader struct {
+	r      *csv.Reader
+	header []string
+}
+
+func newCSVImportReader(file io.Reader, allowed []string) (*csvImportReader, error) {
+	r := csv.NewReader(file)
+	r.TrimLeadingSpace = true
+	header, err := r.Read()
+	if errors.Is(err, io.EOF) {
+		return nil, errors.New("file is empty, expected a header row")
+	} else if err != nil {
+		return nil, err
+	}
+
+	for i, column := range header {
+		column = strings.TrimSpace(strings.TrimPrefix(column, "\ufeff"))
+		if !containsString(allowed, column) {
+			return nil, fmt.Errorf("unknown column %q, expected some of %s", column, strings.Join(allowed, ", "))
+		}
+		header[i] = column
+	}
+	return &csvImportReader{r: r, header: header}, nil
+}
+
+func (c *csvImportReader) next() (*importRecord, error) {
+	cells, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if !errors.As(err, &parseErr) {
+			return nil, err
+		}
+		// A malformed row is rejected on its own; the reader carries on with the next one
+		return &importRecord{line: parseErr.StartLine, raw: strings.Join(cells, ","), err: parseErr.Err}, nil
+	}
+
+	line, _ := c.r.FieldPos(0)
+	record := &importRecord{line: line, fields: make(map[string]string, len(cells))}
+	for i, cell := range cells {
+		if cell != "" {
+			record.fields[c.header[i]] = cell
+		}
+	}
+
+	var raw strings.Builder
+	w := csv.NewWriter(&raw)
+	w.Write(cells)
+	w.Flush()
+	record.raw = strings.TrimRight(raw.String(), "\n")
+	return record, nil
+}
+
+// jsonlImportReader reads one JSON object per line, skipping blank lines
+type jsonlImportReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newJSONLImportReader(file io.Reader) *jsonlImportReader {
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxImportLine)
+	return &jsonlImportReader{scanner: scanner}
+}
+
+func (j *jsonlImportReader) next() (*importRecord, error) {
+	for j.scanner.Scan() {
+		j.line++
+		data := bytes.TrimSpace(j.scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		return &importRecord{line: j.line, raw: string(data), data: append([]byte(nil), data...)}, nil
+	}
+	if err := j.scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %w", j.line+1, err)
+	}
+	return nil, io.EOF
+}
+
+// importRejects writes rejected rows to a CSV file in line order, creating it on the first reject
+type importRejects struct {
+	path    string
+	file    *os.File
+	w       *csv.Writer
+	count   int
+	pending []importReject
+}
+
+type importReject struct {
+	line   int
+	reason string
+	raw    string
+}
+
+// add queues a rejected row until the next flush
+func (r *importRejects) add(record *importRecord, reason string) {
+	r.count++
+	r.pending = append(r.pending, importReject{line: record.line, reason: reason, raw: record.raw})
+}
+
+// flush writes the queued rows sorted by line; rows validated by the service in a
+// chunk are rejected after the rows that failed to parse further down the file
+func (r *importRejects) flush() error {
+	if len(r.pending) == 0 {
+		return nil
+	}
+	if r.w == nil {
+		file, err := os.Create(r.path)
+		if err != nil {
+			return err
+		}
+		r.file = file
+		r.w = csv.NewWriter(file)
+		r.w.Write([]string{"line", "reason", "record"})
+	}
+
+	sort.SliceStable(r.pending, func(i, j int) bool { return r.pending[i].line < r.pending[j].line })
+	for _, reject := range r.pending {
+		r.w.Write([]string{strconv.Itoa(reject.line), reject.reason, reject.raw})
+	}
+	r.pending = r.pending[:0]
+	r.w.Flush()
+	return r.w.Error()
+}
+
+func (r *importRejects) close() error {
+	err := r.flush()
+	if r.file != nil {
+		if closeErr := r.file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
+}
+
+// importedReward is the first valid row that used an event_id
+type importedReward struct {
+	line    int
+	payload services.RewardPayload
+}
+
+// importSummary counts what happened to the rows of an import
+type importSummary struct {
+	rows       int
+	written    int
+	duplicates int
+	updated    int // Existing instruments whose reference data was replaced
+	// Earliest price date imported, to suggest a snapshot backfill
+	earliest time.Time
+}
+
+// runImport handles the "import" subcommand and returns the process exit code
+func runImport(rewardService *services.RewardService, stockPriceService *services.StockPriceService, instrumentService *services.InstrumentService, location *time.Location, args []string, logger *logrus.Logger) int {
+	importFields := map[string][]string{
+		"rewards":     rewardImportFields,
+		"prices":      priceImportFields,
+		"instruments": instrumentImportFields,
+	}
+	if len(args) == 0 || importFields[args[0]] == nil {
+		fmt.Fprintln(os.Stderr, importUsage)
+		return 2
+	}
+	kind := args[0]
+
+	flags := flag.NewFlagSet("import "+kind, flag.ContinueOnError)
+	flags.Usage = func() { fmt.Fprintln(os.Stderr, importUsage) }
+	fileFlag := flags.String("file", "", "CSV or JSON Lines file to import")
+	formatFlag := flags.String("format", "", "csv or jsonl, defaults to the file extension")
+	dryRunFlag := flags.Bool("dry-run", false, "validate every row without writing anything")
+	rejectsFlag := flags.String("rejects", "", "where to write rejected rows, defaults to FILE.rejects.csv")
+	if err := flags.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if *fileFlag == "" || flags.NArg() > 0 {
+		fmt.Fprintln(os.Stderr, importUsage)
+		return 2
+	}
+
+	format := *formatFlag
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(*fileFlag)) {
+		case ".csv":
+			format = "csv"
+		case ".jsonl", ".ndjson":
+			format = "jsonl"
+		default:
+			fmt.Fprintln(os.Stderr, "cannot tell the format from the file extension, pass -format csv or -format jsonl")
+			return 2
+		}
+	}
+
+	allowed := importFields[kind]
+
+	file, err := os.Open(*fileFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer file.Close()
+
+	var reader importReader
+	switch format {
+	case "csv":
+		reader, err = newCSVImportReader(file, allowed)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", *fileFlag, err)
+			return 2
+		}
+	case "jsonl":
+		reader = newJSONLImportReader(file)
+	default:
+		fmt.Fprintln(os.Stderr, "-format must be csv or jsonl")
+		return 2
+	}
+
+	rejects := &importRejects{path: *rejectsFlag}
+	if rejects.path == "" {
+		rejects.path = *fileFlag + ".rejects.csv"
+	}
+
+	// An interrupt stops the import after the rows already written
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var summary *importSummary
+	switch kind {
+	case "rewards":
+		summary, err = importRewards(ctx, rewardService, reader, rejects, *dryRunFlag)
+	case "prices":
+		summary, err = importPrices(ctx, stockPriceService, reader, rejects, *dryRunFlag)
+	case "instruments":
+		summary, err = importInstruments(ctx, instrumentService, reader, rejects, *dryRunFlag)
+	}
+	if closeErr := rejects.close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		logger.WithError(err).WithField("file", *fileFlag).Error("Import failed")
+		return 1
+	}
+
+	verb := "imported"
+	if *dryRunFlag {
+		verb = "would be imported (dry run, nothing written)"
+	}
+	if kind == "instruments" {
+		dryRunNote := ""
+		if *dryRunFlag {
+			dryRunNote = " (dry run, nothing written)"
+		}
+		fmt.Printf("%s: %d rows, %d instruments created and %d updated%s, %d rejected\n",
+			*fileFlag, summary.rows, summary.written, summary.updated, dryRunNote, rejects.count)
+	} else {
+		fmt.Printf("%s: %d rows, %d %s %s, %d duplicates, %d rejected\n",
+			*fileFlag, summary.rows, summary.written, kind, verb, summary.duplicates, rejects.count)
+	}
+	if rejects.count > 0 {
+		fmt.Printf("Rejected rows written to %s\n", rejects.path)
+	}
+	if kind == "prices" && summary.written > 0 && !*dryRunFlag {
+		fmt.Printf("Snapshots valued before these prices are not updated; run: stocky backfill-snapshots -from %s\n",
+			summary.earliest.In(location).Format("2006-01-02"))
+	}
+
+	if rejects.count > 0 {
+		return 1
+	}
+	return 0
+}
+
+// importRewards validates each row like POST /reward and creates the rewards in
+// best-effort chunks, so one bad row never holds back the others
+func importRewards(ctx context.Context, rewardService *services.RewardService, reader importReader, rejects *importRejects, dryRun bool) (*importSummary, error) {
+	summary := &importSummary{}
+	// A dry run rolls back every chunk, so an event_id repeated in a later chunk is compared
+	// here with its first valid row, the way a real run compares it with the recorded reward
+	seen := make(map[string]*importedReward)
+	var records []*importRecord
+	var chunk []services.BatchReward
+
+	flush := func() error {
+		if len(chunk) == 0 {
+			return nil
+		}
+		batch, err := rewardService.CreateRewardBatch(ctx, chunk, services.BatchModeBestEffort, dryRun)
+		if err != nil {
+			return err
+		}
+		for i, result := range batch.Results {
+			switch result.Status {
+			case services.BatchStatusCreated:
+				summary.written++
+			case services.BatchStatusDuplicate:
+				summary.duplicates++
+			case services.BatchStatusSkipped:
+				// Interrupted before this row; a rerun picks it up
+			default:
+				rejects.add(records[i], result.Error)
+			}
+		}
+		records, chunk = records[:0], chunk[:0]
+		if err := rejects.flush(); err != nil {
+			return err
+		}
+		return ctx.Err()
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		summary.rows++
+
+		var req handlers.CreateRewardRequest
+		if err := record.decode(&req); err != nil {
+			rejects.add(record, err.Error())
+			continue
+		}
+		// A generated event_id would make every rerun create the reward again
+		if strings.TrimSpace(req.EventID) == "" {
+			rejects.add(record, "event_id is required for imports")
+			continue
+		}
+		reward := req.BatchReward()
+		if dryRun {
+			// An invalid row is left for the batch to reject, and does not claim its event_id
+			if payload, err := rewardService.RewardPayload(reward); err == nil {
+				if first, ok := seen[req.EventID]; ok {
+					if conflicts := payload.Conflicts(first.payload); len(conflicts) == 0 {
+						summary.duplicates++
+					} else {
+						conflictErr := &services.EventConflictError{EventID: req.EventID, Conflicts: conflicts}
+						rejects.add(record, fmt.Sprintf("%s (first used on line %d)", conflictErr, first.line))
+					}
+					continue
+				}
+				seen[req.EventID] = &importedReward{line: record.line, payload: payload}
+			}
+		}
+
+		records = append(records, record)
+		chunk = append(chunk, reward)
+		if len(chunk) == importChunkSize {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return summary, nil
+}
+
+// importPrices stores each valid price row
+func importPrices(ctx context.Context, stockPriceService *services.StockPriceService, reader importReader, rejects *importRejects, dryRun bool) (*importSummary, error) {
+	summary := &importSummary{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		summary.rows++
+
+		var row priceImportRow
+		var at time.Time
+		reason := ""
+		if err := record.decode(&row); err != nil {
+			reason = err.Error()
+		} else if at, err = time.Parse(time.RFC3339, strings.TrimSpace(row.PriceTimestamp)); err != nil {
+			reason = "invalid price_timestamp format, use RFC3339"
+		} else if err := stockPriceService.ImportPrice(ctx, strings.TrimSpace(row.StockSymbol), strings.TrimSpace(row.Price), at, dryRun); errors.Is(err, services.ErrInvalidPrice) {
+			reason = err.Error()
+		} else if err != nil {
+			return nil, err
+		}
+		if reason != "" {
+			rejects.add(record, reason)
+			if err := rejects.flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		summary.written++
+		if summary.earliest.IsZero() || at.Before(summary.earliest) {
+			summary.earliest = at
+		}
+	}
+	return summary, nil
+}
+
+// importInstruments creates or updates each valid instrument row
+func importInstruments(ctx context.Context, instrumentService *services.InstrumentService, reader importReader, rejects *importRejects, dryRun bool) (*importSummary, error) {
+	summary := &importSummary{}
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		record, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		summary.rows++
+
+		var req handlers.InstrumentRequest
+		reason := ""
+		if err := record.decode(&req); err != nil {
+			reason = err.Error()
+		} else if created, err := instrumentService.SeedInstrument(ctx, req.Instrument(), dryRun); errors.Is(err, services.ErrValidation) {
+			reason = err.Error()
+		} else if err != nil {
+			return nil, err
+		} else if created {
+			summary.written++
+		} else {
+			summary.updated++
+		}
+		if reason != "" {
+			rejects.add(record, reason)
+			if err := rejects.flush(); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return summary, nil
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
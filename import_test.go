@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"stocky/internal/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// readAll drains reader
+func readAll(t *testing.T, reader importReader) []*importRecord {
+	t.Helper()
+	var records []*importRecord
+	for {
+		record, err := reader.next()
+		if errors.Is(err, io.EOF) {
+			return records
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+}
+
+func TestCSVImportReader(t *testing.T) {
+	file := "\ufeffuser_id, stock_symbol,quantity,event_id\n" +
+		"user1,TCS,10,e1\n" +
+		"user2,INFY,,e2\n" +
+		"user3,\"TC\"S,1,e3\n" +
+		"user4,\"TCS, Ltd\",2,e4\n"
+	reader, err := newCSVImportReader(strings.NewReader(file), rewardImportFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	records := readAll(t, reader)
+	if len(records) != 4 {
+		t.Fatalf("got %d records, want 4", len(records))
+	}
+
+	var req struct {
+		UserID   string `json:"user_id"`
+		Quantity string `json:"quantity"`
+	}
+	if err := records[0].decode(&req); err != nil || req.UserID != "user1" || req.Quantity != "10" {
+		t.Errorf("row 1 decoded to %+v, %v", req, err)
+	}
+	if records[0].line != 2 || records[0].raw != "user1,TCS,10,e1" {
+		t.Errorf("row 1 at line %d as %q", records[0].line, records[0].raw)
+	}
+	// Empty cells are left out, as if the field were omitted
+	if _, ok := records[1].fields["quantity"]; ok {
+		t.Errorf("row 2 kept an empty cell: %v", records[1].fields)
+	}
+	// A malformed row is rejected on its own and the next row still reads
+	if records[2].err == nil || records[2].line != 4 || records[2].decode(&req) == nil {
+		t.Errorf("row 3 = %+v, want a parse error on line 4", records[2])
+	}
+	if records[3].line != 5 || records[3].fields["stock_symbol"] != "TCS, Ltd" || records[3].raw != `user4,"TCS, Ltd",2,e4` {
+		t.Errorf("row 4 = %+v", records[3])
+	}
+}
+
+func TestCSVImportReaderHeader(t *testing.T) {
+	if _, err := newCSVImportReader(strings.NewReader(""), rewardImportFields); err == nil {
+		t.Error("accepted an empty file")
+	}
+	if _, err := newCSVImportReader(strings.NewReader("user_id,amount\n"), rewardImportFields); err == nil || !strings.Contains(err.Error(), `"amount"`) {
+		t.Errorf("unknown column: got %v", err)
+	}
+}
+
+func TestJSONLImportReader(t *testing.T) {
+	file := `{"user_id":"user1","quantity":"10"}` + "\n\n   \n" + ` {"user_id":"user2"} ` + "\n" + `{"user_id":` + "\n"
+	records := readAll(t, newJSONLImportReader(strings.NewReader(file)))
+	if len(records) != 3 {
+		t.Fatalf("got %d records, want 3", len(records))
+	}
+
+	var req struct {
+		UserID string `json:"user_id"`
+	}
+	for i, want := range []struct {
+		line   int
+		raw    string
+		userID string
+	}{
+		{1, `{"user_id":"user1","quantity":"10"}`, "user1"},
+		{4, `{"user_id":"user2"}`, "user2"},
+	} {
+		req.UserID = ""
+		if err := records[i].decode(&req); err != nil || records[i].line != want.line || records[i].raw != want.raw || req.UserID != want.userID {
+			t.Errorf("record %d = line %d %q %+v, %v", i, records[i].line, records[i].raw, req, err)
+		}
+	}
+	if err := records[2].decode(&req); err == nil || records[2].line != 5 {
+		t.Errorf("truncated object on line %d decoded: %v", records[2].line, err)
+	}
+}
+
+func TestJSONLImportReaderLongLine(t *testing.T) {
+	file := `{"user_id":"` + strings.Repeat("x", maxImportLine) + `"}` + "\n"
+	_, err := newJSONLImportReader(strings.NewReader(file)).next()
+	if err == nil || errors.Is(err, io.EOF) || !strings.HasPrefix(err.Error(), "line 1:") {
+		t.Errorf("got %v, want an error for line 1", err)
+	}
+}
+
+// readRejects returns the rows of a rejects file, without its header
+func readRejects(t *testing.T, path string) [][]string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	rows, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 || !reflect.DeepEqual(rows[0], []string{"line", "reason", "record"}) {
+		t.Fatalf("rejects header = %v", rows)
+	}
+	return rows[1:]
+}
+
+func TestImportRejects(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rewards.csv.rejects.csv")
+
+	rejects := &importRejects{path: path}
+	if err := rejects.close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("rejects file created without rejects: %v", err)
+	}
+
+	rejects = &importRejects{path: path}
+	rejects.add(&importRecord{line: 7, raw: "user7,TCS,-1,e7"}, "quantity: must be positive")
+	rejects.add(&importRecord{line: 3, raw: `user3,"TCS, Ltd",1,e3`}, "unknown symbol")
+	if err := rejects.flush(); err != nil {
+		t.Fatal(err)
+	}
+	rejects.add(&importRecord{line: 2, raw: "user2"}, "bare \" in non-quoted field")
+	if err := rejects.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"3", "unknown symbol", `user3,"TCS, Ltd",1,e3`},
+		{"7", "quantity: must be positive", "user7,TCS,-1,e7"},
+		{"2", "bare \" in non-quoted field", "user2"},
+	}
+	if got := readRejects(t, path); !reflect.DeepEqual(got, want) || rejects.count != 3 {
+		t.Errorf("rejects = %v (count %d), want %v", got, rejects.count, want)
+	}
+}
+
+func newImportRewardService(t *testing.T) *services.RewardService {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "TCS", Status: services.InstrumentActive, Exchange: "NSE"})
+	if err := store.Prices().Save("TCS", "3500.0000", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return services.NewRewardService(store, 30*24*time.Hour, 5*time.Minute, time.UTC, logger)
+}
+
+// A dry run reports the same duplicates, conflicts and rejects as the real import
+func TestImportRewardsDryRunMatchesImport(t *testing.T) {
+	file := "user_id,stock_symbol,quantity,exchange,event_id\n" +
+		"user1,TCS,10,,e1\n" +
+		"user1,TCS,10.0,NSE,e1\n" + // Same payload once canonical
+		"user1,TCS,5,,e1\n" + // Conflict
+		"user2,TCS,-1,,e2\n" + // Invalid, so e2 is not taken
+		"user2,TCS,1,,e2\n" +
+		"user3,TCS,1,,\n" // No event_id
+
+	run := func(dryRun bool) (*importSummary, []string) {
+		reader, err := newCSVImportReader(strings.NewReader(file), rewardImportFields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		path := filepath.Join(t.TempDir(), "rejects.csv")
+		rejects := &importRejects{path: path}
+		summary, err := importRewards(context.Background(), newImportRewardService(t), reader, rejects, dryRun)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rejects.close(); err != nil {
+			t.Fatal(err)
+		}
+		var rejected []string
+		for _, row := range readRejects(t, path) {
+			rejected = append(rejected, row[0])
+			if row[0] == "4" && !strings.Contains(row[1], `quantity "5.000000" != "10.000000"`) {
+				t.Errorf("dry run %v: conflict reason %q", dryRun, row[1])
+			}
+		}
+		return summary, rejected
+	}
+
+	want := &importSummary{rows: 6, written: 2, duplicates: 1}
+	wantRejected := []string{"4", "5", "7"}
+	for _, dryRun := range []bool{false, true} {
+		summary, rejected := run(dryRun)
+		if *summary != *want || !reflect.DeepEqual(rejected, wantRejected) {
+			t.Errorf("dry run %v: got %+v rejecting lines %v, want %+v rejecting %v", dryRun, summary, rejected, want, wantRejected)
+		}
+	}
+}
+
+func TestImportRewardsInterrupted(t *testing.T) {
+	reader, err := newCSVImportReader(strings.NewReader("user_id,stock_symbol,quantity,event_id\nuser1,TCS,1,e1\n"), rewardImportFields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rejects := &importRejects{path: filepath.Join(t.TempDir(), "rejects.csv")}
+	if _, err := importRewards(ctx, newImportRewardService(t), reader, rejects, false); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if rejects.count != 0 {
+		t.Errorf("interrupted rows were rejected: %d", rejects.count)
+	}
+}
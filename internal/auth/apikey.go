@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"fmt"
+	"strings"
+)
+
+// APIKeyStore holds the API keys of internal callers. Keys are kept as SHA-256
+// digests so the raw values are not retained after startup.
+type APIKeyStore struct {
+	keys []apiKey
+}
+
+type apiKey struct {
+	name   string
+	digest [sha256.Size]byte
+	roles  []string
+}
+
+// ParseAPIKeys parses a comma-separated list of "name:key:role|role" entries,
+// e.g. "rewards-engine:s3cret:issuer,ops:t0ps3cret:admin|finance"
+func ParseAPIKeys(spec string) (*APIKeyStore, error) {
+	store := &APIKeyStore{}
+	for i, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		parts := strings.Split(entry, ":")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, fmt.Errorf("invalid API key entry %d, expected name:key:roles", i+1)
+		}
+		roles, err := parseRoles(strings.Split(parts[2], "|"))
+		if err != nil {
+			return nil, fmt.Errorf("API key %q: %w", parts[0], err)
+		}
+		if len(roles) == 0 {
+			return nil, fmt.Errorf("API key %q has no roles", parts[0])
+		}
+
+		store.keys = append(store.keys, apiKey{
+			name:   parts[0],
+			digest: sha256.Sum256([]byte(parts[1])),
+			roles:  roles,
+		})
+	}
+	return store, nil
+}
+
+// Lookup returns the principal owning key
+func (s *APIKeyStore) Lookup(key string) (*Principal, error) {
+	digest := sha256.Sum256([]byte(key))
+	for _, k := range s.keys {
+		if subtle.ConstantTimeCompare(digest[:], k.digest[:]) == 1 {
+			return &Principal{
+				Subject: k.name,
+				Roles:   k.roles,
+				Method:  MethodAPIKey,
+			}, nil
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// Len returns the number of configured keys
+func (s *APIKeyStore) Len() int {
+	return len(s.keys)
+}
+
+func parseRoles(names []string) ([]string, error) {
+	roles := make([]string, 0, len(names))
+	for _, name := range names {
+		role := strings.ToLower(strings.TrimSpace(name))
+		switch role {
+		case RoleIssuer, RoleUser, RoleAdmin, RoleFinance:
+			roles = append(roles, role)
+		case "":
+		default:
+			return nil, fmt.Errorf("unknown role %q", name)
+		}
+	}
+	return roles, nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"errors"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseAPIKeys(t *testing.T) {
+	store, err := ParseAPIKeys(" rewards-engine:s3cret:issuer , ops:t0ps3cret:Admin|finance ,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if store.Len() != 2 {
+		t.Fatalf("Len = %d, want 2", store.Len())
+	}
+	// Only digests are kept
+	for _, k := range store.keys {
+		if k.digest == sha256.Sum256(nil) {
+			t.Errorf("key %s has no digest", k.name)
+		}
+	}
+
+	tests := []struct {
+		key       string
+		wantName  string
+		wantRoles []string
+	}{
+		{"s3cret", "rewards-engine", []string{RoleIssuer}},
+		{"t0ps3cret", "ops", []string{RoleAdmin, RoleFinance}},
+		{"S3CRET", "", nil},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		principal, err := store.Lookup(tt.key)
+		if tt.wantName == "" {
+			if !errors.Is(err, ErrInvalidCredentials) {
+				t.Errorf("Lookup(%q) = %+v, %v; want ErrInvalidCredentials", tt.key, principal, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Lookup(%q): %v", tt.key, err)
+			continue
+		}
+		if principal.Subject != tt.wantName || principal.Method != MethodAPIKey || !equalRoles(principal.Roles, tt.wantRoles) {
+			t.Errorf("Lookup(%q) = %+v, want %s with %v", tt.key, principal, tt.wantName, tt.wantRoles)
+		}
+	}
+}
+
+func TestParseAPIKeysInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"name:key",
+		"name::issuer",
+		":key:issuer",
+		"name:key:",
+		"name:key:superuser",
+		"name:key:|",
+		"name:a:b:issuer",
+	} {
+		if _, err := ParseAPIKeys(spec); err == nil {
+			t.Errorf("ParseAPIKeys(%q) accepted an invalid entry", spec)
+		}
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	keys, err := ParseAPIKeys("engine:s3cret:issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	verifier := newTestVerifier(t, testHMACSecret, "", "", "")
+	authenticator := NewAuthenticator(keys, verifier)
+	token := signToken(t, "HS256", claims(nil), []byte(testHMACSecret), nil)
+
+	tests := []struct {
+		name    string
+		headers map[string]string
+		subject string
+		wantErr error
+	}{
+		{name: "API key", headers: map[string]string{"X-API-Key": "s3cret"}, subject: "engine"},
+		{name: "bearer token", headers: map[string]string{"Authorization": "Bearer " + token}, subject: "user123"},
+		{name: "lower-case scheme", headers: map[string]string{"Authorization": "bearer " + token}, subject: "user123"},
+		{name: "nothing", wantErr: ErrMissingCredentials},
+		{name: "basic auth", headers: map[string]string{"Authorization": "Basic dXNlcjpwYXNz"}, wantErr: ErrInvalidCredentials},
+		{name: "wrong API key", headers: map[string]string{"X-API-Key": "guess", "Authorization": "Bearer " + token}, wantErr: ErrInvalidCredentials},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		for k, v := range tt.headers {
+			req.Header.Set(k, v)
+		}
+		principal, err := authenticator.Authenticate(req)
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: got %+v, %v; want %v", tt.name, principal, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || principal.Subject != tt.subject {
+			t.Errorf("%s: got %+v, %v; want %s", tt.name, principal, err, tt.subject)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Roles granted to authenticated callers
+const (
+	RoleIssuer  = "issuer"  // Internal services that issue rewards
+	RoleUser    = "user"    // End users, limited to their own data
+	RoleAdmin   = "admin"   // Operations staff
+	RoleFinance = "finance" // Read access to ledger reports
+)
+
+// Authentication methods recorded on a Principal
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	Subject string // API key name, or the JWT "sub" claim (the user_id for end users)
+	Roles   []string
+	Method  string
+}
+
+// HasRole reports whether the principal holds any of roles
+func (p *Principal) HasRole(roles ...string) bool {
+	for _, have := range p.Roles {
+		for _, want := range roles {
+			if have == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator resolves a request's credentials to a Principal.
+// API keys are read from the X-API-Key header and JWTs from "Authorization: Bearer <token>".
+type Authenticator struct {
+	apiKeys *APIKeyStore
+	jwt     *JWTVerifier
+}
+
+func NewAuthenticator(apiKeys *APIKeyStore, jwt *JWTVerifier) *Authenticator {
+	return &Authenticator{
+		apiKeys: apiKeys,
+		jwt:     jwt,
+	}
+}
+
+// Authenticate returns the caller of r, or ErrMissingCredentials / ErrInvalidCredentials
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		if a.apiKeys == nil {
+			return nil, ErrInvalidCredentials
+		}
+		return a.apiKeys.Lookup(key)
+	}
+
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return nil, ErrMissingCredentials
+	}
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, ErrInvalidCredentials
+	}
+	if a.jwt == nil {
+		return nil, ErrInvalidCredentials
+	}
+	return a.jwt.Verify(strings.TrimSpace(token))
+}
+
+// Enabled reports whether any credential source is configured
+func (a *Authenticator) Enabled() bool {
+	return (a.apiKeys != nil && a.apiKeys.Len() > 0) || a.jwt != nil
+}
@@ -0,0 +1,219 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// JWTVerifier validates compact JWS tokens signed with HS256 or RS256 using
+// locally configured keys. The algorithm is only accepted if its key is configured,
+// so an RS256 public key can never be used as an HS256 secret.
+type JWTVerifier struct {
+	hmacSecret []byte
+	rsaKey     *rsa.PublicKey
+	issuer     string // Required "iss" when set
+	audience   string // Required in "aud" when set
+	leeway     time.Duration
+	now        func() time.Time
+}
+
+// NewJWTVerifier returns a verifier for the configured keys, or nil if neither is set.
+// rsaPublicKeyFile is a PEM file holding a PKIX or PKCS#1 RSA public key.
+func NewJWTVerifier(hmacSecret, rsaPublicKeyFile, issuer, audience string) (*JWTVerifier, error) {
+	if hmacSecret == "" && rsaPublicKeyFile == "" {
+		return nil, nil
+	}
+
+	v := &JWTVerifier{
+		issuer:   issuer,
+		audience: audience,
+		leeway:   30 * time.Second,
+		now:      time.Now,
+	}
+	if hmacSecret != "" {
+		if len(hmacSecret) < 32 {
+			return nil, errors.New("HS256 secret must be at least 32 bytes")
+		}
+		v.hmacSecret = []byte(hmacSecret)
+	}
+	if rsaPublicKeyFile != "" {
+		key, err := loadRSAPublicKey(rsaPublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		v.rsaKey = key
+	}
+	return v, nil
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+type jwtClaims struct {
+	Subject   string          `json:"sub"`
+	Issuer    string          `json:"iss"`
+	Audience  json.RawMessage `json:"aud"` // String or array of strings
+	ExpiresAt *int64          `json:"exp"`
+	NotBefore *int64          `json:"nbf"`
+	Roles     []string        `json:"roles"`
+	Role      string          `json:"role"`
+}
+
+// Verify checks the token's signature and registered claims and returns its principal.
+// Tokens must carry "sub" and "exp". Roles come from "roles" or "role" and default to user.
+func (v *JWTVerifier) Verify(token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidCredentials)
+	}
+
+	var header jwtHeader
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: malformed header", ErrInvalidCredentials)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed signature", ErrInvalidCredentials)
+	}
+
+	signed := []byte(parts[0] + "." + parts[1])
+	switch header.Alg {
+	case "HS256":
+		if v.hmacSecret == nil {
+			return nil, fmt.Errorf("%w: HS256 not accepted", ErrInvalidCredentials)
+		}
+		mac := hmac.New(sha256.New, v.hmacSecret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredentials)
+		}
+	case "RS256":
+		if v.rsaKey == nil {
+			return nil, fmt.Errorf("%w: RS256 not accepted", ErrInvalidCredentials)
+		}
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(v.rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, fmt.Errorf("%w: bad signature", ErrInvalidCredentials)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unsupported alg %q", ErrInvalidCredentials, header.Alg)
+	}
+
+	var claims jwtClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed claims", ErrInvalidCredentials)
+	}
+	if err := v.validateClaims(&claims); err != nil {
+		return nil, err
+	}
+
+	names := claims.Roles
+	if claims.Role != "" {
+		names = append(names, claims.Role)
+	}
+	roles := knownRoles(names)
+	if len(roles) == 0 {
+		roles = []string{RoleUser}
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Roles:   roles,
+		Method:  MethodJWT,
+	}, nil
+}
+
+func (v *JWTVerifier) validateClaims(claims *jwtClaims) error {
+	now := v.now()
+	if claims.Subject == "" {
+		return fmt.Errorf("%w: missing sub", ErrInvalidCredentials)
+	}
+	if claims.ExpiresAt == nil {
+		return fmt.Errorf("%w: missing exp", ErrInvalidCredentials)
+	}
+	if now.After(time.Unix(*claims.ExpiresAt, 0).Add(v.leeway)) {
+		return fmt.Errorf("%w: token expired", ErrInvalidCredentials)
+	}
+	if claims.NotBefore != nil && now.Add(v.leeway).Before(time.Unix(*claims.NotBefore, 0)) {
+		return fmt.Errorf("%w: token not yet valid", ErrInvalidCredentials)
+	}
+	if v.issuer != "" && claims.Issuer != v.issuer {
+		return fmt.Errorf("%w: unexpected iss", ErrInvalidCredentials)
+	}
+	if v.audience != "" && !audienceContains(claims.Audience, v.audience) {
+		return fmt.Errorf("%w: unexpected aud", ErrInvalidCredentials)
+	}
+	return nil
+}
+
+func audienceContains(raw json.RawMessage, audience string) bool {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return single == audience
+	}
+	var list []string
+	if err := json.Unmarshal(raw, &list); err == nil {
+		for _, aud := range list {
+			if aud == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// knownRoles drops role names this service does not define
+func knownRoles(names []string) []string {
+	var roles []string
+	for _, name := range names {
+		if r, err := parseRoles([]string{name}); err == nil {
+			roles = append(roles, r...)
+		}
+	}
+	return roles
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read RS256 public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("RS256 public key %s is not PEM encoded", path)
+	}
+
+	if key, err := x509.ParsePKIXPublicKey(block.Bytes); err == nil {
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key %s is not an RSA key", path)
+		}
+		return rsaKey, nil
+	}
+	key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parse RS256 public key: %w", err)
+	}
+	return key, nil
+}
@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testHMACSecret = "0123456789abcdef0123456789abcdef"
+
+var testNow = time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+
+// signToken builds a compact JWS over claims, signed with secret for HS256 or key for RS256
+func signToken(t *testing.T, alg string, claims map[string]interface{}, secret []byte, key *rsa.PrivateKey) string {
+	t.Helper()
+	segment := func(v interface{}) string {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signed := segment(map[string]string{"alg": alg, "typ": "JWT"}) + "." + segment(claims)
+
+	var signature []byte
+	switch alg {
+	case "HS256":
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case "RS256":
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// writePublicKey writes key's public half to a PEM file and returns its path and contents
+func writePublicKey(t *testing.T, key *rsa.PrivateKey) (string, []byte) {
+	t.Helper()
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+	path := filepath.Join(t.TempDir(), "jwt.pem")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path, data
+}
+
+func newTestVerifier(t *testing.T, hmacSecret, rsaPublicKeyFile, issuer, audience string) *JWTVerifier {
+	t.Helper()
+	v, err := NewJWTVerifier(hmacSecret, rsaPublicKeyFile, issuer, audience)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.now = func() time.Time { return testNow }
+	return v
+}
+
+func claims(overrides map[string]interface{}) map[string]interface{} {
+	c := map[string]interface{}{
+		"sub": "user123",
+		"exp": testNow.Add(time.Hour).Unix(),
+	}
+	for k, v := range overrides {
+		if v == nil {
+			delete(c, k)
+		} else {
+			c[k] = v
+		}
+	}
+	return c
+}
+
+func TestJWTVerify(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile, keyPEM := writePublicKey(t, rsaKey)
+
+	both := newTestVerifier(t, testHMACSecret, keyFile, "https://issuer.example", "stocky")
+	rsaOnly := newTestVerifier(t, "", keyFile, "", "")
+	hmacOnly := newTestVerifier(t, testHMACSecret, "", "", "")
+	scoped := map[string]interface{}{"iss": "https://issuer.example", "aud": "stocky"}
+	merge := func(a, b map[string]interface{}) map[string]interface{} {
+		m := map[string]interface{}{}
+		for k, v := range a {
+			m[k] = v
+		}
+		for k, v := range b {
+			m[k] = v
+		}
+		return m
+	}
+
+	tests := []struct {
+		name      string
+		verifier  *JWTVerifier
+		token     string
+		wantRoles []string
+		wantErr   bool
+	}{
+		{name: "HS256", verifier: hmacOnly, token: signToken(t, "HS256", claims(nil), []byte(testHMACSecret), nil), wantRoles: []string{RoleUser}},
+		{name: "RS256", verifier: rsaOnly, token: signToken(t, "RS256", claims(map[string]interface{}{"roles": []string{"admin", "finance", "root"}}), nil, rsaKey), wantRoles: []string{RoleAdmin, RoleFinance}},
+		{name: "role claim", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"role": "issuer"}), []byte(testHMACSecret), nil), wantRoles: []string{RoleIssuer}},
+		{name: "HS256 wrong secret", verifier: hmacOnly, token: signToken(t, "HS256", claims(nil), []byte("another-secret-another-secret-xx"), nil), wantErr: true},
+		{name: "RS256 wrong key", verifier: rsaOnly, token: signToken(t, "RS256", claims(nil), nil, otherKey), wantErr: true},
+		// The public key is no secret; an HS256 token signed with it must not pass
+		{name: "algorithm confusion", verifier: rsaOnly, token: signToken(t, "HS256", claims(nil), keyPEM, nil), wantErr: true},
+		{name: "RS256 without RSA key", verifier: hmacOnly, token: signToken(t, "RS256", claims(nil), nil, rsaKey), wantErr: true},
+		{name: "alg none", verifier: hmacOnly, token: signToken(t, "none", claims(nil), nil, nil), wantErr: true},
+		{name: "missing sub", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"sub": nil}), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "missing exp", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"exp": nil}), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "expired", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"exp": testNow.Add(-time.Minute).Unix()}), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "expired within leeway", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"exp": testNow.Add(-10 * time.Second).Unix()}), []byte(testHMACSecret), nil), wantRoles: []string{RoleUser}},
+		{name: "not yet valid", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"nbf": testNow.Add(time.Minute).Unix()}), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "nbf within leeway", verifier: hmacOnly, token: signToken(t, "HS256", claims(map[string]interface{}{"nbf": testNow.Add(10 * time.Second).Unix()}), []byte(testHMACSecret), nil), wantRoles: []string{RoleUser}},
+		{name: "iss and aud", verifier: both, token: signToken(t, "HS256", claims(scoped), []byte(testHMACSecret), nil), wantRoles: []string{RoleUser}},
+		{name: "aud list", verifier: both, token: signToken(t, "RS256", claims(merge(scoped, map[string]interface{}{"aud": []string{"other", "stocky"}})), nil, rsaKey), wantRoles: []string{RoleUser}},
+		{name: "wrong iss", verifier: both, token: signToken(t, "HS256", claims(merge(scoped, map[string]interface{}{"iss": "https://evil.example"})), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "missing iss", verifier: both, token: signToken(t, "HS256", claims(map[string]interface{}{"aud": "stocky"}), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "wrong aud", verifier: both, token: signToken(t, "HS256", claims(merge(scoped, map[string]interface{}{"aud": []string{"other"}})), []byte(testHMACSecret), nil), wantErr: true},
+		{name: "malformed", verifier: hmacOnly, token: "not.a-token", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := tt.verifier.Verify(tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Fatalf("Verify = %+v, %v; want ErrInvalidCredentials", principal, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if principal.Subject != "user123" || principal.Method != MethodJWT || !equalRoles(principal.Roles, tt.wantRoles) {
+				t.Errorf("principal = %+v, want user123 with roles %v", principal, tt.wantRoles)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	if v, err := NewJWTVerifier("", "", "", ""); v != nil || err != nil {
+		t.Errorf("no keys: got %v, %v; want nil, nil", v, err)
+	}
+	if _, err := NewJWTVerifier("too-short", "", "", ""); err == nil {
+		t.Error("accepted an HS256 secret shorter than 32 bytes")
+	}
+	if _, err := NewJWTVerifier("", filepath.Join(t.TempDir(), "missing.pem"), "", ""); err == nil {
+		t.Error("accepted a missing RS256 key file")
+	}
+}
+
+func equalRoles(got, want []string) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadRejectsMalformedValues(t *testing.T) {
+	t.Setenv("PRICE_FEED_TIMEOUT", "5")
+	t.Setenv("REWARD_BATCH_MAX", "lots")
+	t.Setenv("AUTO_MIGRATE", "sometimes")
+
+	_, err := Load()
+	if err == nil {
+		t.Fatal("Load accepted malformed settings")
+	}
+	for _, key := range []string{"PRICE_FEED_TIMEOUT", "REWARD_BATCH_MAX", "AUTO_MIGRATE"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error %q does not name %s", err, key)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	t.Setenv("PRICE_FEED_TIMEOUT", "750ms")
+	t.Setenv("REWARD_BATCH_MAX", "")
+
+	cfg, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.PriceFeedTimeout != 750*time.Millisecond {
+		t.Errorf("PriceFeedTimeout = %v, want 750ms", cfg.PriceFeedTimeout)
+	}
+	if cfg.RewardBatchMax != 1000 {
+		t.Errorf("RewardBatchMax = %d, want the default 1000", cfg.RewardBatchMax)
+	}
+}
@@ -1,86 +1,303 @@
 package database
 
 import (
+	"context"
 	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Migrations live in migrations/ as NNNN_name.up.sql and NNNN_name.down.sql.
+// Every up migration is written to be safe on a database created before
+// schema_migrations existed, so such databases are adopted by running them all.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockKey is the Postgres advisory lock held while migrating, so
+// instances starting at the same time apply migrations one at a time
+const migrationLockKey = 727151001
+
+var ErrUnknownVersion = errors.New("unknown migration version")
+
+const createSchemaMigrationsTable = `
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version BIGINT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+`
+
+// Migration is one numbered schema change
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Migrator applies the embedded migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration // Ascending by version
+}
+
+func NewMigrator(db *sql.DB) (*Migrator, error) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{db: db, migrations: migrations}, nil
+}
+
+// RunMigrations applies every pending migration
 func RunMigrations(db *sql.DB) error {
-	migrations := []string{
-		createRewardEventsTable,
-		createLedgerEntriesTable,
-		createStockPricesTable,
-		createPortfolioSnapshotsTable,
-		createIndexes,
+	m, err := NewMigrator(db)
+	if err != nil {
+		return err
+	}
+	_, err = m.Up()
+	return err
+}
+
+// Latest returns the highest known migration version
+func (m *Migrator) Latest() int64 {
+	if len(m.migrations) == 0 {
+		return 0
 	}
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Up applies every pending migration and returns those applied
+func (m *Migrator) Up() ([]Migration, error) {
+	return m.To(m.Latest())
+}
 
-	for _, migration := range migrations {
-		if _, err := db.Exec(migration); err != nil {
+// Down rolls back the last steps applied migrations and returns those rolled back
+func (m *Migrator) Down(steps int) ([]Migration, error) {
+	var done []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
 			return err
 		}
+		for i := len(m.migrations) - 1; i >= 0 && len(done) < steps; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := revert(conn, mig); err != nil {
+				return err
+			}
+			done = append(done, mig)
+		}
+		return nil
+	})
+	return done, err
+}
+
+// To migrates up or down so that exactly the migrations up to version are applied.
+// Version 0 rolls back everything.
+func (m *Migrator) To(version int64) ([]Migration, error) {
+	if version != 0 && !m.known(version) {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
 	}
 
-	return nil
+	var done []Migration
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+
+		// Roll back newest first, then apply oldest first
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if _, ok := applied[mig.Version]; ok && mig.Version > version {
+				if err := revert(conn, mig); err != nil {
+					return err
+				}
+				done = append(done, mig)
+			}
+		}
+		for _, mig := range m.migrations {
+			if _, ok := applied[mig.Version]; !ok && mig.Version <= version {
+				if err := apply(conn, mig); err != nil {
+					return err
+				}
+				done = append(done, mig)
+			}
+		}
+		return nil
+	})
+	return done, err
 }
 
-const createRewardEventsTable = `
-CREATE TABLE IF NOT EXISTS reward_events (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id VARCHAR(255) NOT NULL,
-    stock_symbol VARCHAR(50) NOT NULL,
-    quantity NUMERIC(18, 6) NOT NULL,
-    reward_timestamp TIMESTAMP NOT NULL,
-    event_id VARCHAR(255) UNIQUE NOT NULL, -- For duplicate detection
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-`
+// Status lists every known migration and when it was applied
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	var statuses []MigrationStatus
+	err := m.withLock(func(conn *sql.Conn) error {
+		applied, err := appliedVersions(conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			status := MigrationStatus{Migration: mig}
+			if appliedAt, ok := applied[mig.Version]; ok {
+				status.AppliedAt = &appliedAt
+			}
+			statuses = append(statuses, status)
+		}
+		return nil
+	})
+	return statuses, err
+}
 
-const createLedgerEntriesTable = `
-CREATE TABLE IF NOT EXISTS ledger_entries (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    reward_event_id UUID REFERENCES reward_events(id) ON DELETE CASCADE,
-    entry_type VARCHAR(50) NOT NULL, -- 'STOCK_CREDIT', 'CASH_DEBIT', 'BROKERAGE_FEE', 'STT_FEE', 'GST_FEE', 'OTHER_FEE'
-    account_type VARCHAR(50) NOT NULL, -- 'STOCK', 'CASH', 'FEES'
-    stock_symbol VARCHAR(50), -- NULL for cash/fee entries
-    quantity NUMERIC(18, 6), -- NULL for cash/fee entries
-    amount NUMERIC(18, 4) NOT NULL, -- INR amount
-    description TEXT,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
-);
-`
+func (m *Migrator) known(version int64) bool {
+	for _, mig := range m.migrations {
+		if mig.Version == version {
+			return true
+		}
+	}
+	return false
+}
 
-const createStockPricesTable = `
-CREATE TABLE IF NOT EXISTS stock_prices (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    stock_symbol VARCHAR(50) NOT NULL,
-    price NUMERIC(18, 4) NOT NULL,
-    price_timestamp TIMESTAMP NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(stock_symbol, price_timestamp)
-);
-`
+// withLock runs fn on a single connection holding the migration advisory lock
+func (m *Migrator) withLock(fn func(conn *sql.Conn) error) error {
+	ctx := context.Background()
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
 
-const createPortfolioSnapshotsTable = `
-CREATE TABLE IF NOT EXISTS portfolio_snapshots (
-    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-    user_id VARCHAR(255) NOT NULL,
-    snapshot_date DATE NOT NULL,
-    stock_symbol VARCHAR(50) NOT NULL,
-    total_quantity NUMERIC(18, 6) NOT NULL,
-    price_per_unit NUMERIC(18, 4) NOT NULL,
-    total_inr_value NUMERIC(18, 4) NOT NULL,
-    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
-    UNIQUE(user_id, snapshot_date, stock_symbol)
-);
-`
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("acquire migration lock: %w", err)
+	}
+	defer conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, migrationLockKey)
 
-const createIndexes = `
-CREATE INDEX IF NOT EXISTS idx_reward_events_user_id ON reward_events(user_id);
-CREATE INDEX IF NOT EXISTS idx_reward_events_timestamp ON reward_events(reward_timestamp);
-CREATE INDEX IF NOT EXISTS idx_reward_events_event_id ON reward_events(event_id);
-CREATE INDEX IF NOT EXISTS idx_ledger_entries_reward_event_id ON ledger_entries(reward_event_id);
-CREATE INDEX IF NOT EXISTS idx_ledger_entries_account_type ON ledger_entries(account_type);
-CREATE INDEX IF NOT EXISTS idx_stock_prices_symbol_timestamp ON stock_prices(stock_symbol, price_timestamp DESC);
-CREATE INDEX IF NOT EXISTS idx_portfolio_snapshots_user_date ON portfolio_snapshots(user_id, snapshot_date DESC);
-`
+	if _, err := conn.ExecContext(ctx, createSchemaMigrationsTable); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// apply runs an up migration and records it in one transaction
+func apply(conn *sql.Conn, mig Migration) error {
+	return inTx(conn, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(mig.Up); err != nil {
+			return fmt.Errorf("migration %04d_%s up: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, mig.Version, mig.Name)
+		return err
+	})
+}
+
+// revert runs a down migration and removes its record in one transaction
+func revert(conn *sql.Conn, mig Migration) error {
+	return inTx(conn, func(tx *sql.Tx) error {
+		if _, err := tx.Exec(mig.Down); err != nil {
+			return fmt.Errorf("migration %04d_%s down: %w", mig.Version, mig.Name, err)
+		}
+		_, err := tx.Exec(`DELETE FROM schema_migrations WHERE version = $1`, mig.Version)
+		return err
+	})
+}
+
+func inTx(conn *sql.Conn, fn func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func appliedVersions(conn *sql.Conn) (map[int64]time.Time, error) {
+	rows, err := conn.QueryContext(context.Background(), `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]time.Time)
+	for rows.Next() {
+		var version int64
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// loadMigrations reads NNNN_name.{up,down}.sql pairs from fsys
+func loadMigrations(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "migrations/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, file := range files {
+		base := path.Base(file)
+		stem, direction, ok := strings.Cut(strings.TrimSuffix(base, ".sql"), ".")
+		if !ok || (direction != "up" && direction != "down") {
+			return nil, fmt.Errorf("migration %s: expected NNNN_name.up.sql or NNNN_name.down.sql", base)
+		}
+		versionStr, name, ok := strings.Cut(stem, "_")
+		if !ok {
+			return nil, fmt.Errorf("migration %s: missing name", base)
+		}
+		version, err := strconv.ParseInt(versionStr, 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s: invalid version", base)
+		}
+
+		body, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: name}
+			byVersion[version] = mig
+		} else if mig.Name != name {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s", version, mig.Name, name)
+		}
+		if direction == "up" {
+			mig.Up = string(body)
+		} else {
+			mig.Down = string(body)
+		}
+	}
 
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %04d_%s needs both up and down files", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
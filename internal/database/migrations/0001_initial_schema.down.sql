@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS portfolio_snapshots;
+DROP TABLE IF EXISTS stock_prices;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS reward_events;
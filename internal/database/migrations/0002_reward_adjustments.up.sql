@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS reward_adjustments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    reward_event_id UUID NOT NULL REFERENCES reward_events(id),
+    adjustment_type VARCHAR(50) NOT NULL, -- 'REVERSAL', 'ADJUSTMENT'
+    quantity NUMERIC(18, 6) NOT NULL CHECK (quantity < 0), -- Signed change to the rewarded quantity
+    reason TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE ledger_entries
+    ADD COLUMN IF NOT EXISTS adjustment_id UUID REFERENCES reward_adjustments(id);
+
+CREATE INDEX IF NOT EXISTS idx_reward_adjustments_reward_event_id ON reward_adjustments(reward_event_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_adjustment_id ON ledger_entries(adjustment_id);
@@ -0,0 +1,3 @@
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS corporate_action_id;
+DROP TABLE IF EXISTS corporate_action_adjustments;
+DROP TABLE IF EXISTS corporate_actions;
@@ -0,0 +1,29 @@
+CREATE TABLE IF NOT EXISTS corporate_actions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    action_type VARCHAR(50) NOT NULL, -- 'SPLIT', 'BONUS', 'SYMBOL_CHANGE', 'MERGER'
+    stock_symbol VARCHAR(50) NOT NULL,
+    new_stock_symbol VARCHAR(50), -- Target symbol for SYMBOL_CHANGE / MERGER
+    ratio_from NUMERIC(18, 6) NOT NULL DEFAULT 1 CHECK (ratio_from > 0), -- e.g. 1:5 split => ratio_from 1, ratio_to 5
+    ratio_to NUMERIC(18, 6) NOT NULL DEFAULT 1 CHECK (ratio_to > 0),
+    effective_date DATE NOT NULL,
+    description TEXT,
+    status VARCHAR(20) NOT NULL DEFAULT 'PENDING', -- 'PENDING', 'APPLIED'
+    applied_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS corporate_action_adjustments (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    corporate_action_id UUID NOT NULL REFERENCES corporate_actions(id),
+    user_id VARCHAR(255) NOT NULL,
+    stock_symbol VARCHAR(50) NOT NULL,
+    quantity NUMERIC(18, 6) NOT NULL, -- Signed change to the user's holding
+    effective_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE ledger_entries
+    ADD COLUMN IF NOT EXISTS corporate_action_id UUID REFERENCES corporate_actions(id);
+
+CREATE INDEX IF NOT EXISTS idx_corporate_actions_symbol_date ON corporate_actions(stock_symbol, effective_date);
+CREATE INDEX IF NOT EXISTS idx_corporate_action_adjustments_user ON corporate_action_adjustments(user_id, effective_at);
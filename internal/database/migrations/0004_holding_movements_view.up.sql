@@ -0,0 +1,31 @@
+-- holding_movements lists every change to a user's holdings: the original
+-- rewards, compensating adjustments and corporate action adjustments.
+-- Holdings are SUM(quantity) over it, filtered on effective_at.
+CREATE OR REPLACE VIEW holding_movements AS
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       r.quantity,
+       r.reward_timestamp AS rewarded_at,
+       r.reward_timestamp AS effective_at,
+       'REWARD'::VARCHAR AS source
+FROM reward_events r
+UNION ALL
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       a.quantity,
+       r.reward_timestamp AS rewarded_at,
+       a.created_at AS effective_at,
+       'ADJUSTMENT'::VARCHAR AS source
+FROM reward_adjustments a
+JOIN reward_events r ON r.id = a.reward_event_id
+UNION ALL
+SELECT NULL::UUID AS reward_event_id,
+       c.user_id,
+       c.stock_symbol,
+       c.quantity,
+       NULL::TIMESTAMP AS rewarded_at,
+       c.effective_at,
+       'CORPORATE_ACTION'::VARCHAR AS source
+FROM corporate_action_adjustments c;
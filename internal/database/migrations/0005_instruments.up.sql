@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS instruments (
+    stock_symbol VARCHAR(50) PRIMARY KEY,
+    status VARCHAR(20) NOT NULL DEFAULT 'ACTIVE', -- 'ACTIVE', 'SUSPENDED', 'DELISTED'
+    valuation_rule VARCHAR(20) NOT NULL DEFAULT 'CARRY_FORWARD', -- 'CARRY_FORWARD', 'WRITE_OFF' (applies once delisted)
+    status_reason TEXT,
+    status_changed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+DROP FUNCTION IF EXISTS check_journal_balanced();
+ALTER TABLE ledger_entries
+    DROP COLUMN IF EXISTS side,
+    DROP COLUMN IF EXISTS journal_id;
+DROP TABLE IF EXISTS journals;
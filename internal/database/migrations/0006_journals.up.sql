@@ -0,0 +1,58 @@
+CREATE TABLE IF NOT EXISTS journals (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    journal_type VARCHAR(50) NOT NULL, -- 'REWARD', 'REWARD_ADJUSTMENT', 'CORPORATE_ACTION'
+    reward_event_id UUID REFERENCES reward_events(id),
+    adjustment_id UUID REFERENCES reward_adjustments(id),
+    corporate_action_id UUID REFERENCES corporate_actions(id),
+    description TEXT,
+    posted_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE ledger_entries
+    ADD COLUMN IF NOT EXISTS journal_id UUID REFERENCES journals(id),
+    ADD COLUMN IF NOT EXISTS side VARCHAR(6) CHECK (side IN ('DEBIT', 'CREDIT'));
+
+-- Entries written before journals existed get the side implied by their entry type.
+-- They have no journal_id and are not covered by the balance trigger.
+UPDATE ledger_entries
+SET side = CASE
+    WHEN entry_type IN ('CASH_DEBIT', 'STOCK_DEBIT', 'CORPORATE_ACTION_DEBIT') OR entry_type LIKE '%_REVERSAL' THEN 'CREDIT'
+    ELSE 'DEBIT'
+END
+WHERE side IS NULL;
+
+-- Every journal must net to zero. The check is deferred to commit so the legs
+-- of a journal can be inserted one at a time.
+CREATE OR REPLACE FUNCTION check_journal_balanced() RETURNS TRIGGER AS $$
+DECLARE
+    jid UUID;
+    imbalance NUMERIC;
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        jid := OLD.journal_id;
+    ELSE
+        jid := NEW.journal_id;
+    END IF;
+    IF jid IS NULL THEN
+        RETURN NULL;
+    END IF;
+
+    SELECT COALESCE(SUM(CASE side WHEN 'DEBIT' THEN amount ELSE -amount END), 0)
+    INTO imbalance
+    FROM ledger_entries
+    WHERE journal_id = jid;
+
+    IF imbalance <> 0 THEN
+        RAISE EXCEPTION 'journal % is unbalanced by %', jid, imbalance;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_entries_balanced ON ledger_entries;
+CREATE CONSTRAINT TRIGGER ledger_entries_balanced
+    AFTER INSERT OR UPDATE OR DELETE ON ledger_entries
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_balanced();
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_journal_id ON ledger_entries(journal_id);
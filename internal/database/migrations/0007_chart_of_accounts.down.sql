@@ -0,0 +1,2 @@
+ALTER TABLE ledger_entries DROP COLUMN IF EXISTS account_code;
+DROP TABLE IF EXISTS accounts;
@@ -0,0 +1,39 @@
+-- Chart of accounts. account_type is the reporting group that ledger_entries.account_type
+-- carries; per-symbol accounts ("STOCK_INVENTORY:RELIANCE") are opened from their parent on first use.
+CREATE TABLE IF NOT EXISTS accounts (
+    code VARCHAR(100) PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    account_class VARCHAR(20) NOT NULL CHECK (account_class IN ('ASSET', 'LIABILITY', 'EQUITY', 'INCOME', 'EXPENSE')),
+    account_type VARCHAR(50) NOT NULL, -- Reporting group: 'CASH', 'STOCK', 'USER_STOCK', 'PAYABLES', 'FEES', 'EXPENSE'
+    parent_code VARCHAR(100) REFERENCES accounts(code),
+    stock_symbol VARCHAR(50), -- Set on per-symbol sub-accounts
+    is_active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO accounts (code, name, account_class, account_type) VALUES
+    ('COMPANY_CASH', 'Company cash', 'ASSET', 'CASH'),
+    ('STOCK_INVENTORY', 'Stock inventory', 'ASSET', 'STOCK'),
+    ('USER_STOCK_LIABILITY', 'User stock liability', 'LIABILITY', 'USER_STOCK'),
+    ('BROKERAGE_PAYABLE', 'Brokerage payable', 'LIABILITY', 'PAYABLES'),
+    ('STT_PAYABLE', 'STT payable', 'LIABILITY', 'PAYABLES'),
+    ('GST_PAYABLE', 'GST payable', 'LIABILITY', 'PAYABLES'),
+    ('OTHER_FEES_PAYABLE', 'Other regulatory fees payable', 'LIABILITY', 'PAYABLES'),
+    ('FEE_EXPENSE', 'Transaction fees expense', 'EXPENSE', 'FEES'),
+    ('REWARD_EXPENSE', 'Stock reward expense', 'EXPENSE', 'EXPENSE')
+ON CONFLICT (code) DO NOTHING;
+
+ALTER TABLE ledger_entries
+    ADD COLUMN IF NOT EXISTS account_code VARCHAR(100) REFERENCES accounts(code);
+
+-- Entries written before the chart of accounts existed are mapped to the parent
+-- account matching their free-form account_type
+UPDATE ledger_entries
+SET account_code = CASE account_type
+    WHEN 'CASH' THEN 'COMPANY_CASH'
+    WHEN 'STOCK' THEN 'STOCK_INVENTORY'
+    ELSE 'FEE_EXPENSE'
+END
+WHERE account_code IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_ledger_entries_account_code ON ledger_entries(account_code);
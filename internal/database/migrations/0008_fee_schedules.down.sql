@@ -0,0 +1,4 @@
+ALTER TABLE reward_events
+    DROP COLUMN IF EXISTS fee_schedule_id,
+    DROP COLUMN IF EXISTS exchange;
+DROP TABLE IF EXISTS fee_schedules;
@@ -0,0 +1,26 @@
+-- Fee schedules are versioned per exchange by effective date; a reward uses the
+-- latest schedule for its exchange that is effective on its reward_timestamp
+CREATE TABLE IF NOT EXISTS fee_schedules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    exchange VARCHAR(20) NOT NULL, -- 'NSE', 'BSE'
+    effective_from DATE NOT NULL,
+    brokerage_rate NUMERIC(10, 6) NOT NULL CHECK (brokerage_rate >= 0),
+    brokerage_min NUMERIC(18, 4) NOT NULL DEFAULT 0 CHECK (brokerage_min >= 0),
+    brokerage_max NUMERIC(18, 4) CHECK (brokerage_max >= brokerage_min), -- NULL means uncapped
+    stt_rate NUMERIC(10, 6) NOT NULL CHECK (stt_rate >= 0),
+    gst_rate NUMERIC(10, 6) NOT NULL CHECK (gst_rate >= 0), -- Applied to brokerage
+    other_fees_flat NUMERIC(18, 4) NOT NULL DEFAULT 0 CHECK (other_fees_flat >= 0),
+    description TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (exchange, effective_from)
+);
+
+-- The rates that were previously hard-coded, effective from the beginning of time
+INSERT INTO fee_schedules (exchange, effective_from, brokerage_rate, stt_rate, gst_rate, other_fees_flat, description) VALUES
+    ('NSE', '1970-01-01', 0.0001, 0.001, 0.18, 10.0000, 'Default schedule'),
+    ('BSE', '1970-01-01', 0.0001, 0.001, 0.18, 10.0000, 'Default schedule')
+ON CONFLICT (exchange, effective_from) DO NOTHING;
+
+ALTER TABLE reward_events
+    ADD COLUMN IF NOT EXISTS exchange VARCHAR(20) NOT NULL DEFAULT 'NSE',
+    ADD COLUMN IF NOT EXISTS fee_schedule_id UUID REFERENCES fee_schedules(id);
@@ -0,0 +1,7 @@
+-- Users whose snapshots from dirty_from onwards no longer match their holdings, e.g.
+-- after a backdated reward. A worker recomputes them and deletes the row.
+CREATE TABLE IF NOT EXISTS snapshot_invalidations (
+    user_id VARCHAR(255) PRIMARY KEY,
+    dirty_from DATE NOT NULL, -- Earliest snapshot date to recompute
+    marked_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP -- Bumped on every mark so a recompute in progress does not clear a newer one
+);
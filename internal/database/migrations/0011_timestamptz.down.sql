@@ -0,0 +1,62 @@
+DROP VIEW IF EXISTS holding_movements;
+
+ALTER TABLE reward_events
+    ALTER COLUMN reward_timestamp TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN updated_at TYPE TIMESTAMP;
+ALTER TABLE ledger_entries
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE stock_prices
+    ALTER COLUMN price_timestamp TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE portfolio_snapshots
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE reward_adjustments
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE corporate_actions
+    ALTER COLUMN applied_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE corporate_action_adjustments
+    ALTER COLUMN effective_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE instruments
+    ALTER COLUMN status_changed_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN updated_at TYPE TIMESTAMP;
+ALTER TABLE journals
+    ALTER COLUMN posted_at TYPE TIMESTAMP;
+ALTER TABLE accounts
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE fee_schedules
+    ALTER COLUMN created_at TYPE TIMESTAMP;
+ALTER TABLE snapshot_invalidations
+    ALTER COLUMN marked_at TYPE TIMESTAMP;
+
+CREATE VIEW holding_movements AS
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       r.quantity,
+       r.reward_timestamp AS rewarded_at,
+       r.reward_timestamp AS effective_at,
+       'REWARD'::VARCHAR AS source
+FROM reward_events r
+UNION ALL
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       a.quantity,
+       r.reward_timestamp AS rewarded_at,
+       a.created_at AS effective_at,
+       'ADJUSTMENT'::VARCHAR AS source
+FROM reward_adjustments a
+JOIN reward_events r ON r.id = a.reward_event_id
+UNION ALL
+SELECT NULL::UUID AS reward_event_id,
+       c.user_id,
+       c.stock_symbol,
+       c.quantity,
+       NULL::TIMESTAMP AS rewarded_at,
+       c.effective_at,
+       'CORPORATE_ACTION'::VARCHAR AS source
+FROM corporate_action_adjustments c;
@@ -0,0 +1,66 @@
+-- Store every timestamp as TIMESTAMPTZ so it names an instant regardless of the server's
+-- or the session's timezone. Existing values are read in the session TimeZone, the zone
+-- CURRENT_TIMESTAMP defaults were written in; business days are computed by the application.
+-- The view depends on these columns, so it is recreated around the change.
+DROP VIEW IF EXISTS holding_movements;
+
+ALTER TABLE reward_events
+    ALTER COLUMN reward_timestamp TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
+ALTER TABLE ledger_entries
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE stock_prices
+    ALTER COLUMN price_timestamp TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE portfolio_snapshots
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE reward_adjustments
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE corporate_actions
+    ALTER COLUMN applied_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE corporate_action_adjustments
+    ALTER COLUMN effective_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE instruments
+    ALTER COLUMN status_changed_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN updated_at TYPE TIMESTAMPTZ;
+ALTER TABLE journals
+    ALTER COLUMN posted_at TYPE TIMESTAMPTZ;
+ALTER TABLE accounts
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE fee_schedules
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ;
+ALTER TABLE snapshot_invalidations
+    ALTER COLUMN marked_at TYPE TIMESTAMPTZ;
+
+CREATE VIEW holding_movements AS
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       r.quantity,
+       r.reward_timestamp AS rewarded_at,
+       r.reward_timestamp AS effective_at,
+       'REWARD'::VARCHAR AS source
+FROM reward_events r
+UNION ALL
+SELECT r.id AS reward_event_id,
+       r.user_id,
+       r.stock_symbol,
+       a.quantity,
+       r.reward_timestamp AS rewarded_at,
+       a.created_at AS effective_at,
+       'ADJUSTMENT'::VARCHAR AS source
+FROM reward_adjustments a
+JOIN reward_events r ON r.id = a.reward_event_id
+UNION ALL
+SELECT NULL::UUID AS reward_event_id,
+       c.user_id,
+       c.stock_symbol,
+       c.quantity,
+       NULL::TIMESTAMPTZ AS rewarded_at,
+       c.effective_at,
+       'CORPORATE_ACTION'::VARCHAR AS source
+FROM corporate_action_adjustments c;
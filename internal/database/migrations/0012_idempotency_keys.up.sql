@@ -0,0 +1,14 @@
+-- Responses stored under an Idempotency-Key so a retried write is answered with the original result
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    client VARCHAR(255) NOT NULL, -- "<method>:<caller>" of the authenticated caller
+    idempotency_key VARCHAR(255) NOT NULL,
+    request_hash CHAR(64) NOT NULL, -- SHA-256 of method, path and body
+    status_code INTEGER, -- NULL while the first request is still running
+    content_type VARCHAR(255),
+    response_body BYTEA,
+    created_at TIMESTAMPTZ NOT NULL,
+    completed_at TIMESTAMPTZ,
+    PRIMARY KEY (client, idempotency_key)
+);
+
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys(created_at);
@@ -0,0 +1 @@
+ALTER TABLE reward_events DROP COLUMN IF EXISTS payload_hash;
@@ -0,0 +1,3 @@
+-- Canonical hash of the request payload, to tell a replayed event_id from one reused for a different reward.
+-- Rewards recorded before this column existed keep NULL and are compared field by field.
+ALTER TABLE reward_events ADD COLUMN IF NOT EXISTS payload_hash CHAR(64);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_instruments_isin;
+ALTER TABLE instruments
+    DROP COLUMN IF EXISTS isin,
+    DROP COLUMN IF EXISTS exchange,
+    DROP COLUMN IF EXISTS company_name,
+    DROP COLUMN IF EXISTS sector,
+    DROP COLUMN IF EXISTS face_value,
+    DROP COLUMN IF EXISTS tick_size;
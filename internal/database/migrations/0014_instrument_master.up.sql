@@ -0,0 +1,19 @@
+-- Reference data for each listed instrument. Rewards are only accepted for symbols in this table.
+ALTER TABLE instruments
+    ADD COLUMN IF NOT EXISTS isin CHAR(12),
+    ADD COLUMN IF NOT EXISTS exchange VARCHAR(10), -- 'NSE', 'BSE' (primary listing)
+    ADD COLUMN IF NOT EXISTS company_name VARCHAR(255),
+    ADD COLUMN IF NOT EXISTS sector VARCHAR(100),
+    ADD COLUMN IF NOT EXISTS face_value NUMERIC(18, 4),
+    ADD COLUMN IF NOT EXISTS tick_size NUMERIC(18, 4);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_instruments_isin ON instruments(isin);
+
+-- Symbols already held or priced stay known; their reference data is filled in by the seed import
+INSERT INTO instruments (stock_symbol)
+SELECT stock_symbol FROM reward_events
+UNION
+SELECT stock_symbol FROM stock_prices
+UNION
+SELECT new_stock_symbol FROM corporate_actions WHERE new_stock_symbol IS NOT NULL
+ON CONFLICT (stock_symbol) DO NOTHING;
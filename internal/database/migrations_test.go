@@ -0,0 +1,82 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+
+	// Versions run 1, 2, 3... so a gap or a duplicate number shows up here
+	for i, mig := range migrations {
+		if mig.Version != int64(i+1) {
+			t.Errorf("migration %d is %04d_%s, want version %d", i, mig.Version, mig.Name, i+1)
+		}
+		if strings.TrimSpace(mig.Up) == "" || strings.TrimSpace(mig.Down) == "" {
+			t.Errorf("%04d_%s has an empty up or down file", mig.Version, mig.Name)
+		}
+	}
+
+	m := &Migrator{migrations: migrations}
+	if m.Latest() != int64(len(migrations)) || !m.known(1) || m.known(0) || m.known(m.Latest()+1) {
+		t.Errorf("latest = %d of %d migrations", m.Latest(), len(migrations))
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	file := func(body string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(body)} }
+
+	// Files are sorted by version, not by name
+	migrations, err := loadMigrations(fstest.MapFS{
+		"migrations/10_later.up.sql":   file("SELECT 10"),
+		"migrations/10_later.down.sql": file("SELECT -10"),
+		"migrations/2_first.up.sql":    file("SELECT 2"),
+		"migrations/2_first.down.sql":  file("SELECT -2"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Version != 2 || migrations[1].Version != 10 {
+		t.Fatalf("migrations = %+v, want 2 then 10", migrations)
+	}
+	if migrations[0].Name != "first" || migrations[0].Up != "SELECT 2" || migrations[0].Down != "SELECT -2" {
+		t.Errorf("migration 2 = %+v", migrations[0])
+	}
+
+	tests := map[string]fstest.MapFS{
+		"missing down": {
+			"migrations/0001_init.up.sql": file("SELECT 1"),
+		},
+		"missing up": {
+			"migrations/0001_init.down.sql": file("SELECT 1"),
+		},
+		"two names": {
+			"migrations/0001_init.up.sql":      file("SELECT 1"),
+			"migrations/0001_initial.down.sql": file("SELECT 1"),
+		},
+		"no direction": {
+			"migrations/0001_init.sql": file("SELECT 1"),
+		},
+		"no name": {
+			"migrations/0001.up.sql":   file("SELECT 1"),
+			"migrations/0001.down.sql": file("SELECT 1"),
+		},
+		"zero version": {
+			"migrations/0000_init.up.sql":   file("SELECT 1"),
+			"migrations/0000_init.down.sql": file("SELECT 1"),
+		},
+	}
+	for name, fsys := range tests {
+		if migrations, err := loadMigrations(fsys); err == nil {
+			t.Errorf("%s: migrations = %+v, want an error", name, migrations)
+		}
+	}
+}
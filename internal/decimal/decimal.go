@@ -0,0 +1,304 @@
+package decimal
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Scales matching the NUMERIC columns used throughout the schema
+const (
+	AmountScale   = 4 // NUMERIC(18, 4) - INR amounts
+	QuantityScale = 6 // NUMERIC(18, 6) - stock quantities
+)
+
+var (
+	ErrInvalidDecimal = errors.New("invalid decimal")
+	ErrDivisionByZero = errors.New("decimal division by zero")
+)
+
+// RoundingMode controls how digits are discarded when reducing the scale
+type RoundingMode int
+
+const (
+	// RoundHalfEven rounds to the nearest neighbour, ties to the even digit (banker's rounding)
+	RoundHalfEven RoundingMode = iota
+	// RoundHalfUp rounds to the nearest neighbour, ties away from zero
+	RoundHalfUp
+	// RoundDown truncates towards zero
+	RoundDown
+	// RoundUp rounds away from zero
+	RoundUp
+)
+
+var bigTen = big.NewInt(10)
+
+// Decimal is an exact fixed-point number: value * 10^-scale.
+// The zero value is 0 with scale 0 and is ready to use.
+type Decimal struct {
+	value *big.Int
+	scale int32
+}
+
+// Zero returns 0 at the given scale
+func Zero(scale int32) Decimal {
+	return Decimal{value: new(big.Int), scale: scale}
+}
+
+// New returns unscaled * 10^-scale
+func New(unscaled int64, scale int32) Decimal {
+	return Decimal{value: big.NewInt(unscaled), scale: scale}
+}
+
+// Parse parses a plain decimal string such as "-12.3400" as returned by Postgres NUMERIC.
+// The scale of the result is the number of digits after the decimal point.
+func Parse(s string) (Decimal, error) {
+	str := strings.TrimSpace(s)
+	if str == "" {
+		return Decimal{}, fmt.Errorf("%w: empty string", ErrInvalidDecimal)
+	}
+
+	neg := false
+	switch str[0] {
+	case '-':
+		neg = true
+		str = str[1:]
+	case '+':
+		str = str[1:]
+	}
+
+	intPart, fracPart, hasPoint := strings.Cut(str, ".")
+	if intPart == "" && fracPart == "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if hasPoint && fracPart == "" {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	digits := intPart + fracPart
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+		}
+	}
+
+	value, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return Decimal{}, fmt.Errorf("%w: %q", ErrInvalidDecimal, s)
+	}
+	if neg {
+		value.Neg(value)
+	}
+
+	return Decimal{value: value, scale: int32(len(fracPart))}, nil
+}
+
+// MustParse is like Parse but panics on error. Intended for constants.
+func MustParse(s string) Decimal {
+	d, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+// Scale returns the number of digits after the decimal point
+func (d Decimal) Scale() int32 {
+	return d.scale
+}
+
+func (d Decimal) unscaled() *big.Int {
+	if d.value == nil {
+		return new(big.Int)
+	}
+	return d.value
+}
+
+// rescale returns the unscaled value of d expressed at a larger or equal scale
+func (d Decimal) rescale(scale int32) *big.Int {
+	v := new(big.Int).Set(d.unscaled())
+	if scale > d.scale {
+		v.Mul(v, pow10(scale-d.scale))
+	}
+	return v
+}
+
+// Add returns d + o at the larger of the two scales
+func (d Decimal) Add(o Decimal) Decimal {
+	scale := maxScale(d.scale, o.scale)
+	v := d.rescale(scale)
+	v.Add(v, o.rescale(scale))
+	return Decimal{value: v, scale: scale}
+}
+
+// Sub returns d - o at the larger of the two scales
+func (d Decimal) Sub(o Decimal) Decimal {
+	scale := maxScale(d.scale, o.scale)
+	v := d.rescale(scale)
+	v.Sub(v, o.rescale(scale))
+	return Decimal{value: v, scale: scale}
+}
+
+// Mul returns the exact product d * o; its scale is the sum of both scales
+func (d Decimal) Mul(o Decimal) Decimal {
+	v := new(big.Int).Mul(d.unscaled(), o.unscaled())
+	return Decimal{value: v, scale: d.scale + o.scale}
+}
+
+// Div returns d / o rounded to the given scale using mode
+func (d Decimal) Div(o Decimal, scale int32, mode RoundingMode) (Decimal, error) {
+	if o.Sign() == 0 {
+		return Decimal{}, ErrDivisionByZero
+	}
+
+	// q = (a * 10^-sa) / (b * 10^-sb) = a * 10^(scale - sa + sb) / b * 10^-scale
+	num := new(big.Int).Set(d.unscaled())
+	den := new(big.Int).Set(o.unscaled())
+	if shift := scale - d.scale + o.scale; shift >= 0 {
+		num.Mul(num, pow10(shift))
+	} else {
+		den.Mul(den, pow10(-shift))
+	}
+
+	return Decimal{value: quoRound(num, den, mode), scale: scale}, nil
+}
+
+// Round returns d at the given scale, discarding digits according to mode
+func (d Decimal) Round(scale int32, mode RoundingMode) Decimal {
+	if scale >= d.scale {
+		return Decimal{value: d.rescale(scale), scale: scale}
+	}
+	v := quoRound(new(big.Int).Set(d.unscaled()), pow10(d.scale-scale), mode)
+	return Decimal{value: v, scale: scale}
+}
+
+// Neg returns -d
+func (d Decimal) Neg() Decimal {
+	return Decimal{value: new(big.Int).Neg(d.unscaled()), scale: d.scale}
+}
+
+// Abs returns |d|
+func (d Decimal) Abs() Decimal {
+	return Decimal{value: new(big.Int).Abs(d.unscaled()), scale: d.scale}
+}
+
+// Sign returns -1, 0 or +1
+func (d Decimal) Sign() int {
+	return d.unscaled().Sign()
+}
+
+// IsZero reports whether d == 0
+func (d Decimal) IsZero() bool {
+	return d.Sign() == 0
+}
+
+// Cmp compares d and o numerically, ignoring scale
+func (d Decimal) Cmp(o Decimal) int {
+	scale := maxScale(d.scale, o.scale)
+	return d.rescale(scale).Cmp(o.rescale(scale))
+}
+
+// Equal reports whether d and o are numerically equal
+func (d Decimal) Equal(o Decimal) bool {
+	return d.Cmp(o) == 0
+}
+
+// String formats d with exactly Scale() fractional digits
+func (d Decimal) String() string {
+	v := d.unscaled()
+	digits := new(big.Int).Abs(v).String()
+
+	if d.scale > 0 {
+		if pad := int(d.scale) + 1 - len(digits); pad > 0 {
+			digits = strings.Repeat("0", pad) + digits
+		}
+		point := len(digits) - int(d.scale)
+		digits = digits[:point] + "." + digits[point:]
+	} else if d.scale < 0 && v.Sign() != 0 {
+		digits += strings.Repeat("0", int(-d.scale))
+	}
+
+	if v.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// StringFixed rounds d to scale using mode and formats it
+func (d Decimal) StringFixed(scale int32, mode RoundingMode) string {
+	return d.Round(scale, mode).String()
+}
+
+// Scan implements sql.Scanner for NUMERIC columns
+func (d *Decimal) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		*d = New(v, 0)
+		return nil
+	case nil:
+		return fmt.Errorf("%w: NULL", ErrInvalidDecimal)
+	default:
+		return fmt.Errorf("%w: unsupported type %T", ErrInvalidDecimal, src)
+	}
+
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
+
+// Value implements driver.Valuer so a Decimal can be bound to NUMERIC parameters
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// quoRound divides num by den and rounds the quotient to an integer using mode
+func quoRound(num, den *big.Int, mode RoundingMode) *big.Int {
+	q, r := new(big.Int).QuoRem(num, den, new(big.Int))
+	if r.Sign() == 0 {
+		return q
+	}
+
+	// QuoRem truncates towards zero; step away from zero when the mode says so
+	sign := int64(num.Sign() * den.Sign())
+	awayFromZero := false
+	switch mode {
+	case RoundDown:
+		awayFromZero = false
+	case RoundUp:
+		awayFromZero = true
+	case RoundHalfUp, RoundHalfEven:
+		twiceRem := new(big.Int).Abs(r)
+		twiceRem.Lsh(twiceRem, 1)
+		switch twiceRem.Cmp(new(big.Int).Abs(den)) {
+		case 1:
+			awayFromZero = true
+		case 0:
+			awayFromZero = mode == RoundHalfUp || q.Bit(0) == 1
+		}
+	}
+
+	if awayFromZero {
+		q.Add(q, big.NewInt(sign))
+	}
+	return q
+}
+
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(bigTen, big.NewInt(int64(n)), nil)
+}
+
+func maxScale(a, b int32) int32 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,198 @@
+package decimal
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in    string
+		want  string
+		scale int32
+	}{
+		{"0", "0", 0},
+		{"12", "12", 0},
+		{"-12.3400", "-12.3400", 4},
+		{"+7.5", "7.5", 1},
+		{" 3.14 ", "3.14", 2},
+		{".5", "0.5", 1},
+		{"-.5", "-0.5", 1},
+		{"007.10", "7.10", 2},
+		{"-0.00", "0.00", 2},
+		{"123456789012345678901234567890.123456", "123456789012345678901234567890.123456", 6},
+	}
+	for _, tt := range tests {
+		d, err := Parse(tt.in)
+		if err != nil {
+			t.Errorf("Parse(%q) error: %v", tt.in, err)
+			continue
+		}
+		if got := d.String(); got != tt.want || d.Scale() != tt.scale {
+			t.Errorf("Parse(%q) = %s (scale %d), want %s (scale %d)", tt.in, got, d.Scale(), tt.want, tt.scale)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, in := range []string{
+		"", "  ", "-", "+", ".", "-.", "5.", "1.2.3", "--1", "+-1", "1e3", "1E-2", "0x10",
+		"12a", "١٢", "NaN", "Inf", "1,000", "1 000", "- 1",
+	} {
+		if d, err := Parse(in); !errors.Is(err, ErrInvalidDecimal) {
+			t.Errorf("Parse(%q) = %v, %v; want ErrInvalidDecimal", in, d, err)
+		}
+	}
+}
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		in    string
+		scale int32
+		mode  RoundingMode
+		want  string
+	}{
+		// Ties
+		{"2.5", 0, RoundHalfEven, "2"},
+		{"3.5", 0, RoundHalfEven, "4"},
+		{"-2.5", 0, RoundHalfEven, "-2"},
+		{"-3.5", 0, RoundHalfEven, "-4"},
+		{"2.5", 0, RoundHalfUp, "3"},
+		{"-2.5", 0, RoundHalfUp, "-3"},
+		{"2.5", 0, RoundDown, "2"},
+		{"-2.5", 0, RoundDown, "-2"},
+		{"2.5", 0, RoundUp, "3"},
+		{"-2.5", 0, RoundUp, "-3"},
+		// Below half
+		{"1.2344", 3, RoundHalfEven, "1.234"},
+		{"-1.2344", 3, RoundHalfUp, "-1.234"},
+		{"1.2341", 3, RoundUp, "1.235"},
+		{"-1.2341", 3, RoundUp, "-1.235"},
+		{"1.2349", 3, RoundDown, "1.234"},
+		{"-1.2349", 3, RoundDown, "-1.234"},
+		// Above half
+		{"1.23451", 3, RoundHalfEven, "1.235"},
+		{"-1.23451", 3, RoundHalfEven, "-1.235"},
+		{"1.2346", 3, RoundHalfUp, "1.235"},
+		// Exact values are left alone
+		{"-1.2340", 3, RoundUp, "-1.234"},
+		{"0.0000", 2, RoundUp, "0.00"},
+		// Increasing the scale pads with zeros
+		{"1.5", 4, RoundDown, "1.5000"},
+		{"-7", 2, RoundHalfEven, "-7.00"},
+		// Rounding to zero keeps no sign
+		{"-0.004", 2, RoundHalfUp, "0.00"},
+		{"-0.004", 2, RoundUp, "-0.01"},
+	}
+	for _, tt := range tests {
+		if got := MustParse(tt.in).Round(tt.scale, tt.mode).String(); got != tt.want {
+			t.Errorf("Round(%s, %d, %d) = %s, want %s", tt.in, tt.scale, tt.mode, got, tt.want)
+		}
+	}
+}
+
+func TestDiv(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		scale int32
+		mode  RoundingMode
+		want  string
+	}{
+		{"1", "3", 4, RoundHalfEven, "0.3333"},
+		{"2", "3", 4, RoundHalfEven, "0.6667"},
+		{"2", "3", 4, RoundDown, "0.6666"},
+		{"-2", "3", 4, RoundDown, "-0.6666"},
+		{"-2", "3", 4, RoundHalfUp, "-0.6667"},
+		{"1", "-3", 2, RoundUp, "-0.34"},
+		{"10", "4", 0, RoundHalfEven, "2"},
+		{"10", "4", 0, RoundHalfUp, "3"},
+		{"35000.0000", "0.0001", 0, RoundHalfEven, "350000000"},
+		{"1.000000", "7", 2, RoundHalfEven, "0.14"},
+		{"22", "7", 20, RoundHalfEven, "3.14285714285714285714"},
+		{"0.05", "0.0200", 6, RoundHalfEven, "2.500000"},
+	}
+	for _, tt := range tests {
+		got, err := MustParse(tt.a).Div(MustParse(tt.b), tt.scale, tt.mode)
+		if err != nil {
+			t.Errorf("%s / %s: %v", tt.a, tt.b, err)
+			continue
+		}
+		if got.String() != tt.want {
+			t.Errorf("%s / %s at scale %d = %s, want %s", tt.a, tt.b, tt.scale, got, tt.want)
+		}
+	}
+
+	if _, err := MustParse("1").Div(MustParse("0.000"), 2, RoundHalfEven); !errors.Is(err, ErrDivisionByZero) {
+		t.Errorf("division by zero: err = %v, want ErrDivisionByZero", err)
+	}
+}
+
+func TestArithmetic(t *testing.T) {
+	a, b := MustParse("3500.25"), MustParse("-0.1234")
+	if got := a.Add(b).String(); got != "3500.1266" {
+		t.Errorf("Add = %s, want 3500.1266", got)
+	}
+	if got := a.Sub(b).String(); got != "3500.3734" {
+		t.Errorf("Sub = %s, want 3500.3734", got)
+	}
+	if got := a.Mul(b).String(); got != "-431.930850" {
+		t.Errorf("Mul = %s, want -431.930850", got)
+	}
+	if got := b.Abs().String(); got != "0.1234" {
+		t.Errorf("Abs = %s, want 0.1234", got)
+	}
+	if MustParse("1.50").Cmp(MustParse("1.5")) != 0 || !MustParse("1.50").Equal(MustParse("1.5")) {
+		t.Error("1.50 and 1.5 compare unequal")
+	}
+	if MustParse("-2").Cmp(MustParse("1.999")) != -1 {
+		t.Error("-2 does not compare below 1.999")
+	}
+
+	// The zero value is usable
+	var zero Decimal
+	if got := zero.Add(MustParse("1.25")).String(); got != "1.25" || !zero.IsZero() || zero.String() != "0" {
+		t.Errorf("zero value: 0 + 1.25 = %s, String = %s", got, zero.String())
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, s := range []string{
+		"0", "0.0000", "1", "-1", "0.000001", "-0.000001", "12.3400", "100", "-100.50",
+		"999999999999999999.9999", "-0.5",
+	} {
+		d, err := Parse(s)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", s, err)
+		}
+		if got := d.String(); got != s {
+			t.Errorf("Parse(%q).String() = %q", s, got)
+		}
+		again, err := Parse(d.String())
+		if err != nil || !again.Equal(d) || again.Scale() != d.Scale() {
+			t.Errorf("round trip of %q gave %v, %v", s, again, err)
+		}
+	}
+
+	if got := New(-5, 3).String(); got != "-0.005" {
+		t.Errorf("New(-5, 3) = %s, want -0.005", got)
+	}
+	if got := New(12, -2).String(); got != "1200" {
+		t.Errorf("New(12, -2) = %s, want 1200", got)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var d Decimal
+	if err := d.Scan([]byte("42.1000")); err != nil || d.String() != "42.1000" {
+		t.Errorf("Scan([]byte) = %s, %v", d, err)
+	}
+	if err := d.Scan(int64(-3)); err != nil || d.String() != "-3" {
+		t.Errorf("Scan(int64) = %s, %v", d, err)
+	}
+	if err := d.Scan(nil); !errors.Is(err, ErrInvalidDecimal) {
+		t.Errorf("Scan(nil) err = %v, want ErrInvalidDecimal", err)
+	}
+	if err := d.Scan(1.5); !errors.Is(err, ErrInvalidDecimal) {
+		t.Errorf("Scan(float64) err = %v, want ErrInvalidDecimal", err)
+	}
+}
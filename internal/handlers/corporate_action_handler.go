@@ -0,0 +1,94 @@
+package handlers
+
+import (
+	"net/http"
+	"stocky/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+type CorporateActionHandler struct {
+	corporateActionService *services.CorporateActionService
+	logger                 *logrus.Logger
+}
+
+func NewCorporateActionHandler(corporateActionService *services.CorporateActionService, logger *logrus.Logger) *CorporateActionHandler {
+	return &CorporateActionHandler{
+		corporateActionService: corporateActionService,
+		logger:                 logger,
+	}
+}
+
+// CreateCorporateActionRequest represents the request payload for recording a corporate action
+type CreateCorporateActionRequest struct {
+	ActionType     string `json:"action_type" binding:"required"` // SPLIT, BONUS, SYMBOL_CHANGE, MERGER
+	StockSymbol    string `json:"stock_symbol" binding:"required"`
+	NewStockSymbol string `json:"new_stock_symbol"`                  // Required for SYMBOL_CHANGE and MERGER
+	RatioFrom      string `json:"ratio_from"`                        // Defaults to 1
+	RatioTo        string `json:"ratio_to"`                          // Defaults to 1
+	EffectiveDate  string `json:"effective_date" binding:"required"` // YYYY-MM-DD
+	Description    string `json:"description"`
+}
+
+// CreateCorporateAction handles POST /admin/corporate-actions
+func (h *CorporateActionHandler) CreateCorporateAction(c *gin.Context) {
+	var req CreateCorporateActionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	effectiveDate, err := time.Parse("2006-01-02", req.EffectiveDate)
+	if err != nil {
+		invalidRequest(c, "invalid effective_date format, use YYYY-MM-DD")
+		return
+	}
+
+	action, err := h.corporateActionService.CreateCorporateAction(
+		c.Request.Context(),
+		req.ActionType,
+		req.StockSymbol,
+		req.NewStockSymbol,
+		req.RatioFrom,
+		req.RatioTo,
+		effectiveDate,
+		req.Description,
+	)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, action)
+}
+
+// ListCorporateActions handles GET /admin/corporate-actions
+func (h *CorporateActionHandler) ListCorporateActions(c *gin.Context) {
+	actions, err := h.corporateActionService.ListCorporateActions(c.Request.Context(), c.Query("stock_symbol"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, actions)
+}
+
+// ApplyCorporateAction handles POST /admin/corporate-actions/:id/apply
+func (h *CorporateActionHandler) ApplyCorporateAction(c *gin.Context) {
+	id := c.Param("id")
+	if _, err := uuid.Parse(id); err != nil {
+		invalidRequest(c, "invalid corporate action id")
+		return
+	}
+
+	action, err := h.corporateActionService.ApplyCorporateAction(c.Request.Context(), id)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, action)
+}
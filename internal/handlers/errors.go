@@ -0,0 +1,13 @@
+package handlers
+
+import (
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// invalidRequest fails the request with a VALIDATION_FAILED error for input the handler
+// itself rejects, such as a malformed body or path parameter
+func invalidRequest(c *gin.Context, message string) {
+	c.Error(services.NewError(services.CodeValidationFailed, message))
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"stocky/internal/models"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type FeeHandler struct {
+	feeService *services.FeeService
+	logger     *logrus.Logger
+}
+
+func NewFeeHandler(feeService *services.FeeService, logger *logrus.Logger) *FeeHandler {
+	return &FeeHandler{
+		feeService: feeService,
+		logger:     logger,
+	}
+}
+
+// CreateFeeScheduleRequest represents the request payload for recording a fee schedule.
+// Rates are fractions: 0.0005 is 0.05%.
+type CreateFeeScheduleRequest struct {
+	Exchange      string `json:"exchange" binding:"required"`       // NSE, BSE
+	EffectiveFrom string `json:"effective_from" binding:"required"` // YYYY-MM-DD
+	BrokerageRate string `json:"brokerage_rate" binding:"required"`
+	BrokerageMin  string `json:"brokerage_min"` // Defaults to 0
+	BrokerageMax  string `json:"brokerage_max"` // Optional cap
+	STTRate       string `json:"stt_rate" binding:"required"`
+	GSTRate       string `json:"gst_rate" binding:"required"`
+	OtherFeesFlat string `json:"other_fees_flat"` // Defaults to 0
+	Description   string `json:"description"`
+}
+
+// CreateFeeSchedule handles POST /admin/fee-schedules
+func (h *FeeHandler) CreateFeeSchedule(c *gin.Context) {
+	var req CreateFeeScheduleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	schedule, err := h.feeService.CreateFeeSchedule(c.Request.Context(), models.FeeSchedule{
+		Exchange:      req.Exchange,
+		EffectiveFrom: req.EffectiveFrom,
+		BrokerageRate: req.BrokerageRate,
+		BrokerageMin:  req.BrokerageMin,
+		BrokerageMax:  req.BrokerageMax,
+		STTRate:       req.STTRate,
+		GSTRate:       req.GSTRate,
+		OtherFeesFlat: req.OtherFeesFlat,
+		Description:   req.Description,
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, schedule)
+}
+
+// ListFeeSchedules handles GET /admin/fee-schedules?exchange=NSE
+func (h *FeeHandler) ListFeeSchedules(c *gin.Context) {
+	schedules, err := h.feeService.ListFeeSchedules(c.Request.Context(), c.Query("exchange"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, schedules)
+}
@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"net/http"
+	"stocky/internal/models"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type InstrumentHandler struct {
+	instrumentService *services.InstrumentService
+	logger            *logrus.Logger
+}
+
+func NewInstrumentHandler(instrumentService *services.InstrumentService, logger *logrus.Logger) *InstrumentHandler {
+	return &InstrumentHandler{
+		instrumentService: instrumentService,
+		logger:            logger,
+	}
+}
+
+// InstrumentRequest represents the request payload for creating or updating an instrument
+type InstrumentRequest struct {
+	StockSymbol string `json:"stock_symbol"` // Taken from the path on update
+	ISIN        string `json:"isin"`
+	Exchange    string `json:"exchange"` // NSE, BSE
+	CompanyName string `json:"company_name"`
+	Sector      string `json:"sector"`
+	FaceValue   string `json:"face_value"`
+	TickSize    string `json:"tick_size"`
+	Status      string `json:"status"` // Create only; defaults to ACTIVE
+}
+
+// Instrument converts the request for InstrumentService
+func (req *InstrumentRequest) Instrument() models.Instrument {
+	return models.Instrument{
+		StockSymbol: req.StockSymbol,
+		ISIN:        req.ISIN,
+		Exchange:    req.Exchange,
+		CompanyName: req.CompanyName,
+		Sector:      req.Sector,
+		FaceValue:   req.FaceValue,
+		TickSize:    req.TickSize,
+		Status:      req.Status,
+	}
+}
+
+// SetInstrumentStatusRequest represents the request payload for changing an instrument's status
+type SetInstrumentStatusRequest struct {
+	Status        string `json:"status" binding:"required"` // ACTIVE, SUSPENDED, DELISTED
+	ValuationRule string `json:"valuation_rule"`            // CARRY_FORWARD (default), WRITE_OFF
+	Reason        string `json:"reason"`
+}
+
+// ListInstruments handles GET /admin/instruments?status=ACTIVE&exchange=NSE
+func (h *InstrumentHandler) ListInstruments(c *gin.Context) {
+	instruments, err := h.instrumentService.ListInstruments(c.Request.Context(), c.Query("status"), c.Query("exchange"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, instruments)
+}
+
+// GetInstrument handles GET /admin/instruments/:symbol
+func (h *InstrumentHandler) GetInstrument(c *gin.Context) {
+	instrument, err := h.instrumentService.GetInstrument(c.Request.Context(), c.Param("symbol"))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, instrument)
+}
+
+// CreateInstrument handles POST /admin/instruments
+func (h *InstrumentHandler) CreateInstrument(c *gin.Context) {
+	var req InstrumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	instrument, err := h.instrumentService.CreateInstrument(c.Request.Context(), req.Instrument())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, instrument)
+}
+
+// UpdateInstrument handles PUT /admin/instruments/:symbol
+func (h *InstrumentHandler) UpdateInstrument(c *gin.Context) {
+	var req InstrumentRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+	req.StockSymbol = c.Param("symbol")
+
+	instrument, err := h.instrumentService.UpdateInstrument(c.Request.Context(), req.Instrument())
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, instrument)
+}
+
+// DeleteInstrument handles DELETE /admin/instruments/:symbol
+func (h *InstrumentHandler) DeleteInstrument(c *gin.Context) {
+	if err := h.instrumentService.DeleteInstrument(c.Request.Context(), c.Param("symbol")); err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// SetInstrumentStatus handles PUT /admin/instruments/:symbol/status
+func (h *InstrumentHandler) SetInstrumentStatus(c *gin.Context) {
+	var req SetInstrumentStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	instrument, err := h.instrumentService.SetStatus(c.Request.Context(), c.Param("symbol"), req.Status, req.ValuationRule, req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, instrument)
+}
@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"net/http"
+	"stocky/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerHandler struct {
+	ledgerService *services.LedgerService
+	logger        *logrus.Logger
+}
+
+func NewLedgerHandler(ledgerService *services.LedgerService, logger *logrus.Logger) *LedgerHandler {
+	return &LedgerHandler{
+		ledgerService: ledgerService,
+		logger:        logger,
+	}
+}
+
+// GetTrialBalance handles GET /admin/trial-balance?from=YYYY-MM-DD&to=YYYY-MM-DD
+// Both bounds are optional: from defaults to the start of the current month, to defaults to today.
+func (h *LedgerHandler) GetTrialBalance(c *gin.Context) {
+	now := time.Now().In(h.ledgerService.Location())
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+	to := now
+
+	if v := c.Query("from"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			invalidRequest(c, "invalid from date, use YYYY-MM-DD")
+			return
+		}
+		from = parsed
+	}
+	if v := c.Query("to"); v != "" {
+		parsed, err := time.Parse("2006-01-02", v)
+		if err != nil {
+			invalidRequest(c, "invalid to date, use YYYY-MM-DD")
+			return
+		}
+		to = parsed
+	}
+	if to.Before(from) {
+		invalidRequest(c, "to must not be before from")
+		return
+	}
+
+	report, err := h.ledgerService.GetTrialBalance(c.Request.Context(), from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -1,8 +1,10 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"stocky/internal/services"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -20,57 +22,113 @@ func NewPortfolioHandler(portfolioService *services.PortfolioService, logger *lo
 	}
 }
 
-// GetHistoricalINR handles GET /historical-inr/:userId
+// GetHistoricalINR handles GET /historical-inr/:userId?tz=
 func (h *PortfolioHandler) GetHistoricalINR(c *gin.Context) {
 	userID := c.Param("userId")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		invalidRequest(c, "user_id is required")
+		return
+	}
+	loc, ok := requestLocation(c)
+	if !ok {
 		return
 	}
 
-	historical, err := h.portfolioService.GetHistoricalINR(userID)
+	historical, err := h.portfolioService.GetHistoricalINR(c.Request.Context(), userID, loc)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get historical INR")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get historical INR"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, historical)
 }
 
-// GetStats handles GET /stats/:userId
+// GetStats handles GET /stats/:userId?tz=
 func (h *PortfolioHandler) GetStats(c *gin.Context) {
 	userID := c.Param("userId")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		invalidRequest(c, "user_id is required")
+		return
+	}
+	loc, ok := requestLocation(c)
+	if !ok {
 		return
 	}
 
-	stats, err := h.portfolioService.GetStats(userID)
+	stats, err := h.portfolioService.GetStats(c.Request.Context(), userID, loc)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get stats")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get stats"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, stats)
 }
 
-// GetPortfolio handles GET /portfolio/:userId (Bonus endpoint)
+// GetPortfolio handles GET /portfolio/:userId?tz= (Bonus endpoint)
 func (h *PortfolioHandler) GetPortfolio(c *gin.Context) {
 	userID := c.Param("userId")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		invalidRequest(c, "user_id is required")
+		return
+	}
+	loc, ok := requestLocation(c)
+	if !ok {
 		return
 	}
 
-	portfolio, err := h.portfolioService.GetPortfolio(userID)
+	portfolio, err := h.portfolioService.GetPortfolio(c.Request.Context(), userID, loc)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get portfolio")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get portfolio"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, portfolio)
 }
 
+// maxBackfillDays bounds a backfill run over HTTP, which rewrites every user's snapshots
+// for each day while the request waits; longer ranges go through the CLI
+const maxBackfillDays = 31
+
+// BackfillSnapshotsRequest represents the payload for regenerating portfolio snapshots
+type BackfillSnapshotsRequest struct {
+	UserID string `json:"user_id"`                 // Optional, all rewarded users if empty
+	From   string `json:"from" binding:"required"` // YYYY-MM-DD
+	To     string `json:"to" binding:"required"`   // YYYY-MM-DD, before today
+}
+
+// BackfillSnapshots handles POST /admin/snapshots/backfill
+func (h *PortfolioHandler) BackfillSnapshots(c *gin.Context) {
+	var req BackfillSnapshotsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	from, err := time.Parse("2006-01-02", req.From)
+	if err != nil {
+		invalidRequest(c, "invalid from format, use YYYY-MM-DD")
+		return
+	}
+	to, err := time.Parse("2006-01-02", req.To)
+	if err != nil {
+		invalidRequest(c, "invalid to format, use YYYY-MM-DD")
+		return
+	}
+	if to.Sub(from) >= maxBackfillDays*24*time.Hour {
+		invalidRequest(c, fmt.Sprintf("range exceeds %d days, use the backfill-snapshots command", maxBackfillDays))
+		return
+	}
+
+	var userIDs []string
+	if req.UserID != "" {
+		userIDs = []string{req.UserID}
+	}
+
+	result, err := h.portfolioService.BackfillSnapshots(c.Request.Context(), userIDs, from, to)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errBatchTooLarge = errors.New("batch too large")
+
+// CreateRewardBatch handles POST /rewards/batch?mode=atomic|best_effort
+// The body is a JSON array of CreateRewardRequest objects, or the same objects as NDJSON.
+func (h *RewardHandler) CreateRewardBatch(c *gin.Context) {
+	mode, err := services.ParseBatchMode(c.DefaultQuery("mode", h.batchMode))
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	requests, err := decodeRewardBatch(c.Request.Body, h.batchMax)
+	if errors.Is(err, errBatchTooLarge) {
+		c.Error(services.NewError(services.CodePayloadTooLarge, fmt.Sprintf("batch exceeds %d rewards", h.batchMax)))
+		return
+	}
+	if err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+	if len(requests) == 0 {
+		invalidRequest(c, "batch is empty")
+		return
+	}
+
+	rewards := make([]services.BatchReward, len(requests))
+	for i := range requests {
+		rewards[i] = requests[i].BatchReward()
+	}
+
+	batch, err := h.rewardService.CreateRewardBatch(c.Request.Context(), rewards, mode, false)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	// A rolled back atomic batch wrote nothing; the results say which item caused it
+	if batch.RolledBack {
+		c.JSON(http.StatusUnprocessableEntity, batch)
+		return
+	}
+	c.JSON(http.StatusOK, batch)
+}
+
+// BatchReward converts the request for RewardService.CreateRewardBatch, recording a
+// malformed reward_timestamp, with the request's other invalid fields, in Invalid
+func (req *CreateRewardRequest) BatchReward() services.BatchReward {
+	eventID, rewardTimestamp, err := req.parse()
+	return services.BatchReward{
+		UserID:          req.UserID,
+		StockSymbol:     req.StockSymbol,
+		Quantity:        req.Quantity,
+		Exchange:        req.Exchange,
+		EventID:         eventID,
+		RewardTimestamp: rewardTimestamp,
+		Invalid:         err,
+	}
+}
+
+// decodeRewardBatch reads a JSON array or NDJSON stream of rewards, refusing more than max
+func decodeRewardBatch(body io.Reader, max int) ([]CreateRewardRequest, error) {
+	r := bufio.NewReader(body)
+	first, err := firstNonSpace(r)
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(r)
+	var requests []CreateRewardRequest
+	next := func() error {
+		if len(requests) == max {
+			return errBatchTooLarge
+		}
+		var req CreateRewardRequest
+		if err := dec.Decode(&req); err != nil {
+			return fmt.Errorf("invalid reward at index %d: %v", len(requests), err)
+		}
+		requests = append(requests, req)
+		return nil
+	}
+
+	// An array is unwrapped; otherwise the body is NDJSON, one object per line
+	array := first == '['
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, err
+		}
+	}
+	for dec.More() {
+		if err := next(); err != nil {
+			return nil, err
+		}
+	}
+	if array {
+		if _, err := dec.Token(); err != nil {
+			return nil, fmt.Errorf("invalid batch: %v", err)
+		}
+	}
+	return requests, nil
+}
+
+// firstNonSpace skips whitespace and returns the next byte without consuming it
+func firstNonSpace(r *bufio.Reader) (byte, error) {
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		switch b {
+		case ' ', '\t', '\r', '\n':
+			continue
+		}
+		return b, r.UnreadByte()
+	}
+}
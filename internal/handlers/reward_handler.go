@@ -1,6 +1,8 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"stocky/internal/services"
 	"time"
@@ -13,87 +15,199 @@ import (
 type RewardHandler struct {
 	rewardService *services.RewardService
 	logger        *logrus.Logger
+	batchMax      int    // Most rewards accepted in one batch
+	batchMode     string // Batch mode used when the request does not name one
 }
 
-func NewRewardHandler(rewardService *services.RewardService, logger *logrus.Logger) *RewardHandler {
+func NewRewardHandler(rewardService *services.RewardService, batchMax int, batchMode string, logger *logrus.Logger) *RewardHandler {
 	return &RewardHandler{
 		rewardService: rewardService,
 		logger:        logger,
+		batchMax:      batchMax,
+		batchMode:     batchMode,
 	}
 }
 
-// CreateRewardRequest represents the request payload for creating a reward
+// CreateRewardRequest represents the request payload for creating a reward.
+// Fields are validated by RewardService, which reports every invalid field at once.
 type CreateRewardRequest struct {
-	UserID         string `json:"user_id" binding:"required"`
-	StockSymbol    string `json:"stock_symbol" binding:"required"`
-	Quantity       string `json:"quantity" binding:"required"`
+	UserID          string `json:"user_id"`
+	StockSymbol     string `json:"stock_symbol"`
+	Quantity        string `json:"quantity"`
 	RewardTimestamp string `json:"reward_timestamp"` // Optional, defaults to now
-	EventID        string `json:"event_id"`          // Optional, auto-generated if not provided
+	EventID         string `json:"event_id"`         // Optional, auto-generated if not provided
+	Exchange        string `json:"exchange"`         // Optional, defaults to NSE
+}
+
+// parse defaults event_id and parses reward_timestamp, which is zero when omitted.
+// A malformed timestamp is reported together with the request's other invalid fields.
+func (req *CreateRewardRequest) parse() (string, time.Time, error) {
+	eventID := req.EventID
+	if eventID == "" {
+		eventID = uuid.New().String()
+	}
+	if req.RewardTimestamp == "" {
+		return eventID, time.Time{}, nil
+	}
+
+	rewardTimestamp, err := time.Parse(time.RFC3339, req.RewardTimestamp)
+	if err != nil {
+		var v services.ValidationError
+		services.CheckRewardFields(&v, req.UserID, req.StockSymbol, req.Quantity, req.Exchange, eventID)
+		v.Add("reward_timestamp", "must be an RFC3339 timestamp")
+		return eventID, time.Time{}, &v
+	}
+	return eventID, rewardTimestamp, nil
+}
+
+// PreviewRewardRequest represents the request payload for previewing a reward's fees
+type PreviewRewardRequest struct {
+	StockSymbol     string `json:"stock_symbol" binding:"required"`
+	Quantity        string `json:"quantity" binding:"required"`
+	RewardTimestamp string `json:"reward_timestamp"` // Optional, defaults to now
+	Exchange        string `json:"exchange"`         // Optional, defaults to NSE
 }
 
 // CreateReward handles POST /reward
 func (h *RewardHandler) CreateReward(c *gin.Context) {
 	var req CreateRewardRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		invalidRequest(c, err.Error())
 		return
 	}
 
-	// Parse timestamp or use current time
-	var rewardTimestamp time.Time
-	if req.RewardTimestamp != "" {
-		var err error
-		rewardTimestamp, err = time.Parse(time.RFC3339, req.RewardTimestamp)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid reward_timestamp format, use RFC3339"})
-			return
-		}
-	} else {
-		rewardTimestamp = time.Now()
-	}
-
-	// Generate event_id if not provided
-	eventID := req.EventID
-	if eventID == "" {
-		eventID = uuid.New().String()
+	// The service uses the current time when the timestamp is omitted
+	eventID, rewardTimestamp, err := req.parse()
+	if err != nil {
+		c.Error(err)
+		return
 	}
 
 	// Create reward
 	reward, err := h.rewardService.CreateReward(
+		c.Request.Context(),
 		req.UserID,
 		req.StockSymbol,
 		req.Quantity,
+		req.Exchange,
 		eventID,
 		rewardTimestamp,
 	)
 	if err != nil {
-		if err == services.ErrDuplicateEvent {
-			c.JSON(http.StatusConflict, gin.H{"error": "duplicate reward event"})
+		// A replay gets the reward recorded the first time
+		var duplicate *services.DuplicateEventError
+		if errors.As(err, &duplicate) {
+			c.JSON(http.StatusOK, duplicate.Reward)
 			return
 		}
-		h.logger.WithError(err).Error("Failed to create reward")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to create reward"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusCreated, reward)
 }
 
-// GetTodayStocks handles GET /today-stocks/:userId
+// PreviewReward handles POST /reward/preview
+func (h *RewardHandler) PreviewReward(c *gin.Context) {
+	var req PreviewRewardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	at := time.Now()
+	if req.RewardTimestamp != "" {
+		var err error
+		at, err = time.Parse(time.RFC3339, req.RewardTimestamp)
+		if err != nil {
+			invalidRequest(c, "invalid reward_timestamp format, use RFC3339")
+			return
+		}
+	}
+
+	preview, err := h.rewardService.PreviewReward(c.Request.Context(), req.StockSymbol, req.Quantity, req.Exchange, at)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusOK, preview)
+}
+
+// ReverseRewardRequest represents the optional payload for reversing a reward
+type ReverseRewardRequest struct {
+	Reason string `json:"reason"`
+}
+
+// AdjustRewardRequest represents the payload for partially reducing a reward
+type AdjustRewardRequest struct {
+	Quantity string `json:"quantity" binding:"required"` // Quantity to remove from the reward
+	Reason   string `json:"reason"`
+}
+
+// ReverseReward handles POST /reward/:id/reverse
+func (h *RewardHandler) ReverseReward(c *gin.Context) {
+	rewardID := c.Param("id")
+	if _, err := uuid.Parse(rewardID); err != nil {
+		invalidRequest(c, "invalid reward id")
+		return
+	}
+
+	var req ReverseRewardRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	adjustment, err := h.rewardService.ReverseReward(c.Request.Context(), rewardID, req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, adjustment)
+}
+
+// AdjustReward handles POST /reward/:id/adjust
+func (h *RewardHandler) AdjustReward(c *gin.Context) {
+	rewardID := c.Param("id")
+	if _, err := uuid.Parse(rewardID); err != nil {
+		invalidRequest(c, "invalid reward id")
+		return
+	}
+
+	var req AdjustRewardRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		invalidRequest(c, err.Error())
+		return
+	}
+
+	adjustment, err := h.rewardService.AdjustReward(c.Request.Context(), rewardID, req.Quantity, req.Reason)
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, adjustment)
+}
+
+// GetTodayStocks handles GET /today-stocks/:userId?tz=
 func (h *RewardHandler) GetTodayStocks(c *gin.Context) {
 	userID := c.Param("userId")
 	if userID == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "user_id is required"})
+		invalidRequest(c, "user_id is required")
+		return
+	}
+	loc, ok := requestLocation(c)
+	if !ok {
 		return
 	}
 
-	stocks, err := h.rewardService.GetTodayStocks(userID)
+	stocks, err := h.rewardService.GetTodayStocks(c.Request.Context(), userID, loc)
 	if err != nil {
-		h.logger.WithError(err).Error("Failed to get today's stocks")
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get today's stocks"})
+		c.Error(err)
 		return
 	}
 
 	c.JSON(http.StatusOK, stocks)
 }
-
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"stocky/internal/services"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestLocation returns the timezone named by the optional ?tz= query parameter, or nil
+// for the business timezone. It fails the request itself and returns false when tz is unknown.
+func requestLocation(c *gin.Context) (*time.Location, bool) {
+	name := c.Query("tz")
+	if name == "" {
+		return nil, true
+	}
+	loc, err := services.LoadLocation(name)
+	if err != nil {
+		invalidRequest(c, "invalid tz, use an IANA timezone such as Asia/Kolkata")
+		return nil, false
+	}
+	return loc, true
+}
@@ -0,0 +1,47 @@
+package idempotency
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+)
+
+// claimTimeout is how long an unfinished request holds its key. A claim older than
+// this belongs to a request that died without answering, so the key can be used again.
+const claimTimeout = 5 * time.Minute
+
+// Response is a stored response, replayed verbatim for retries
+type Response struct {
+	Status      int
+	ContentType string
+	Body        []byte
+}
+
+// Entry is what is stored under a client's key
+type Entry struct {
+	RequestHash string
+	Response    *Response // nil while the first request is still running
+}
+
+// Store keeps one entry per client and key until it expires
+type Store interface {
+	// Claim takes key for a request with requestHash. It returns nil when the key was
+	// free, or the live entry that already holds it.
+	Claim(client, key, requestHash string) (*Entry, error)
+	// Complete stores the response to key if it is still claimed for requestHash. A request
+	// that outlived claimTimeout may have lost its key to another; its response is dropped.
+	Complete(client, key, requestHash string, response Response) error
+	// Release frees key if it is still claimed for requestHash and has no response
+	Release(client, key, requestHash string) error
+}
+
+// RequestHash fingerprints a request so a key reused for a different request is noticed
+func RequestHash(method, uri string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(uri))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,96 @@
+package idempotency
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps entries in process memory. Keys are only honoured by the
+// instance that saw the first request, and are lost on restart.
+type MemoryStore struct {
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	ttl       time.Duration
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	Entry
+	createdAt time.Time
+}
+
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	return &MemoryStore{
+		entries: make(map[string]*memoryEntry),
+		ttl:     ttl,
+		now:     time.Now,
+	}
+}
+
+// Claim takes key for a request with requestHash unless a live entry holds it
+func (s *MemoryStore) Claim(client, key, requestHash string) (*Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.sweep(now)
+
+	id := client + "\x00" + key
+	if existing, ok := s.entries[id]; ok && s.live(existing, now) {
+		entry := existing.Entry
+		return &entry, nil
+	}
+
+	s.entries[id] = &memoryEntry{Entry: Entry{RequestHash: requestHash}, createdAt: now}
+	return nil, nil
+}
+
+// Complete stores the response to a key still claimed for requestHash
+func (s *MemoryStore) Complete(client, key, requestHash string, response Response) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if entry, ok := s.entries[client+"\x00"+key]; ok && entry.claimedBy(requestHash) {
+		entry.Response = &response
+	}
+	return nil
+}
+
+// Release frees a key still claimed for requestHash that has no response yet
+func (s *MemoryStore) Release(client, key, requestHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := client + "\x00" + key
+	if entry, ok := s.entries[id]; ok && entry.claimedBy(requestHash) {
+		delete(s.entries, id)
+	}
+	return nil
+}
+
+// claimedBy reports whether entry is an unanswered claim for requestHash
+func (e *memoryEntry) claimedBy(requestHash string) bool {
+	return e.Response == nil && e.RequestHash == requestHash
+}
+
+// live reports whether entry still holds its key
+func (s *MemoryStore) live(entry *memoryEntry, now time.Time) bool {
+	if entry.Response == nil {
+		return now.Sub(entry.createdAt) < claimTimeout
+	}
+	return now.Sub(entry.createdAt) < s.ttl
+}
+
+// sweep drops entries that no longer hold their key, at most once a minute
+func (s *MemoryStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < time.Minute {
+		return
+	}
+	s.lastSweep = now
+	for id, entry := range s.entries {
+		if !s.live(entry, now) {
+			delete(s.entries, id)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package idempotency
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreCompleteRequiresClaim(t *testing.T) {
+	now := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(24 * time.Hour)
+	store.now = func() time.Time { return now }
+
+	if existing, err := store.Claim("c1", "k1", "first"); existing != nil || err != nil {
+		t.Fatalf("first claim = %+v, %v", existing, err)
+	}
+	// The first request outlives its claim and a different request takes the key over
+	now = now.Add(claimTimeout)
+	if existing, err := store.Claim("c1", "k1", "second"); existing != nil || err != nil {
+		t.Fatalf("takeover claim = %+v, %v", existing, err)
+	}
+
+	store.Complete("c1", "k1", "first", Response{Status: 201, Body: []byte("first")})
+	store.Release("c1", "k1", "first")
+	existing, _ := store.Claim("c1", "k1", "third")
+	if existing == nil || existing.RequestHash != "second" || existing.Response != nil {
+		t.Fatalf("entry after the stale request finished = %+v, want the second claim untouched", existing)
+	}
+
+	store.Complete("c1", "k1", "second", Response{Status: 201, Body: []byte("second")})
+	existing, _ = store.Claim("c1", "k1", "second")
+	if existing == nil || existing.Response == nil || string(existing.Response.Body) != "second" {
+		t.Fatalf("entry = %+v, want the second response stored", existing)
+	}
+
+	// A stored response is final
+	store.Complete("c1", "k1", "second", Response{Status: 500})
+	store.Release("c1", "k1", "second")
+	if existing, _ = store.Claim("c1", "k1", "second"); existing == nil || existing.Response.Status != 201 {
+		t.Errorf("entry = %+v, want the stored 201 kept", existing)
+	}
+}
@@ -0,0 +1,102 @@
+package idempotency
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+	"time"
+)
+
+// PostgresStore keeps entries in the idempotency_keys table so a retry is recognised
+// by whichever instance receives it. Claims are a single atomic upsert on the
+// database clock, so two instances racing for the same key cannot both win.
+type PostgresStore struct {
+	db  *sql.DB
+	ttl time.Duration
+
+	mu        sync.Mutex
+	lastPrune time.Time
+}
+
+func NewPostgresStore(db *sql.DB, ttl time.Duration) *PostgresStore {
+	return &PostgresStore{db: db, ttl: ttl}
+}
+
+// Claim takes key for a request with requestHash unless a live entry holds it.
+// Expired entries and abandoned claims are taken over in place.
+func (s *PostgresStore) Claim(client, key, requestHash string) (*Entry, error) {
+	s.prune()
+
+	var claimed bool
+	err := s.db.QueryRow(`
+		INSERT INTO idempotency_keys AS k (client, idempotency_key, request_hash, created_at)
+		VALUES ($1, $2, $3, now())
+		ON CONFLICT (client, idempotency_key) DO UPDATE
+		SET request_hash = EXCLUDED.request_hash,
+		    status_code = NULL,
+		    content_type = NULL,
+		    response_body = NULL,
+		    created_at = EXCLUDED.created_at,
+		    completed_at = NULL
+		WHERE (k.status_code IS NULL AND k.created_at < now() - $4::DOUBLE PRECISION * INTERVAL '1 second')
+		   OR k.created_at < now() - $5::DOUBLE PRECISION * INTERVAL '1 second'
+		RETURNING TRUE
+	`, client, key, requestHash, claimTimeout.Seconds(), s.ttl.Seconds()).Scan(&claimed)
+	if err == nil {
+		return nil, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, err
+	}
+
+	// The key is held; report by whom
+	var entry Entry
+	var status sql.NullInt64
+	var contentType sql.NullString
+	var body []byte
+	err = s.db.QueryRow(`
+		SELECT request_hash, status_code, content_type, response_body
+		FROM idempotency_keys
+		WHERE client = $1 AND idempotency_key = $2
+	`, client, key).Scan(&entry.RequestHash, &status, &contentType, &body)
+	if err != nil {
+		return nil, err
+	}
+	if status.Valid {
+		entry.Response = &Response{Status: int(status.Int64), ContentType: contentType.String, Body: body}
+	}
+	return &entry, nil
+}
+
+// Complete stores the response to a key still claimed for requestHash
+func (s *PostgresStore) Complete(client, key, requestHash string, response Response) error {
+	_, err := s.db.Exec(`
+		UPDATE idempotency_keys
+		SET status_code = $4, content_type = $5, response_body = $6, completed_at = now()
+		WHERE client = $1 AND idempotency_key = $2 AND request_hash = $3 AND status_code IS NULL
+	`, client, key, requestHash, response.Status, response.ContentType, response.Body)
+	return err
+}
+
+// Release frees a key still claimed for requestHash that has no response yet
+func (s *PostgresStore) Release(client, key, requestHash string) error {
+	_, err := s.db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE client = $1 AND idempotency_key = $2 AND request_hash = $3 AND status_code IS NULL
+	`, client, key, requestHash)
+	return err
+}
+
+// prune deletes expired entries, at most once every ten minutes.
+// Errors are ignored; expired rows only cost space.
+func (s *PostgresStore) prune() {
+	s.mu.Lock()
+	if time.Since(s.lastPrune) < 10*time.Minute {
+		s.mu.Unlock()
+		return
+	}
+	s.lastPrune = time.Now()
+	s.mu.Unlock()
+
+	go s.db.Exec(`DELETE FROM idempotency_keys WHERE created_at < now() - $1::DOUBLE PRECISION * INTERVAL '1 second'`, s.ttl.Seconds())
+}
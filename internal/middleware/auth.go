@@ -0,0 +1,86 @@
+package middleware
+
+import (
+	"errors"
+	"stocky/internal/auth"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const principalKey = "principal"
+
+// Authenticate rejects requests without valid credentials and stores the caller
+// on the context for RequireRole, RequireSelfOrRole and handlers
+func Authenticate(authenticator *auth.Authenticator, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, err := authenticator.Authenticate(c.Request)
+		if err != nil {
+			logger.WithFields(logrus.Fields{
+				"path":   c.FullPath(),
+				"reason": err.Error(),
+			}).Warn("Authentication failed")
+
+			c.Header("WWW-Authenticate", `Bearer realm="stocky"`)
+			message := "invalid credentials"
+			if errors.Is(err, auth.ErrMissingCredentials) {
+				message = "authentication required"
+			}
+			abortWithError(c, services.NewError(services.CodeUnauthorized, message))
+			return
+		}
+
+		c.Set(principalKey, principal)
+		c.Next()
+	}
+}
+
+// RequireRole allows the request only if the caller holds one of roles
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFrom(c)
+		if principal == nil || !principal.HasRole(roles...) {
+			abortWithError(c, services.NewError(services.CodeForbidden, "forbidden"))
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireSelfOrRole allows users to access only the user_id in the given path
+// parameter, while callers holding one of roles may access any user
+func RequireSelfOrRole(param string, roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := PrincipalFrom(c)
+		if principal != nil {
+			if principal.HasRole(roles...) {
+				c.Next()
+				return
+			}
+			if principal.HasRole(auth.RoleUser) && principal.Subject == c.Param(param) {
+				c.Next()
+				return
+			}
+		}
+		abortWithError(c, services.NewError(services.CodeForbidden, "forbidden"))
+	}
+}
+
+// PrincipalFrom returns the authenticated caller, or nil outside Authenticate
+func PrincipalFrom(c *gin.Context) *auth.Principal {
+	if v, ok := c.Get(principalKey); ok {
+		if principal, ok := v.(*auth.Principal); ok {
+			return principal
+		}
+	}
+	return nil
+}
+
+// clientKey identifies the caller by API key name or JWT subject, falling back to client IP
+func clientKey(c *gin.Context) string {
+	if principal := PrincipalFrom(c); principal != nil {
+		return principal.Method + ":" + principal.Subject
+	}
+	return "ip:" + c.ClientIP()
+}
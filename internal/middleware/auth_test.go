@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stocky/internal/auth"
+	"stocky/internal/services"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func newAuthRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	keys, err := auth.ParseAPIKeys("user123:k-self:user,user456:k-other:user,ops:k-admin:admin,books:k-finance:finance,engine:k-issuer:issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := gin.New()
+	router.Use(RequestID(), Errors(logger))
+	api := router.Group("/", Authenticate(auth.NewAuthenticator(keys, nil), logger))
+	api.GET("/users/:userId/portfolio", RequireSelfOrRole("userId", auth.RoleAdmin, auth.RoleFinance), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	api.POST("/reward", RequireRole(auth.RoleIssuer, auth.RoleAdmin), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestAuthorization(t *testing.T) {
+	router := newAuthRouter(t)
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		apiKey   string
+		wantCode int
+		wantErr  services.Code
+	}{
+		{"no credentials", http.MethodGet, "/users/user123/portfolio", "", http.StatusUnauthorized, services.CodeUnauthorized},
+		{"unknown key", http.MethodGet, "/users/user123/portfolio", "k-guess", http.StatusUnauthorized, services.CodeUnauthorized},
+		{"self", http.MethodGet, "/users/user123/portfolio", "k-self", http.StatusOK, ""},
+		{"another user", http.MethodGet, "/users/user123/portfolio", "k-other", http.StatusForbidden, services.CodeForbidden},
+		{"admin", http.MethodGet, "/users/user123/portfolio", "k-admin", http.StatusOK, ""},
+		{"finance", http.MethodGet, "/users/user123/portfolio", "k-finance", http.StatusOK, ""},
+		{"issuer", http.MethodGet, "/users/user123/portfolio", "k-issuer", http.StatusForbidden, services.CodeForbidden},
+		{"issuer rewards", http.MethodPost, "/reward", "k-issuer", http.StatusOK, ""},
+		{"user rewards", http.MethodPost, "/reward", "k-self", http.StatusForbidden, services.CodeForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("X-API-Key", tt.apiKey)
+			}
+			status, body := serve(t, router, req)
+			if status != tt.wantCode || body.Code != tt.wantErr {
+				t.Errorf("got %d %q, want %d %q", status, body.Code, tt.wantCode, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"net/http"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// StatusClientClosedRequest answers a request whose client went away; nobody reads it,
+// but it keeps such requests apart from server errors in logs and idempotency keys
+const StatusClientClosedRequest = 499
+
+// ErrorResponse is the body of every error answered by the API
+type ErrorResponse struct {
+	Code      services.Code `json:"code"`
+	Message   string        `json:"message"`
+	Details   interface{}   `json:"details"`
+	RequestID string        `json:"request_id"`
+}
+
+// errorStatuses maps each error code to its HTTP status; unlisted codes are 500
+var errorStatuses = map[services.Code]int{
+	services.CodeValidationFailed:     http.StatusBadRequest,
+	services.CodeUnauthorized:         http.StatusUnauthorized,
+	services.CodeForbidden:            http.StatusForbidden,
+	services.CodeNotFound:             http.StatusNotFound,
+	services.CodeConflict:             http.StatusConflict,
+	services.CodePayloadTooLarge:      http.StatusRequestEntityTooLarge,
+	services.CodeDuplicateEvent:       http.StatusUnprocessableEntity,
+	services.CodeIdempotencyKeyReused: http.StatusUnprocessableEntity,
+	services.CodeUnknownSymbol:        http.StatusUnprocessableEntity,
+	services.CodeNoFeeSchedule:        http.StatusUnprocessableEntity,
+	services.CodeRateLimited:          http.StatusTooManyRequests,
+	services.CodePriceUnavailable:     http.StatusServiceUnavailable,
+	services.CodeTimeout:              http.StatusGatewayTimeout,
+	services.CodeCanceled:             StatusClientClosedRequest,
+}
+
+// Errors answers requests that handlers or middleware failed with c.Error, writing
+// the last error as an ErrorResponse. It must run after RequestID and before
+// everything that can fail a request.
+func Errors(logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+		writeError(c, logger)
+	}
+}
+
+// writeError classifies the request's last error with services.AsError and writes it with
+// the status of its code, unless there is no error or a response was already written.
+// Internal errors are logged with their cause, which clients never see.
+func writeError(c *gin.Context, logger *logrus.Logger) {
+	if len(c.Errors) == 0 || c.Writer.Written() {
+		return
+	}
+
+	cause := c.Errors.Last().Err
+	err := services.AsError(cause)
+	status, ok := errorStatuses[err.Code]
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+
+	fields := logrus.Fields{
+		"request_id": RequestIDFrom(c),
+		"method":     c.Request.Method,
+		"path":       c.FullPath(),
+		"code":       err.Code,
+	}
+	if status >= http.StatusInternalServerError {
+		logger.WithFields(fields).WithError(cause).Error("Request failed")
+	} else {
+		logger.WithFields(fields).Debug(err.Message)
+	}
+
+	c.JSON(status, ErrorResponse{
+		Code:      err.Code,
+		Message:   err.Message,
+		Details:   err.Details,
+		RequestID: RequestIDFrom(c),
+	})
+}
+
+// abortWithError fails the request with err, which Errors writes
+func abortWithError(c *gin.Context, err error) {
+	c.Error(err)
+	c.Abort()
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"stocky/internal/idempotency"
+	"stocky/internal/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	IdempotencyKeyHeader     = "Idempotency-Key"
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+	maxIdempotencyKeyLength  = 255
+	// maxIdempotentBodySize bounds the request body buffered for hashing; a full
+	// reward batch is well under it
+	maxIdempotentBodySize = 4 << 20
+)
+
+// Idempotency answers a retried write that carries the same Idempotency-Key header
+// with the stored response of the first attempt instead of running it again. Keys are
+// scoped to the caller, so it must run after Authenticate. A key reused for a different
+// request is rejected with 422, and a retry that arrives while the first attempt is still
+// running gets 409. Requests without the header, 5xx responses and requests whose
+// client went away are not stored.
+// If the store fails the request is processed without it rather than taking the API down.
+func Idempotency(store idempotency.Store, logger *logrus.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			abortWithError(c, services.NewError(services.CodeValidationFailed, "Idempotency-Key must be at most 255 characters"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			abortWithError(c, services.NewError(services.CodePayloadTooLarge, fmt.Sprintf("request body exceeds %d bytes", tooLarge.Limit)))
+			return
+		} else if err != nil {
+			abortWithError(c, services.NewError(services.CodeValidationFailed, "failed to read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		client := clientKey(c)
+		hash := idempotency.RequestHash(c.Request.Method, c.Request.URL.RequestURI(), body)
+		existing, err := store.Claim(client, key, hash)
+		if err != nil {
+			logger.WithError(err).Error("Idempotency store unavailable, processing request without it")
+			c.Next()
+			return
+		}
+
+		if existing != nil {
+			fields := logrus.Fields{"client": client, "idempotency_key": key}
+			switch {
+			case existing.RequestHash != hash:
+				logger.WithFields(fields).Warn("Idempotency-Key reused with a different request")
+				abortWithError(c, services.NewError(services.CodeIdempotencyKeyReused, "Idempotency-Key already used for a different request"))
+			case existing.Response == nil:
+				c.Header("Retry-After", "1")
+				abortWithError(c, services.NewError(services.CodeConflict, "a request with this Idempotency-Key is still in progress"))
+			default:
+				logger.WithFields(fields).Info("Replaying stored response")
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(existing.Response.Status, existing.Response.ContentType, existing.Response.Body)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		// Write a failed request's error response now, so it is stored like any other.
+		// Timeout runs outside this middleware, so its deadline is classified here first.
+		recordContextError(c, c.Request.Context())
+		writeError(c, logger)
+
+		if status := recorder.Status(); status >= http.StatusInternalServerError || status == StatusClientClosedRequest {
+			// Failures are not final; let the client retry with the same key
+			err = store.Release(client, key, hash)
+		} else {
+			err = store.Complete(client, key, hash, idempotency.Response{
+				Status:      status,
+				ContentType: recorder.Header().Get("Content-Type"),
+				Body:        recorder.body.Bytes(),
+			})
+		}
+		if err != nil {
+			logger.WithError(err).WithField("idempotency_key", key).Error("Failed to store idempotent response")
+		}
+	}
+}
+
+// responseRecorder keeps a copy of the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stocky/internal/idempotency"
+	"stocky/internal/services"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func newIdempotencyRouter(calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := gin.New()
+	router.Use(RequestID(), Errors(logger), Idempotency(idempotency.NewMemoryStore(time.Hour), logger))
+	router.POST("/rewards", func(c *gin.Context) {
+		*calls++
+		body, _ := io.ReadAll(c.Request.Body)
+		c.JSON(http.StatusCreated, gin.H{"size": len(body)})
+	})
+	return router
+}
+
+func keyedRequest(body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/rewards", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, "key-1")
+	return req
+}
+
+func TestIdempotencyReplays(t *testing.T) {
+	calls := 0
+	router := newIdempotencyRouter(&calls)
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, keyedRequest(`{"quantity": "1"}`))
+		if w.Code != http.StatusCreated || w.Body.String() != `{"size":17}` {
+			t.Fatalf("attempt %d: got %d %s", i+1, w.Code, w.Body.String())
+		}
+		if replayed := w.Header().Get(IdempotentReplayedHeader) == "true"; replayed != (i == 1) {
+			t.Errorf("attempt %d: replayed = %v", i+1, replayed)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("handler ran %d times, want 1", calls)
+	}
+}
+
+func TestIdempotencyRejectsOversizedBody(t *testing.T) {
+	calls := 0
+	router := newIdempotencyRouter(&calls)
+
+	status, body := serve(t, router, keyedRequest(strings.Repeat("x", maxIdempotentBodySize+1)))
+	if status != http.StatusRequestEntityTooLarge || body.Code != services.CodePayloadTooLarge {
+		t.Fatalf("got %d %s, want 413 %s", status, body.Code, services.CodePayloadTooLarge)
+	}
+	if calls != 0 {
+		t.Errorf("handler ran %d times, want 0", calls)
+	}
+}
+
+func TestIdempotencyWithTimeout(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	calls := 0
+	router := gin.New()
+	router.Use(RequestID(), Errors(logger), Timeout(10*time.Millisecond, nil), Idempotency(idempotency.NewMemoryStore(time.Hour), logger))
+	router.POST("/rewards", func(c *gin.Context) {
+		calls++
+		<-c.Request.Context().Done()
+		// What lib/pq returns for a statement cancelled by the context
+		c.Error(errors.New("pq: canceling statement due to user request"))
+	})
+
+	status, body := serve(t, router, keyedRequest(`{}`))
+	if status != http.StatusGatewayTimeout || body.Code != services.CodeTimeout {
+		t.Fatalf("got %d %s, want 504 %s", status, body.Code, services.CodeTimeout)
+	}
+
+	// The timed out attempt released its key, so the retry runs again
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, body = serve(t, router, keyedRequest(`{}`).WithContext(ctx))
+	if status != StatusClientClosedRequest || body.Code != services.CodeCanceled {
+		t.Fatalf("retry got %d %s, want %d %s", status, body.Code, StatusClientClosedRequest, services.CodeCanceled)
+	}
+	if calls != 2 {
+		t.Errorf("handler ran %d times, want 2", calls)
+	}
+}
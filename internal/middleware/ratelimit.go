@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"stocky/internal/ratelimit"
+	"stocky/internal/services"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// RateLimit charges each request to the caller's bucket under policy and rejects it
+// with 429 once the bucket is empty. Callers are keyed by API key name or JWT subject,
+// falling back to client IP, so it must run after Authenticate.
+// If the limiter fails the request is let through rather than taking the API down,
+// unless the request's own deadline or cancellation is why it failed.
+func RateLimit(limiter ratelimit.Limiter, policy ratelimit.Policy, logger *logrus.Logger) gin.HandlerFunc {
+	policyHeader := fmt.Sprintf("%d;w=%d", policy.Limit, int(policy.Window.Seconds()))
+
+	return func(c *gin.Context) {
+		client := clientKey(c)
+
+		decision, err := limiter.Allow(c.Request.Context(), policy.Name+":"+client, policy)
+		if err != nil {
+			if ctxErr := c.Request.Context().Err(); ctxErr != nil {
+				abortWithError(c, services.AsError(ctxErr))
+				return
+			}
+			logger.WithError(err).WithField("policy", policy.Name).Error("Rate limiter unavailable, allowing request")
+			c.Next()
+			return
+		}
+
+		c.Header("RateLimit-Policy", policyHeader)
+		c.Header("RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		c.Header("RateLimit-Reset", strconv.Itoa(ceilSeconds(decision.Reset)))
+
+		if !decision.Allowed {
+			logger.WithFields(logrus.Fields{
+				"policy": policy.Name,
+				"client": client,
+			}).Warn("Rate limit exceeded")
+
+			c.Header("Retry-After", strconv.Itoa(ceilSeconds(decision.RetryAfter)))
+			abortWithError(c, services.NewError(services.CodeRateLimited, "rate limit exceeded"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,113 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stocky/internal/ratelimit"
+	"stocky/internal/services"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// failingLimiter stands in for a rate limit table that cannot be reached
+type failingLimiter struct{}
+
+func (failingLimiter) Allow(ctx context.Context, key string, policy ratelimit.Policy) (ratelimit.Decision, error) {
+	if err := ctx.Err(); err != nil {
+		return ratelimit.Decision{}, err
+	}
+	return ratelimit.Decision{}, errors.New("connection refused")
+}
+
+func newRateLimitRouter(limiter ratelimit.Limiter, policy ratelimit.Policy) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := gin.New()
+	router.Use(RequestID(), Errors(logger), RateLimit(limiter, policy, logger))
+	router.GET("/prices", func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	return router
+}
+
+func TestRateLimit(t *testing.T) {
+	// One token every half hour, so the wall clock cannot refill the bucket mid-test
+	policy := ratelimit.Policy{Name: "read", Limit: 2, Window: time.Hour}
+	router := newRateLimitRouter(ratelimit.NewMemoryLimiter(), policy)
+
+	tests := []struct {
+		remoteAddr string
+		wantCode   int
+		remaining  string
+		reset      string
+		retryAfter string
+	}{
+		{"10.0.0.1:1234", http.StatusOK, "1", "1800", ""},
+		{"10.0.0.1:1234", http.StatusOK, "0", "3600", ""},
+		{"10.0.0.1:1234", http.StatusTooManyRequests, "0", "3600", "1800"},
+		{"10.0.0.2:1234", http.StatusOK, "1", "1800", ""}, // Another client has its own bucket
+	}
+	for i, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/prices", nil)
+		req.RemoteAddr = tt.remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		if w.Code != tt.wantCode {
+			t.Fatalf("request %d: status %d, want %d", i, w.Code, tt.wantCode)
+		}
+		headers := map[string]string{
+			"RateLimit-Policy":    "2;w=3600",
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": tt.remaining,
+			"RateLimit-Reset":     tt.reset,
+			"Retry-After":         tt.retryAfter,
+		}
+		for name, want := range headers {
+			if got := w.Header().Get(name); got != want {
+				t.Errorf("request %d: %s = %q, want %q", i, name, got, want)
+			}
+		}
+	}
+}
+
+func TestRateLimitRejectionBody(t *testing.T) {
+	policy := ratelimit.Policy{Name: "read", Limit: 1, Window: time.Hour}
+	router := newRateLimitRouter(ratelimit.NewMemoryLimiter(), policy)
+
+	serve(t, router, httptest.NewRequest(http.MethodGet, "/prices", nil))
+	status, body := serve(t, router, httptest.NewRequest(http.MethodGet, "/prices", nil))
+	if status != http.StatusTooManyRequests || body.Code != services.CodeRateLimited {
+		t.Fatalf("got %d %s, want 429 %s", status, body.Code, services.CodeRateLimited)
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	policy := ratelimit.Policy{Name: "read", Limit: 1, Window: time.Hour}
+	router := newRateLimitRouter(failingLimiter{}, policy)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/prices", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200 when the limiter is down", w.Code)
+	}
+	if got := w.Header().Get("RateLimit-Limit"); got != "" {
+		t.Errorf("RateLimit-Limit = %q without a decision", got)
+	}
+
+	// A request that is already cancelled is not let through
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	status, body := serve(t, router, httptest.NewRequest(http.MethodGet, "/prices", nil).WithContext(ctx))
+	if status != StatusClientClosedRequest || body.Code != services.CodeCanceled {
+		t.Fatalf("got %d %s, want %d %s", status, body.Code, StatusClientClosedRequest, services.CodeCanceled)
+	}
+}
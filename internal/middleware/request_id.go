@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	RequestIDHeader = "X-Request-ID"
+	requestIDKey    = "request_id"
+)
+
+// Request IDs passed in by callers or proxies are kept when they are short and printable
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID tags each request with the caller's X-Request-ID, or a new UUID when it has
+// none or an unusable one, and echoes it in the response so a report can be traced in the logs
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.New().String()
+		}
+		c.Set(requestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// RequestIDFrom returns the request's ID, or "" outside RequestID
+func RequestIDFrom(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
@@ -0,0 +1,81 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"stocky/internal/services"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ParseTimeouts parses per-endpoint deadlines given as comma-separated
+// "METHOD /route=duration" entries, e.g. "POST /api/v1/rewards/batch=2m". Routes are
+// gin patterns as registered, such as "/api/v1/portfolio/:userId".
+func ParseTimeouts(spec string) (map[string]time.Duration, error) {
+	timeouts := make(map[string]time.Duration)
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		endpoint, durationStr, ok := strings.Cut(entry, "=")
+		method, route, hasRoute := strings.Cut(strings.TrimSpace(endpoint), " ")
+		route = strings.TrimSpace(route)
+		if !ok || !hasRoute || !strings.HasPrefix(route, "/") {
+			return nil, fmt.Errorf("timeout %q: expected METHOD /route=duration", entry)
+		}
+		timeout, err := time.ParseDuration(strings.TrimSpace(durationStr))
+		if err != nil || timeout < 0 {
+			return nil, fmt.Errorf("timeout %q: duration must be zero or positive", entry)
+		}
+		timeouts[strings.ToUpper(method)+" "+route] = timeout
+	}
+	return timeouts, nil
+}
+
+// Timeout gives each request's context a deadline: its endpoint's entry in timeouts,
+// keyed by method and route pattern, or fallback. Database work run under the context
+// is cancelled once the deadline passes, as it is when the client disconnects.
+// A zero duration leaves the request without a deadline.
+func Timeout(fallback time.Duration, timeouts map[string]time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		timeout, ok := timeouts[c.Request.Method+" "+c.FullPath()]
+		if !ok {
+			timeout = fallback
+		}
+		if timeout <= 0 {
+			c.Next()
+			recordContextError(c, c.Request.Context())
+			return
+		}
+
+		request := c.Request
+		ctx, cancel := context.WithTimeout(request.Context(), timeout)
+		defer cancel()
+		c.Request = request.WithContext(ctx)
+		c.Next()
+
+		// Checked while ctx is still the request's own; once released it is always done
+		recordContextError(c, ctx)
+		c.Request = request
+	}
+}
+
+// recordContextError replaces an internal error with a timeout or cancellation when ctx
+// ended before the request did, since the driver reports a query cancelled by ctx in its
+// own terms
+func recordContextError(c *gin.Context, ctx context.Context) {
+	ctxErr := ctx.Err()
+	if ctxErr == nil || len(c.Errors) == 0 {
+		return
+	}
+	cause := c.Errors.Last().Err
+	if services.AsError(cause).Code != services.CodeInternal {
+		return
+	}
+	err := services.AsError(ctxErr)
+	err.Err = cause
+	c.Error(err)
+}
@@ -0,0 +1,138 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"stocky/internal/services"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+func newTimeoutRouter(fallback time.Duration, timeouts map[string]time.Duration) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+
+	router := gin.New()
+	router.Use(RequestID(), Errors(logger), Timeout(fallback, timeouts))
+	router.GET("/fail", func(c *gin.Context) {
+		c.Error(errors.New("boom"))
+	})
+	router.GET("/slow", func(c *gin.Context) {
+		<-c.Request.Context().Done()
+		// What lib/pq returns for a statement cancelled by the context
+		c.Error(errors.New("pq: canceling statement due to user request"))
+	})
+	router.GET("/deadline", func(c *gin.Context) {
+		_, ok := c.Request.Context().Deadline()
+		c.JSON(http.StatusOK, gin.H{"deadline": ok})
+	})
+	return router
+}
+
+func serve(t *testing.T, router http.Handler, req *http.Request) (int, ErrorResponse) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	var body ErrorResponse
+	if w.Code >= 400 {
+		if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+			t.Fatalf("decode error body %q: %v", w.Body.String(), err)
+		}
+	}
+	return w.Code, body
+}
+
+func TestTimeoutKeepsInternalErrors(t *testing.T) {
+	router := newTimeoutRouter(10*time.Second, nil)
+
+	status, body := serve(t, router, httptest.NewRequest(http.MethodGet, "/fail", nil))
+	if status != http.StatusInternalServerError || body.Code != services.CodeInternal {
+		t.Fatalf("got %d %s, want 500 %s", status, body.Code, services.CodeInternal)
+	}
+	if body.Message != "internal server error" {
+		t.Errorf("message = %q, want the generic message", body.Message)
+	}
+}
+
+func TestTimeoutDeadlineExceeded(t *testing.T) {
+	router := newTimeoutRouter(10*time.Millisecond, nil)
+
+	status, body := serve(t, router, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	if status != http.StatusGatewayTimeout || body.Code != services.CodeTimeout {
+		t.Fatalf("got %d %s, want 504 %s", status, body.Code, services.CodeTimeout)
+	}
+}
+
+func TestTimeoutClientCanceled(t *testing.T) {
+	router := newTimeoutRouter(10*time.Second, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/slow", nil).WithContext(ctx)
+	status, body := serve(t, router, req)
+	if status != StatusClientClosedRequest || body.Code != services.CodeCanceled {
+		t.Fatalf("got %d %s, want %d %s", status, body.Code, StatusClientClosedRequest, services.CodeCanceled)
+	}
+}
+
+func TestTimeoutPerEndpoint(t *testing.T) {
+	timeouts, err := ParseTimeouts("GET /deadline=0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := newTimeoutRouter(10*time.Second, timeouts)
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/deadline", nil))
+	if w.Body.String() != `{"deadline":false}` {
+		t.Errorf("body = %s, want no deadline for an endpoint overridden to 0", w.Body.String())
+	}
+}
+
+func TestParseTimeouts(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    map[string]time.Duration
+		wantErr bool
+	}{
+		{spec: "", want: map[string]time.Duration{}},
+		{
+			spec: "post /api/v1/rewards/batch=2m, GET /api/v1/portfolio/:userId=30s",
+			want: map[string]time.Duration{
+				"POST /api/v1/rewards/batch":    2 * time.Minute,
+				"GET /api/v1/portfolio/:userId": 30 * time.Second,
+			},
+		},
+		{spec: "POST=2m", wantErr: true},
+		{spec: "POST rewards=2m", wantErr: true},
+		{spec: "POST /x", wantErr: true},
+		{spec: "POST /x=-1s", wantErr: true},
+		{spec: "POST /x=5", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseTimeouts(tt.spec)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeouts(%q) error = %v, wantErr %v", tt.spec, err, tt.wantErr)
+			continue
+		}
+		if tt.wantErr {
+			continue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("ParseTimeouts(%q) = %v, want %v", tt.spec, got, tt.want)
+		}
+		for endpoint, timeout := range tt.want {
+			if got[endpoint] != timeout {
+				t.Errorf("ParseTimeouts(%q)[%q] = %v, want %v", tt.spec, endpoint, got[endpoint], timeout)
+			}
+		}
+	}
+}
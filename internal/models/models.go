@@ -2,27 +2,35 @@ package models
 
 import (
 	"database/sql"
+	"stocky/internal/decimal"
 	"time"
 )
 
 // RewardEvent represents a stock reward event
 type RewardEvent struct {
-	ID             string    `json:"id"`
-	UserID         string    `json:"user_id"`
-	StockSymbol    string    `json:"stock_symbol"`
-	Quantity       string    `json:"quantity"` // NUMERIC as string for precision
+	ID              string    `json:"id"`
+	UserID          string    `json:"user_id"`
+	StockSymbol     string    `json:"stock_symbol"`
+	Quantity        string    `json:"quantity"` // NUMERIC as string for precision
 	RewardTimestamp time.Time `json:"reward_timestamp"`
-	EventID        string    `json:"event_id"`
-	CreatedAt      time.Time `json:"created_at"`
-	UpdatedAt      time.Time `json:"updated_at"`
+	EventID         string    `json:"event_id"`
+	Exchange        string    `json:"exchange"` // NSE, BSE
+	FeeScheduleID   string    `json:"fee_schedule_id"`
+	PayloadHash     string    `json:"-"` // SHA-256 of the canonical request payload; empty for rewards recorded before it was stored
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
 }
 
 // LedgerEntry represents a double-entry ledger entry
 type LedgerEntry struct {
 	ID            string         `json:"id"`
 	RewardEventID sql.NullString `json:"reward_event_id"`
-	EntryType     string         `json:"entry_type"` // STOCK_CREDIT, CASH_DEBIT, etc.
-	AccountType   string         `json:"account_type"` // STOCK, CASH, FEES
+	JournalID     sql.NullString `json:"journal_id"`
+	AdjustmentID  sql.NullString `json:"adjustment_id"` // Set on compensating entries
+	EntryType     string         `json:"entry_type"`    // STOCK_CREDIT, CASH_DEBIT, etc.
+	AccountCode   sql.NullString `json:"account_code"`  // Chart of accounts code, e.g. STOCK_INVENTORY:RELIANCE
+	AccountType   string         `json:"account_type"`  // Reporting group of the account: CASH, STOCK, USER_STOCK, PAYABLES, FEES, EXPENSE
+	Side          string         `json:"side"`          // DEBIT, CREDIT
 	StockSymbol   sql.NullString `json:"stock_symbol"`
 	Quantity      sql.NullString `json:"quantity"`
 	Amount        string         `json:"amount"` // NUMERIC as string
@@ -30,13 +38,95 @@ type LedgerEntry struct {
 	CreatedAt     time.Time      `json:"created_at"`
 }
 
+// JournalLine is one leg of a journal. Amounts are non-negative INR; Side gives the direction.
+type JournalLine struct {
+	EntryType   string
+	AccountCode string
+	Side        string
+	StockSymbol string // Optional
+	Quantity    string // Optional, for stock legs
+	Amount      decimal.Decimal
+	Description string
+}
+
+// Journal groups ledger entries that must net to zero, together with the
+// business event that caused them. Source IDs are optional.
+type Journal struct {
+	JournalType       string
+	RewardEventID     string
+	AdjustmentID      string
+	CorporateActionID string
+	Description       string
+	Lines             []JournalLine
+}
+
+// TrialBalance summarises ledger debits and credits per account over a date range
+type TrialBalance struct {
+	From         string             `json:"from"`
+	To           string             `json:"to"`
+	Accounts     []TrialBalanceLine `json:"accounts"`
+	TotalDebits  string             `json:"total_debits"`
+	TotalCredits string             `json:"total_credits"`
+	Balanced     bool               `json:"balanced"`
+}
+
+// TrialBalanceLine is one account's totals in a trial balance
+type TrialBalanceLine struct {
+	AccountType string `json:"account_type"`
+	Debits      string `json:"debits"`
+	Credits     string `json:"credits"`
+	Net         string `json:"net"` // Debits - Credits
+}
+
+// RewardAdjustment represents a reversal or partial reduction of a reward.
+// The original reward_events row is never modified.
+type RewardAdjustment struct {
+	ID                string    `json:"id"`
+	RewardEventID     string    `json:"reward_event_id"`
+	AdjustmentType    string    `json:"adjustment_type"` // REVERSAL, ADJUSTMENT
+	Quantity          string    `json:"quantity"`        // Signed change, always negative
+	RemainingQuantity string    `json:"remaining_quantity"`
+	Reason            string    `json:"reason,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+}
+
+// CorporateAction represents a split, bonus issue, symbol change or merger
+type CorporateAction struct {
+	ID             string     `json:"id"`
+	ActionType     string     `json:"action_type"` // SPLIT, BONUS, SYMBOL_CHANGE, MERGER
+	StockSymbol    string     `json:"stock_symbol"`
+	NewStockSymbol string     `json:"new_stock_symbol,omitempty"`
+	RatioFrom      string     `json:"ratio_from"`
+	RatioTo        string     `json:"ratio_to"`
+	EffectiveDate  string     `json:"effective_date"` // YYYY-MM-DD
+	Description    string     `json:"description,omitempty"`
+	Status         string     `json:"status"` // PENDING, APPLIED
+	AppliedAt      *time.Time `json:"applied_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+}
+
+// Instrument represents a listed stock: its reference data and trading status
+type Instrument struct {
+	StockSymbol     string    `json:"stock_symbol"`
+	ISIN            string    `json:"isin,omitempty"`
+	Exchange        string    `json:"exchange,omitempty"` // Primary listing: NSE, BSE
+	CompanyName     string    `json:"company_name,omitempty"`
+	Sector          string    `json:"sector,omitempty"`
+	FaceValue       string    `json:"face_value,omitempty"` // INR per share
+	TickSize        string    `json:"tick_size,omitempty"`  // Minimum price movement in INR
+	Status          string    `json:"status"`               // ACTIVE, SUSPENDED, DELISTED
+	ValuationRule   string    `json:"valuation_rule"`       // CARRY_FORWARD, WRITE_OFF
+	StatusReason    string    `json:"status_reason,omitempty"`
+	StatusChangedAt time.Time `json:"status_changed_at"`
+}
+
 // StockPrice represents a stock price at a point in time
 type StockPrice struct {
-	ID            string    `json:"id"`
-	StockSymbol   string    `json:"stock_symbol"`
-	Price         string    `json:"price"`
+	ID             string    `json:"id"`
+	StockSymbol    string    `json:"stock_symbol"`
+	Price          string    `json:"price"`
 	PriceTimestamp time.Time `json:"price_timestamp"`
-	CreatedAt     time.Time `json:"created_at"`
+	CreatedAt      time.Time `json:"created_at"`
 }
 
 // PortfolioSnapshot represents a daily snapshot of user holdings
@@ -51,6 +141,44 @@ type PortfolioSnapshot struct {
 	CreatedAt     time.Time `json:"created_at"`
 }
 
+// SnapshotBackfill reports a regeneration of portfolio snapshots over a date range
+type SnapshotBackfill struct {
+	From             string `json:"from"` // YYYY-MM-DD
+	To               string `json:"to"`   // YYYY-MM-DD
+	Users            int    `json:"users"`
+	Days             int    `json:"days"`
+	SnapshotsWritten int    `json:"snapshots_written"` // Symbols without any price are skipped
+}
+
+// SnapshotInvalidation marks a user's snapshots from DirtyFrom onwards for recomputation
+type SnapshotInvalidation struct {
+	UserID    string    `json:"user_id"`
+	DirtyFrom string    `json:"dirty_from"` // YYYY-MM-DD
+	MarkedAt  time.Time `json:"marked_at"`
+}
+
+// RewardBatch reports the outcome of a batch of rewards
+type RewardBatch struct {
+	Mode       string              `json:"mode"`              // "atomic" or "best_effort"
+	DryRun     bool                `json:"dry_run,omitempty"` // Outcomes were checked but nothing was written
+	RolledBack bool                `json:"rolled_back"`       // Atomic batch that wrote nothing because an item could not be created
+	Created    int                 `json:"created"`
+	Duplicates int                 `json:"duplicates"`
+	Conflicts  int                 `json:"conflicts"`
+	Invalid    int                 `json:"invalid"`
+	Failed     int                 `json:"failed"`
+	Results    []RewardBatchResult `json:"results"` // In input order
+}
+
+// RewardBatchResult is the outcome of one reward in a batch
+type RewardBatchResult struct {
+	Index    int    `json:"index"` // Position in the request, from 0
+	EventID  string `json:"event_id,omitempty"`
+	Status   string `json:"status"` // created, duplicate, invalid, failed, rolled_back or skipped
+	RewardID string `json:"reward_id,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
 // TodayStock represents today's stock reward
 type TodayStock struct {
 	StockSymbol string `json:"stock_symbol"`
@@ -66,21 +194,61 @@ type HistoricalINR struct {
 
 // Stats represents user statistics
 type Stats struct {
-	TotalSharesToday map[string]string `json:"total_shares_today"` // stock_symbol -> quantity
-	CurrentPortfolioValue string        `json:"current_portfolio_value"`
+	TotalSharesToday      map[string]string `json:"total_shares_today"` // stock_symbol -> quantity
+	CurrentPortfolioValue string            `json:"current_portfolio_value"`
+	PricesAsOf            *time.Time        `json:"prices_as_of,omitempty"` // Oldest price used in the valuation
+	Stale                 bool              `json:"stale"`                  // At least one price used is stale
 }
 
 // Portfolio represents user portfolio
 type Portfolio struct {
-	Holdings []Holding `json:"holdings"`
-	TotalValue string  `json:"total_value"`
+	Holdings   []Holding  `json:"holdings"`
+	TotalValue string     `json:"total_value"`
+	PricesAsOf *time.Time `json:"prices_as_of,omitempty"` // Oldest price used in the valuation
+	Stale      bool       `json:"stale"`                  // At least one holding's price is stale
 }
 
 // Holding represents a single stock holding
 type Holding struct {
-	StockSymbol string `json:"stock_symbol"`
-	Quantity    string `json:"quantity"`
-	CurrentPrice string `json:"current_price"`
-	CurrentValue string `json:"current_value"`
+	StockSymbol  string     `json:"stock_symbol"`
+	CompanyName  string     `json:"company_name,omitempty"`
+	Exchange     string     `json:"exchange,omitempty"` // Primary listing of the instrument
+	Quantity     string     `json:"quantity"`
+	CurrentPrice string     `json:"current_price"`
+	CurrentValue string     `json:"current_value"`
+	Status       string     `json:"status"`                // Instrument status: ACTIVE, SUSPENDED, DELISTED
+	PriceAsOf    *time.Time `json:"price_as_of,omitempty"` // When current_price was taken; absent when valued at zero without a price
+	PriceStale   bool       `json:"price_stale"`
 }
 
+// FeeSchedule defines the fee rates for an exchange from an effective date onwards
+type FeeSchedule struct {
+	ID            string    `json:"id"`
+	Exchange      string    `json:"exchange"`       // NSE, BSE
+	EffectiveFrom string    `json:"effective_from"` // YYYY-MM-DD
+	BrokerageRate string    `json:"brokerage_rate"` // Fraction of trade value
+	BrokerageMin  string    `json:"brokerage_min"`
+	BrokerageMax  string    `json:"brokerage_max,omitempty"` // Empty means uncapped
+	STTRate       string    `json:"stt_rate"`                // Fraction of trade value
+	GSTRate       string    `json:"gst_rate"`                // Fraction of brokerage
+	OtherFeesFlat string    `json:"other_fees_flat"`         // Flat INR per transaction
+	Description   string    `json:"description,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// FeeBreakdown is the cost of buying a quantity of stock under a fee schedule
+type FeeBreakdown struct {
+	StockSymbol   string `json:"stock_symbol"`
+	Quantity      string `json:"quantity"`
+	Exchange      string `json:"exchange"`
+	FeeScheduleID string `json:"fee_schedule_id"`
+	EffectiveFrom string `json:"effective_from"`
+	Price         string `json:"price"`
+	TradeValue    string `json:"trade_value"`
+	Brokerage     string `json:"brokerage"`
+	STT           string `json:"stt"`
+	GST           string `json:"gst"`
+	OtherFees     string `json:"other_fees"`
+	TotalFees     string `json:"total_fees"`
+	TotalCost     string `json:"total_cost"` // Trade value plus fees
+}
@@ -0,0 +1,93 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestLimiter() (*MemoryLimiter, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	l := NewMemoryLimiter()
+	l.now = clock.Now
+	return l, clock
+}
+
+func TestMemoryLimiterRefill(t *testing.T) {
+	l, clock := newTestLimiter()
+	policy := Policy{Name: "write", Limit: 3, Window: time.Minute} // A token every 20s
+	ctx := context.Background()
+
+	steps := []struct {
+		advance    time.Duration
+		key        string
+		allowed    bool
+		remaining  int
+		reset      time.Duration
+		retryAfter time.Duration
+	}{
+		{0, "a", true, 2, 20 * time.Second, 0},
+		{0, "a", true, 1, 40 * time.Second, 0},
+		{0, "a", true, 0, time.Minute, 0},
+		{0, "a", false, 0, time.Minute, 20 * time.Second},
+		{0, "b", true, 2, 20 * time.Second, 0}, // Buckets are per key
+		{5 * time.Second, "a", false, 0, 55 * time.Second, 15 * time.Second},
+		{15 * time.Second, "a", true, 0, time.Minute, 0},
+		{time.Hour, "a", true, 2, 20 * time.Second, 0}, // Refill stops at Limit
+	}
+	for i, s := range steps {
+		clock.Advance(s.advance)
+		d, err := l.Allow(ctx, s.key, policy)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := Decision{Allowed: s.allowed, Limit: 3, Remaining: s.remaining, Reset: s.reset, RetryAfter: s.retryAfter}
+		if d != want {
+			t.Errorf("step %d: got %+v, want %+v", i, d, want)
+		}
+	}
+}
+
+func TestMemoryLimiterSweep(t *testing.T) {
+	l, clock := newTestLimiter()
+	policy := Policy{Name: "read", Limit: 2, Window: time.Minute}
+	ctx := context.Background()
+
+	l.Allow(ctx, "idle", policy)
+	l.Allow(ctx, "busy", policy)
+	clock.Advance(50 * time.Second)
+	l.Allow(ctx, "busy", policy)
+	l.Allow(ctx, "busy", policy)
+
+	// "idle" refilled, "busy" did not
+	clock.Advance(20 * time.Second)
+	if _, err := l.Allow(ctx, "other", policy); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := l.buckets["idle"]; ok {
+		t.Error("sweep kept a full bucket")
+	}
+	if _, ok := l.buckets["busy"]; !ok {
+		t.Error("sweep dropped a bucket that was still refilling")
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("write", " 60/1m ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (Policy{Name: "write", Limit: 60, Window: time.Minute}) {
+		t.Errorf("got %+v", p)
+	}
+	for _, spec := range []string{"60", "0/1m", "-1/1m", "x/1m", "60/0s", "60/soon"} {
+		if _, err := ParsePolicy("write", spec); err == nil {
+			t.Errorf("ParsePolicy(%q) accepted an invalid policy", spec)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// PostgresLimiter keeps buckets in the rate_limit_buckets table so limits hold
+// across instances. Each Allow is a single atomic upsert; the database clock is
+// used so instances with skewed clocks still agree.
+type PostgresLimiter struct {
+	db *sql.DB
+}
+
+func NewPostgresLimiter(db *sql.DB) *PostgresLimiter {
+	return &PostgresLimiter{db: db}
+}
+
+// Allow takes a token from key's bucket under policy
+func (l *PostgresLimiter) Allow(ctx context.Context, key string, policy Policy) (Decision, error) {
+	var tokens float64
+	var allowed bool
+	err := l.db.QueryRowContext(ctx, `
+		INSERT INTO rate_limit_buckets AS b (bucket_key, tokens, allowed, updated_at)
+		VALUES ($1, $2::DOUBLE PRECISION - 1, TRUE, now())
+		ON CONFLICT (bucket_key) DO UPDATE
+		SET tokens = CASE
+		        WHEN LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::DOUBLE PRECISION * $3::DOUBLE PRECISION) >= 1
+		        THEN LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::DOUBLE PRECISION * $3::DOUBLE PRECISION) - 1
+		        ELSE LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::DOUBLE PRECISION * $3::DOUBLE PRECISION)
+		    END,
+		    allowed = LEAST($2, b.tokens + EXTRACT(EPOCH FROM now() - b.updated_at)::DOUBLE PRECISION * $3::DOUBLE PRECISION) >= 1,
+		    updated_at = now()
+		RETURNING tokens, allowed
+	`, key, float64(policy.Limit), policy.refillPerSecond()).Scan(&tokens, &allowed)
+	if err != nil {
+		return Decision{}, err
+	}
+
+	return decide(policy, tokens, allowed), nil
+}
+
+// Prune deletes buckets idle for a day. A deleted bucket is recreated full,
+// and a day is longer than any sensible window, so this never changes a decision.
+func (l *PostgresLimiter) Prune(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, `DELETE FROM rate_limit_buckets WHERE updated_at < CURRENT_TIMESTAMP - INTERVAL '1 day'`)
+	return err
+}
+
+// RunPruner calls Prune every interval until ctx is cancelled.
+// Errors are ignored; stale rows only cost space and the next run retries.
+func (l *PostgresLimiter) RunPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.Prune(ctx)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy is a token bucket: up to Limit requests in a burst, refilled evenly over Window
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// ParsePolicy parses "<limit>/<window>", e.g. "60/1m" for 60 requests a minute
+func ParsePolicy(name, spec string) (Policy, error) {
+	limitStr, windowStr, ok := strings.Cut(strings.TrimSpace(spec), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("rate limit %s: expected <limit>/<window>, got %q", name, spec)
+	}
+	limit, err := strconv.Atoi(limitStr)
+	if err != nil || limit <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: limit must be a positive integer", name)
+	}
+	window, err := time.ParseDuration(windowStr)
+	if err != nil || window <= 0 {
+		return Policy{}, fmt.Errorf("rate limit %s: window must be a positive duration", name)
+	}
+	return Policy{Name: name, Limit: limit, Window: window}, nil
+}
+
+// refillPerSecond is the rate at which spent tokens come back
+func (p Policy) refillPerSecond() float64 {
+	return float64(p.Limit) / p.Window.Seconds()
+}
+
+// Decision is the outcome of taking a token from a bucket
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration // Until the bucket is full again
+	RetryAfter time.Duration // Until the next token, when not allowed
+}
+
+// Limiter takes tokens from per-key buckets
+type Limiter interface {
+	Allow(ctx context.Context, key string, policy Policy) (Decision, error)
+}
+
+// decide builds a Decision from a bucket's token count after the request was charged (or refused)
+func decide(policy Policy, tokens float64, allowed bool) Decision {
+	rate := policy.refillPerSecond()
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     policy.Limit,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     secondsToDuration((float64(policy.Limit) - tokens) / rate),
+	}
+	if !allowed {
+		d.RetryAfter = secondsToDuration((1 - tokens) / rate)
+	}
+	return d
+}
+
+func secondsToDuration(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(math.Ceil(s * float64(time.Second)))
+}
@@ -0,0 +1,1056 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MemoryStore is a Store held in process memory, for exercising services without
+// Postgres. It starts with the same chart of accounts and default fee schedules
+// the migrations seed.
+type MemoryStore struct {
+	mu   *sync.Mutex
+	data *memoryData
+	inTx bool // The caller already holds mu
+	now  func() time.Time
+}
+
+type memoryData struct {
+	rewards      []models.RewardEvent
+	adjustments  []models.RewardAdjustment
+	entries      []models.LedgerEntry
+	accounts     map[string]memoryAccount
+	prices       []models.StockPrice
+	instruments  map[string]models.Instrument
+	feeSchedules []models.FeeSchedule
+	actions      []models.CorporateAction
+	actionAdjs   []actionAdjustment
+	snapshots    map[snapshotKey]models.PortfolioSnapshot
+	dirty        map[string]models.SnapshotInvalidation
+}
+
+type memoryAccount struct {
+	accountType string
+	active      bool
+}
+
+// actionAdjustment mirrors a row of corporate_action_adjustments
+type actionAdjustment struct {
+	actionID    string
+	userID      string
+	stockSymbol string
+	quantity    decimal.Decimal
+	effectiveAt time.Time
+}
+
+type snapshotKey struct {
+	userID, date, stockSymbol string
+}
+
+func NewMemoryStore() *MemoryStore {
+	data := &memoryData{
+		accounts: map[string]memoryAccount{
+			"COMPANY_CASH":         {"CASH", true},
+			"STOCK_INVENTORY":      {"STOCK", true},
+			"USER_STOCK_LIABILITY": {"USER_STOCK", true},
+			"BROKERAGE_PAYABLE":    {"PAYABLES", true},
+			"STT_PAYABLE":          {"PAYABLES", true},
+			"GST_PAYABLE":          {"PAYABLES", true},
+			"OTHER_FEES_PAYABLE":   {"PAYABLES", true},
+			"FEE_EXPENSE":          {"FEES", true},
+			"REWARD_EXPENSE":       {"EXPENSE", true},
+		},
+		instruments: make(map[string]models.Instrument),
+		snapshots:   make(map[snapshotKey]models.PortfolioSnapshot),
+		dirty:       make(map[string]models.SnapshotInvalidation),
+	}
+	for _, exchange := range []string{"NSE", "BSE"} {
+		data.feeSchedules = append(data.feeSchedules, models.FeeSchedule{
+			ID:            uuid.New().String(),
+			Exchange:      exchange,
+			EffectiveFrom: "1970-01-01",
+			BrokerageRate: "0.000100",
+			BrokerageMin:  "0.0000",
+			STTRate:       "0.001000",
+			GSTRate:       "0.180000",
+			OtherFeesFlat: "10.0000",
+			Description:   "Default schedule",
+		})
+	}
+	return &MemoryStore{mu: &sync.Mutex{}, data: data, now: time.Now}
+}
+
+// SetInstrument stores an instrument, as the instruments admin endpoints would
+func (s *MemoryStore) SetInstrument(instrument models.Instrument) {
+	s.lock()
+	defer s.unlock()
+	s.data.instruments[instrument.StockSymbol] = instrument
+}
+
+// AddFeeSchedule stores a fee schedule alongside the defaults
+func (s *MemoryStore) AddFeeSchedule(schedule models.FeeSchedule) {
+	s.lock()
+	defer s.unlock()
+	if schedule.ID == "" {
+		schedule.ID = uuid.New().String()
+	}
+	s.data.feeSchedules = append(s.data.feeSchedules, schedule)
+}
+
+// AddAppliedCorporateAction records that a corporate action on the symbol has been
+// applied, without changing anyone's holdings
+func (s *MemoryStore) AddAppliedCorporateAction(stockSymbol string, effectiveDate time.Time) {
+	s.lock()
+	defer s.unlock()
+	now := s.now()
+	s.data.actions = append(s.data.actions, models.CorporateAction{
+		ID:            uuid.New().String(),
+		StockSymbol:   stockSymbol,
+		RatioFrom:     "1.000000",
+		RatioTo:       "1.000000",
+		EffectiveDate: effectiveDate.Format("2006-01-02"),
+		Status:        corporateActionApplied,
+		AppliedAt:     &now,
+		CreatedAt:     now,
+	})
+}
+
+func (s *MemoryStore) Rewards() RewardRepository         { return &memoryRewards{s} }
+func (s *MemoryStore) Ledger() LedgerRepository          { return &memoryLedger{s} }
+func (s *MemoryStore) Prices() PriceRepository           { return &memoryPrices{s} }
+func (s *MemoryStore) Snapshots() SnapshotRepository     { return &memorySnapshots{s} }
+func (s *MemoryStore) Instruments() InstrumentRepository { return &memoryInstruments{s} }
+func (s *MemoryStore) CorporateActions() CorporateActionRepository {
+	return &memoryCorporateActions{s}
+}
+func (s *MemoryStore) FeeSchedules() FeeScheduleRepository { return &memoryFeeSchedules{s} }
+
+// WithContext returns s; the in-memory store has nothing to cancel
+func (s *MemoryStore) WithContext(ctx context.Context) Store { return s }
+
+// InTx holds the store's lock while fn runs and restores the previous state if it fails.
+// A nested call restores only what it changed, like a savepoint.
+func (s *MemoryStore) InTx(fn func(tx Store) error) error {
+	if s.inTx {
+		saved := s.data.clone()
+		if err := fn(s); err != nil {
+			*s.data = *saved
+			return err
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	saved := s.data.clone()
+	if err := fn(&MemoryStore{mu: s.mu, data: s.data, inTx: true, now: s.now}); err != nil {
+		*s.data = *saved
+		return err
+	}
+	return nil
+}
+
+func (s *MemoryStore) lock() {
+	if !s.inTx {
+		s.mu.Lock()
+	}
+}
+
+func (s *MemoryStore) unlock() {
+	if !s.inTx {
+		s.mu.Unlock()
+	}
+}
+
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		rewards:      append([]models.RewardEvent(nil), d.rewards...),
+		adjustments:  append([]models.RewardAdjustment(nil), d.adjustments...),
+		entries:      append([]models.LedgerEntry(nil), d.entries...),
+		accounts:     make(map[string]memoryAccount, len(d.accounts)),
+		prices:       append([]models.StockPrice(nil), d.prices...),
+		instruments:  make(map[string]models.Instrument, len(d.instruments)),
+		feeSchedules: append([]models.FeeSchedule(nil), d.feeSchedules...),
+		actions:      append([]models.CorporateAction(nil), d.actions...),
+		actionAdjs:   append([]actionAdjustment(nil), d.actionAdjs...),
+		snapshots:    make(map[snapshotKey]models.PortfolioSnapshot, len(d.snapshots)),
+		dirty:        make(map[string]models.SnapshotInvalidation, len(d.dirty)),
+	}
+	for k, v := range d.accounts {
+		c.accounts[k] = v
+	}
+	for k, v := range d.instruments {
+		c.instruments[k] = v
+	}
+	for k, v := range d.snapshots {
+		c.snapshots[k] = v
+	}
+	for k, v := range d.dirty {
+		c.dirty[k] = v
+	}
+	return c
+}
+
+// movement mirrors a row of the holding_movements view
+type movement struct {
+	rewardID    string
+	userID      string
+	stockSymbol string
+	quantity    decimal.Decimal
+	rewardedAt  time.Time
+	effectiveAt time.Time
+	// From a corporate action rather than a reward or its adjustments
+	corporateAction bool
+}
+
+func (d *memoryData) movements(userID string) []movement {
+	var movements []movement
+	rewards := make(map[string]models.RewardEvent)
+	for _, r := range d.rewards {
+		rewards[r.ID] = r
+		if r.UserID == userID {
+			movements = append(movements, movement{r.ID, r.UserID, r.StockSymbol, decimal.MustParse(r.Quantity), r.RewardTimestamp, r.RewardTimestamp, false})
+		}
+	}
+	for _, a := range d.adjustments {
+		if r := rewards[a.RewardEventID]; r.UserID == userID {
+			movements = append(movements, movement{r.ID, r.UserID, r.StockSymbol, decimal.MustParse(a.Quantity), r.RewardTimestamp, a.CreatedAt, false})
+		}
+	}
+	for _, a := range d.actionAdjs {
+		if a.userID == userID {
+			movements = append(movements, movement{"", a.userID, a.stockSymbol, a.quantity, time.Time{}, a.effectiveAt, true})
+		}
+	}
+	return movements
+}
+
+type memoryRewards struct {
+	s *MemoryStore
+}
+
+func (r *memoryRewards) GetByEventID(eventID string) (*models.RewardEvent, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	for _, reward := range r.s.data.rewards {
+		if reward.EventID == eventID {
+			return &reward, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryRewards) Create(reward *models.RewardEvent) error {
+	if _, err := decimal.Parse(reward.Quantity); err != nil {
+		return err
+	}
+
+	r.s.lock()
+	defer r.s.unlock()
+	for _, existing := range r.s.data.rewards {
+		if existing.ID == reward.ID || existing.EventID == reward.EventID {
+			return fmt.Errorf("reward %s already exists", reward.EventID)
+		}
+	}
+	now := r.s.now()
+	reward.CreatedAt, reward.UpdatedAt = now, now
+	r.s.data.rewards = append(r.s.data.rewards, *reward)
+	return nil
+}
+
+func (r *memoryRewards) GetForUpdate(id string) (*models.RewardEvent, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	for _, reward := range r.s.data.rewards {
+		if reward.ID == id {
+			return &reward, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryRewards) AdjustedQuantity(rewardID string) (string, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	total := decimal.Zero(0)
+	for _, a := range r.s.data.adjustments {
+		if a.RewardEventID == rewardID {
+			total = total.Add(decimal.MustParse(a.Quantity))
+		}
+	}
+	return total.String(), nil
+}
+
+func (r *memoryRewards) CreateAdjustment(adjustment *models.RewardAdjustment) error {
+	if _, err := decimal.Parse(adjustment.Quantity); err != nil {
+		return err
+	}
+
+	r.s.lock()
+	defer r.s.unlock()
+	adjustment.ID = uuid.New().String()
+	adjustment.CreatedAt = r.s.now()
+	r.s.data.adjustments = append(r.s.data.adjustments, *adjustment)
+	return nil
+}
+
+func (r *memoryRewards) RestatedAfter(stockSymbol string, since time.Time) (bool, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	for _, action := range r.s.data.actions {
+		if action.StockSymbol == stockSymbol && action.Status == corporateActionApplied && action.EffectiveDate > since.Format("2006-01-02") {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryRewards) RewardsBetween(userID string, from, to time.Time) ([]models.TodayStock, error) {
+	r.s.lock()
+	defer r.s.unlock()
+
+	type reward struct {
+		stockSymbol string
+		quantity    decimal.Decimal
+		rewardedAt  time.Time
+	}
+	var order []string
+	byID := make(map[string]*reward)
+	for _, m := range r.s.data.movements(userID) {
+		if m.rewardedAt.Before(from) || !m.rewardedAt.Before(to) {
+			continue
+		}
+		if rw, ok := byID[m.rewardID]; ok {
+			rw.quantity = rw.quantity.Add(m.quantity)
+			continue
+		}
+		byID[m.rewardID] = &reward{m.stockSymbol, m.quantity, m.rewardedAt}
+		order = append(order, m.rewardID)
+	}
+
+	var stocks []models.TodayStock
+	for _, id := range order {
+		rw := byID[id]
+		if rw.quantity.IsZero() {
+			continue
+		}
+		stocks = append(stocks, models.TodayStock{
+			StockSymbol: rw.stockSymbol,
+			Quantity:    rw.quantity.String(),
+			RewardedAt:  rw.rewardedAt.In(from.Location()).Format(time.RFC3339),
+		})
+	}
+	sort.SliceStable(stocks, func(i, j int) bool { return stocks[i].RewardedAt > stocks[j].RewardedAt })
+	return stocks, nil
+}
+
+func (r *memoryRewards) RewardedQuantitiesBetween(userID string, from, to time.Time) (map[string]string, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	holdings := sumHoldings(r.s.data.movements(userID), func(m movement) bool {
+		return !m.rewardedAt.Before(from) && m.rewardedAt.Before(to)
+	}, false)
+
+	quantities := make(map[string]string, len(holdings))
+	for _, h := range holdings {
+		quantities[h.StockSymbol] = h.Quantity
+	}
+	return quantities, nil
+}
+
+func (r *memoryRewards) Holdings(userID string, at time.Time) ([]Holding, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	return sumHoldings(r.s.data.movements(userID), func(m movement) bool {
+		return !m.effectiveAt.After(at)
+	}, false), nil
+}
+
+func (r *memoryRewards) HoldingsBefore(userID string, end time.Time) ([]Holding, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	return sumHoldings(r.s.data.movements(userID), func(m movement) bool {
+		return m.effectiveAt.Before(end)
+	}, true), nil
+}
+
+// sumHoldings totals the movements matching include per symbol, ordered by symbol
+func sumHoldings(movements []movement, include func(movement) bool, keepZero bool) []Holding {
+	totals := make(map[string]decimal.Decimal)
+	for _, m := range movements {
+		if !include(m) {
+			continue
+		}
+		if total, ok := totals[m.stockSymbol]; ok {
+			totals[m.stockSymbol] = total.Add(m.quantity)
+		} else {
+			totals[m.stockSymbol] = m.quantity
+		}
+	}
+
+	var holdings []Holding
+	for symbol, total := range totals {
+		if total.IsZero() && !keepZero {
+			continue
+		}
+		holdings = append(holdings, Holding{StockSymbol: symbol, Quantity: total.String()})
+	}
+	sort.Slice(holdings, func(i, j int) bool { return holdings[i].StockSymbol < holdings[j].StockSymbol })
+	return holdings
+}
+
+func (r *memoryRewards) UserIDs() ([]string, error) {
+	r.s.lock()
+	defer r.s.unlock()
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, reward := range r.s.data.rewards {
+		if !seen[reward.UserID] {
+			seen[reward.UserID] = true
+			userIDs = append(userIDs, reward.UserID)
+		}
+	}
+	return userIDs, nil
+}
+
+type memoryLedger struct {
+	s *MemoryStore
+}
+
+func (l *memoryLedger) PostJournal(j models.Journal) (string, error) {
+	l.s.lock()
+	defer l.s.unlock()
+
+	// Resolve every account before writing so a bad line leaves nothing behind
+	accountTypes := make(map[string]string)
+	for _, line := range j.Lines {
+		accountType, err := l.resolveAccount(line.AccountCode)
+		if err != nil {
+			return "", err
+		}
+		accountTypes[line.AccountCode] = accountType
+	}
+
+	journalID := uuid.New().String()
+	now := l.s.now()
+	for _, line := range j.Lines {
+		l.s.data.entries = append(l.s.data.entries, models.LedgerEntry{
+			ID:            uuid.New().String(),
+			RewardEventID: nullString(j.RewardEventID),
+			JournalID:     nullString(journalID),
+			AdjustmentID:  nullString(j.AdjustmentID),
+			EntryType:     line.EntryType,
+			AccountCode:   nullString(line.AccountCode),
+			AccountType:   accountTypes[line.AccountCode],
+			Side:          line.Side,
+			StockSymbol:   nullString(line.StockSymbol),
+			Quantity:      nullString(line.Quantity),
+			Amount:        line.Amount.String(),
+			Description:   sql.NullString{String: line.Description, Valid: true},
+			CreatedAt:     now,
+		})
+	}
+	return journalID, nil
+}
+
+// resolveAccount mirrors PostgresLedger.resolveAccount; the caller holds the lock
+func (l *memoryLedger) resolveAccount(code string) (string, error) {
+	if parent, _, ok := strings.Cut(code, ":"); ok {
+		if _, exists := l.s.data.accounts[code]; !exists {
+			if p, ok := l.s.data.accounts[parent]; ok {
+				l.s.data.accounts[code] = p
+			}
+		}
+	}
+
+	account, ok := l.s.data.accounts[code]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownAccount, code)
+	}
+	if !account.active {
+		return "", fmt.Errorf("%w: %s is closed", ErrUnknownAccount, code)
+	}
+	return account.accountType, nil
+}
+
+func (l *memoryLedger) RewardEntries(rewardID string) ([]models.LedgerEntry, error) {
+	l.s.lock()
+	defer l.s.unlock()
+	var entries []models.LedgerEntry
+	for _, e := range l.s.data.entries {
+		if e.RewardEventID.String == rewardID {
+			entries = append(entries, e)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return !entries[i].AdjustmentID.Valid && entries[j].AdjustmentID.Valid })
+	return entries, nil
+}
+
+func (l *memoryLedger) AccountTotals(from, to time.Time) ([]AccountTotal, error) {
+	l.s.lock()
+	defer l.s.unlock()
+	debits := make(map[string]decimal.Decimal)
+	credits := make(map[string]decimal.Decimal)
+	var accountTypes []string
+	for _, e := range l.s.data.entries {
+		if e.CreatedAt.Before(from) || !e.CreatedAt.Before(to) {
+			continue
+		}
+		if _, seen := debits[e.AccountType]; !seen {
+			debits[e.AccountType] = decimal.Zero(decimal.AmountScale)
+			credits[e.AccountType] = decimal.Zero(decimal.AmountScale)
+			accountTypes = append(accountTypes, e.AccountType)
+		}
+		amount := decimal.MustParse(e.Amount)
+		if e.Side == "DEBIT" {
+			debits[e.AccountType] = debits[e.AccountType].Add(amount)
+		} else {
+			credits[e.AccountType] = credits[e.AccountType].Add(amount)
+		}
+	}
+	sort.Strings(accountTypes)
+
+	var totals []AccountTotal
+	for _, accountType := range accountTypes {
+		totals = append(totals, AccountTotal{accountType, debits[accountType].String(), credits[accountType].String()})
+	}
+	return totals, nil
+}
+
+type memoryPrices struct {
+	s *MemoryStore
+}
+
+// pick returns the stored price of the symbol that include accepts and is preferred
+// over every other accepted price
+func (p *memoryPrices) pick(stockSymbol string, include func(models.StockPrice) bool, prefer func(a, b time.Time) bool) (*models.StockPrice, error) {
+	p.s.lock()
+	defer p.s.unlock()
+	var found *models.StockPrice
+	for i, price := range p.s.data.prices {
+		if price.StockSymbol != stockSymbol || !include(price) {
+			continue
+		}
+		if found == nil || prefer(price.PriceTimestamp, found.PriceTimestamp) {
+			found = &p.s.data.prices[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	price := *found
+	return &price, nil
+}
+
+func (p *memoryPrices) Latest(stockSymbol string) (*models.StockPrice, error) {
+	return p.pick(stockSymbol, func(models.StockPrice) bool { return true }, time.Time.After)
+}
+
+func (p *memoryPrices) LatestBefore(stockSymbol string, end time.Time) (string, error) {
+	price, err := p.pick(stockSymbol, func(price models.StockPrice) bool {
+		return price.PriceTimestamp.Before(end)
+	}, time.Time.After)
+	if err != nil {
+		return "", err
+	}
+	return price.Price, nil
+}
+
+func (p *memoryPrices) Save(stockSymbol, price string, at time.Time) error {
+	if _, err := decimal.Parse(price); err != nil {
+		return err
+	}
+
+	p.s.lock()
+	defer p.s.unlock()
+	for i, existing := range p.s.data.prices {
+		if existing.StockSymbol == stockSymbol && existing.PriceTimestamp.Equal(at) {
+			p.s.data.prices[i].Price = price
+			return nil
+		}
+	}
+	p.s.data.prices = append(p.s.data.prices, models.StockPrice{
+		ID:             uuid.New().String(),
+		StockSymbol:    stockSymbol,
+		Price:          price,
+		PriceTimestamp: at,
+		CreatedAt:      p.s.now(),
+	})
+	return nil
+}
+
+func (p *memoryPrices) Instrument(stockSymbol string) (*models.Instrument, error) {
+	p.s.lock()
+	defer p.s.unlock()
+	instrument, ok := p.s.data.instruments[stockSymbol]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &instrument, nil
+}
+
+func (p *memoryPrices) TradingSymbols() ([]string, error) {
+	p.s.lock()
+	defer p.s.unlock()
+
+	var userIDs []string
+	seen := make(map[string]bool)
+	for _, reward := range p.s.data.rewards {
+		if !seen[reward.UserID] {
+			seen[reward.UserID] = true
+			userIDs = append(userIDs, reward.UserID)
+		}
+	}
+
+	var movements []movement
+	for _, userID := range userIDs {
+		movements = append(movements, p.s.data.movements(userID)...)
+	}
+
+	var symbols []string
+	for _, h := range sumHoldings(movements, func(movement) bool { return true }, false) {
+		if instrument, ok := p.s.data.instruments[h.StockSymbol]; ok && instrument.Status != instrumentActive {
+			continue
+		}
+		symbols = append(symbols, h.StockSymbol)
+	}
+	return symbols, nil
+}
+
+type memorySnapshots struct {
+	s *MemoryStore
+}
+
+func (m *memorySnapshots) Save(snapshot models.PortfolioSnapshot) error {
+	m.s.lock()
+	defer m.s.unlock()
+	key := snapshotKey{snapshot.UserID, snapshot.SnapshotDate.Format("2006-01-02"), snapshot.StockSymbol}
+	if existing, ok := m.s.data.snapshots[key]; ok {
+		snapshot.ID, snapshot.CreatedAt = existing.ID, existing.CreatedAt
+	} else {
+		snapshot.ID, snapshot.CreatedAt = uuid.New().String(), m.s.now()
+	}
+	m.s.data.snapshots[key] = snapshot
+	return nil
+}
+
+func (m *memorySnapshots) DailyValues(userID, before string) ([]models.HistoricalINR, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	totals := make(map[string]decimal.Decimal)
+	for key, snapshot := range m.s.data.snapshots {
+		if key.userID != userID || key.date >= before {
+			continue
+		}
+		value, err := decimal.Parse(snapshot.TotalINRValue)
+		if err != nil {
+			return nil, err
+		}
+		if total, ok := totals[key.date]; ok {
+			totals[key.date] = total.Add(value)
+		} else {
+			totals[key.date] = value
+		}
+	}
+
+	historical := make([]models.HistoricalINR, 0, len(totals))
+	for date, total := range totals {
+		historical = append(historical, models.HistoricalINR{Date: date, Value: total.String()})
+	}
+	sort.Slice(historical, func(i, j int) bool { return historical[i].Date > historical[j].Date })
+	return historical, nil
+}
+
+func (m *memorySnapshots) Invalidate(userID, from string) error {
+	m.s.lock()
+	defer m.s.unlock()
+	if existing, ok := m.s.data.dirty[userID]; ok && existing.DirtyFrom < from {
+		from = existing.DirtyFrom
+	}
+	m.s.data.dirty[userID] = models.SnapshotInvalidation{UserID: userID, DirtyFrom: from, MarkedAt: m.s.now()}
+	return nil
+}
+
+func (m *memorySnapshots) Invalidations() ([]models.SnapshotInvalidation, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	invalidations := make([]models.SnapshotInvalidation, 0, len(m.s.data.dirty))
+	for _, inv := range m.s.data.dirty {
+		invalidations = append(invalidations, inv)
+	}
+	sort.Slice(invalidations, func(i, j int) bool {
+		if invalidations[i].DirtyFrom != invalidations[j].DirtyFrom {
+			return invalidations[i].DirtyFrom < invalidations[j].DirtyFrom
+		}
+		return invalidations[i].UserID < invalidations[j].UserID
+	})
+	return invalidations, nil
+}
+
+func (m *memorySnapshots) ClearInvalidation(invalidation models.SnapshotInvalidation) error {
+	m.s.lock()
+	defer m.s.unlock()
+	if existing, ok := m.s.data.dirty[invalidation.UserID]; ok && existing.MarkedAt.Equal(invalidation.MarkedAt) {
+		delete(m.s.data.dirty, invalidation.UserID)
+	}
+	return nil
+}
+
+type memoryInstruments struct {
+	s *MemoryStore
+}
+
+func (m *memoryInstruments) List(status, exchange string) ([]models.Instrument, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	instruments := []models.Instrument{}
+	for _, instrument := range m.s.data.instruments {
+		if (status == "" || instrument.Status == status) && (exchange == "" || instrument.Exchange == exchange) {
+			instruments = append(instruments, instrument)
+		}
+	}
+	sort.Slice(instruments, func(i, j int) bool { return instruments[i].StockSymbol < instruments[j].StockSymbol })
+	return instruments, nil
+}
+
+func (m *memoryInstruments) GetByISIN(isin string) (*models.Instrument, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	for _, instrument := range m.s.data.instruments {
+		if isin != "" && instrument.ISIN == isin {
+			return &instrument, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// isinTaken reports whether another symbol holds the instrument's ISIN, as the unique index would
+func (d *memoryData) isinTaken(instrument models.Instrument) bool {
+	for symbol, other := range d.instruments {
+		if symbol != instrument.StockSymbol && instrument.ISIN != "" && other.ISIN == instrument.ISIN {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryAmount formats an amount as NUMERIC(18, 4) returns it
+func memoryAmount(value string) string {
+	if value == "" {
+		return ""
+	}
+	return decimal.MustParse(value).StringFixed(decimal.AmountScale, decimal.RoundHalfUp)
+}
+
+func (m *memoryInstruments) Create(instrument models.Instrument) (*models.Instrument, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	return m.create(instrument)
+}
+
+func (m *memoryInstruments) Update(instrument models.Instrument) (*models.Instrument, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	return m.update(instrument)
+}
+
+func (m *memoryInstruments) Upsert(instrument models.Instrument) (bool, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	if _, ok := m.s.data.instruments[instrument.StockSymbol]; ok {
+		_, err := m.update(instrument)
+		return false, err
+	}
+	_, err := m.create(instrument)
+	return err == nil, err
+}
+
+func (m *memoryInstruments) create(instrument models.Instrument) (*models.Instrument, error) {
+	if _, ok := m.s.data.instruments[instrument.StockSymbol]; ok {
+		return nil, ErrExists
+	}
+	if m.s.data.isinTaken(instrument) {
+		return nil, ErrISINTaken
+	}
+	instrument.FaceValue = memoryAmount(instrument.FaceValue)
+	instrument.TickSize = memoryAmount(instrument.TickSize)
+	instrument.ValuationRule = "CARRY_FORWARD"
+	instrument.StatusReason = ""
+	instrument.StatusChangedAt = m.s.now()
+	m.s.data.instruments[instrument.StockSymbol] = instrument
+	return &instrument, nil
+}
+
+func (m *memoryInstruments) update(instrument models.Instrument) (*models.Instrument, error) {
+	existing, ok := m.s.data.instruments[instrument.StockSymbol]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if m.s.data.isinTaken(instrument) {
+		return nil, ErrISINTaken
+	}
+	existing.ISIN = instrument.ISIN
+	existing.Exchange = instrument.Exchange
+	existing.CompanyName = instrument.CompanyName
+	existing.Sector = instrument.Sector
+	existing.FaceValue = memoryAmount(instrument.FaceValue)
+	existing.TickSize = memoryAmount(instrument.TickSize)
+	m.s.data.instruments[instrument.StockSymbol] = existing
+	return &existing, nil
+}
+
+func (m *memoryInstruments) SetStatus(stockSymbol, status, valuationRule, reason string) (*models.Instrument, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	instrument, ok := m.s.data.instruments[stockSymbol]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if instrument.Status != status {
+		instrument.StatusChangedAt = m.s.now()
+	}
+	instrument.Status = status
+	instrument.ValuationRule = valuationRule
+	instrument.StatusReason = reason
+	m.s.data.instruments[stockSymbol] = instrument
+	return &instrument, nil
+}
+
+func (m *memoryInstruments) Delete(stockSymbol string) error {
+	m.s.lock()
+	defer m.s.unlock()
+	if _, ok := m.s.data.instruments[stockSymbol]; !ok {
+		return ErrNotFound
+	}
+	for _, reward := range m.s.data.rewards {
+		if reward.StockSymbol == stockSymbol {
+			return ErrInUse
+		}
+	}
+	for _, price := range m.s.data.prices {
+		if price.StockSymbol == stockSymbol {
+			return ErrInUse
+		}
+	}
+	for _, action := range m.s.data.actions {
+		if action.StockSymbol == stockSymbol || action.NewStockSymbol == stockSymbol {
+			return ErrInUse
+		}
+	}
+	delete(m.s.data.instruments, stockSymbol)
+	return nil
+}
+
+type memoryCorporateActions struct {
+	s *MemoryStore
+}
+
+func (m *memoryCorporateActions) Create(action *models.CorporateAction) error {
+	from, err := decimal.Parse(action.RatioFrom)
+	if err != nil {
+		return err
+	}
+	to, err := decimal.Parse(action.RatioTo)
+	if err != nil {
+		return err
+	}
+
+	m.s.lock()
+	defer m.s.unlock()
+	action.ID = uuid.New().String()
+	action.Status = corporateActionPending
+	action.CreatedAt = m.s.now()
+	stored := *action
+	// As NUMERIC(18, 6) returns them
+	stored.RatioFrom = from.StringFixed(decimal.QuantityScale, decimal.RoundHalfUp)
+	stored.RatioTo = to.StringFixed(decimal.QuantityScale, decimal.RoundHalfUp)
+	m.s.data.actions = append(m.s.data.actions, stored)
+	return nil
+}
+
+func (m *memoryCorporateActions) List(stockSymbol string) ([]models.CorporateAction, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	actions := []models.CorporateAction{}
+	for _, action := range m.s.data.actions {
+		if stockSymbol == "" || action.StockSymbol == stockSymbol || action.NewStockSymbol == stockSymbol {
+			actions = append(actions, action)
+		}
+	}
+	sort.SliceStable(actions, func(i, j int) bool {
+		if actions[i].EffectiveDate != actions[j].EffectiveDate {
+			return actions[i].EffectiveDate > actions[j].EffectiveDate
+		}
+		return actions[i].CreatedAt.After(actions[j].CreatedAt)
+	})
+	return actions, nil
+}
+
+func (m *memoryCorporateActions) Due(date string) ([]string, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	var due []models.CorporateAction
+	for _, action := range m.s.data.actions {
+		if action.Status == corporateActionPending && action.EffectiveDate <= date {
+			due = append(due, action)
+		}
+	}
+	// Stable, so actions created at the same instant keep the order they were created in
+	sort.SliceStable(due, func(i, j int) bool { return due[i].EffectiveDate < due[j].EffectiveDate })
+	ids := make([]string, len(due))
+	for i, action := range due {
+		ids[i] = action.ID
+	}
+	return ids, nil
+}
+
+func (m *memoryCorporateActions) GetForUpdate(id string) (*models.CorporateAction, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	for _, action := range m.s.data.actions {
+		if action.ID == id {
+			return &action, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *memoryCorporateActions) Holders(stockSymbol string, at time.Time) ([]UserHolding, error) {
+	m.s.lock()
+	defer m.s.unlock()
+
+	seen := make(map[string]bool)
+	var userIDs []string
+	for _, reward := range m.s.data.rewards {
+		if !seen[reward.UserID] {
+			seen[reward.UserID] = true
+			userIDs = append(userIDs, reward.UserID)
+		}
+	}
+	for _, a := range m.s.data.actionAdjs {
+		if !seen[a.userID] {
+			seen[a.userID] = true
+			userIDs = append(userIDs, a.userID)
+		}
+	}
+	sort.Strings(userIDs)
+
+	var holders []UserHolding
+	for _, userID := range userIDs {
+		holdings := sumHoldings(m.s.data.movements(userID), func(mv movement) bool {
+			return mv.stockSymbol == stockSymbol &&
+				(mv.effectiveAt.Before(at) || (mv.corporateAction && !mv.effectiveAt.After(at)))
+		}, false)
+		for _, h := range holdings {
+			if decimal.MustParse(h.Quantity).Sign() > 0 {
+				holders = append(holders, UserHolding{UserID: userID, Quantity: h.Quantity})
+			}
+		}
+	}
+	return holders, nil
+}
+
+func (m *memoryCorporateActions) CreateAdjustment(actionID, userID, stockSymbol, quantity string, effectiveAt time.Time) error {
+	qty, err := decimal.Parse(quantity)
+	if err != nil {
+		return err
+	}
+
+	m.s.lock()
+	defer m.s.unlock()
+	m.s.data.actionAdjs = append(m.s.data.actionAdjs, actionAdjustment{actionID, userID, stockSymbol, qty, effectiveAt})
+	return nil
+}
+
+func (m *memoryCorporateActions) MarkApplied(id string) (time.Time, error) {
+	m.s.lock()
+	defer m.s.unlock()
+	for i := range m.s.data.actions {
+		if m.s.data.actions[i].ID == id {
+			now := m.s.now()
+			m.s.data.actions[i].Status = corporateActionApplied
+			m.s.data.actions[i].AppliedAt = &now
+			return now, nil
+		}
+	}
+	return time.Time{}, ErrNotFound
+}
+
+type memoryFeeSchedules struct {
+	s *MemoryStore
+}
+
+func (f *memoryFeeSchedules) At(exchange string, at time.Time) (*models.FeeSchedule, error) {
+	f.s.lock()
+	defer f.s.unlock()
+	date := at.Format("2006-01-02")
+	var found *models.FeeSchedule
+	for i, schedule := range f.s.data.feeSchedules {
+		if schedule.Exchange != exchange || schedule.EffectiveFrom > date {
+			continue
+		}
+		if found == nil || schedule.EffectiveFrom > found.EffectiveFrom {
+			found = &f.s.data.feeSchedules[i]
+		}
+	}
+	if found == nil {
+		return nil, ErrNotFound
+	}
+	schedule := *found
+	return &schedule, nil
+}
+
+func (f *memoryFeeSchedules) List(exchange string) ([]models.FeeSchedule, error) {
+	f.s.lock()
+	defer f.s.unlock()
+	schedules := []models.FeeSchedule{}
+	for _, schedule := range f.s.data.feeSchedules {
+		if exchange == "" || schedule.Exchange == exchange {
+			schedules = append(schedules, schedule)
+		}
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		if schedules[i].Exchange != schedules[j].Exchange {
+			return schedules[i].Exchange < schedules[j].Exchange
+		}
+		return schedules[i].EffectiveFrom > schedules[j].EffectiveFrom
+	})
+	return schedules, nil
+}
+
+func (f *memoryFeeSchedules) Create(schedule *models.FeeSchedule) error {
+	// As NUMERIC(10, 6) and NUMERIC(18, 4) return them
+	rate := func(value string) string {
+		return decimal.MustParse(value).StringFixed(decimal.QuantityScale, decimal.RoundHalfUp)
+	}
+	stored := *schedule
+	stored.BrokerageRate = rate(schedule.BrokerageRate)
+	stored.BrokerageMin = memoryAmount(schedule.BrokerageMin)
+	stored.BrokerageMax = memoryAmount(schedule.BrokerageMax)
+	stored.STTRate = rate(schedule.STTRate)
+	stored.GSTRate = rate(schedule.GSTRate)
+	stored.OtherFeesFlat = memoryAmount(schedule.OtherFeesFlat)
+
+	f.s.lock()
+	defer f.s.unlock()
+	for _, existing := range f.s.data.feeSchedules {
+		if existing.Exchange == schedule.Exchange && existing.EffectiveFrom == schedule.EffectiveFrom {
+			return ErrExists
+		}
+	}
+	schedule.ID = uuid.New().String()
+	schedule.CreatedAt = f.s.now()
+	stored.ID, stored.CreatedAt = schedule.ID, schedule.CreatedAt
+	f.s.data.feeSchedules = append(f.s.data.feeSchedules, stored)
+	return nil
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"errors"
+	"stocky/internal/models"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreInTxRollback(t *testing.T) {
+	store := NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "TCS", Status: "ACTIVE", Exchange: "NSE"})
+	failure := errors.New("fail")
+
+	err := store.InTx(func(tx Store) error {
+		if err := tx.Rewards().Create(&models.RewardEvent{ID: "r1", UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "evt-1", RewardTimestamp: time.Now()}); err != nil {
+			return err
+		}
+		if err := tx.Prices().Save("TCS", "3500.0000", time.Now()); err != nil {
+			return err
+		}
+		// Nested transactions join the outer one, so this is undone with it
+		if err := tx.InTx(func(tx Store) error { return tx.Snapshots().Invalidate("u1", "2024-01-01") }); err != nil {
+			return err
+		}
+		return failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("InTx err = %v, want %v", err, failure)
+	}
+
+	if _, err := store.Rewards().GetByEventID("evt-1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("reward survived the rollback: err = %v", err)
+	}
+	if _, err := store.Prices().Latest("TCS"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("price survived the rollback: err = %v", err)
+	}
+	if invalidations, _ := store.Snapshots().Invalidations(); len(invalidations) != 0 {
+		t.Errorf("invalidations survived the rollback: %+v", invalidations)
+	}
+}
+
+func TestMemoryStoreInTxCommit(t *testing.T) {
+	store := NewMemoryStore()
+
+	err := store.InTx(func(tx Store) error {
+		return tx.Rewards().Create(&models.RewardEvent{ID: "r1", UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "evt-1", RewardTimestamp: time.Now()})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Rewards().GetByEventID("evt-1"); err != nil {
+		t.Errorf("committed reward not found: %v", err)
+	}
+}
+
+func TestMemoryStoreNestedInTxRollback(t *testing.T) {
+	store := NewMemoryStore()
+	failure := errors.New("fail")
+
+	err := store.InTx(func(tx Store) error {
+		if err := tx.Rewards().Create(&models.RewardEvent{ID: "r1", UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "evt-1", RewardTimestamp: time.Now()}); err != nil {
+			return err
+		}
+		// Like a savepoint, a failed nested call only undoes its own writes
+		err := tx.InTx(func(tx Store) error {
+			if err := tx.Rewards().Create(&models.RewardEvent{ID: "r2", UserID: "u2", StockSymbol: "TCS", Quantity: "1", EventID: "evt-2", RewardTimestamp: time.Now()}); err != nil {
+				return err
+			}
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Errorf("nested InTx err = %v, want %v", err, failure)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Rewards().GetByEventID("evt-1"); err != nil {
+		t.Errorf("outer write lost: %v", err)
+	}
+	if _, err := store.Rewards().GetByEventID("evt-2"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("failed nested write survived: err = %v", err)
+	}
+}
@@ -0,0 +1,962 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"stocky/internal/models"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// PostgresStore is the Store backed by the application database
+type PostgresStore struct {
+	db    *sql.DB        // Nil once inside a transaction
+	conn  ContextQuerier // db, or the transaction
+	ctx   context.Context
+	depth int // Nesting level inside the transaction, naming its savepoints
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db, conn: db, ctx: context.Background()}
+}
+
+func (s *PostgresStore) q() Querier { return WithContext(s.ctx, s.conn) }
+
+func (s *PostgresStore) Rewards() RewardRepository         { return NewPostgresRewards(s.q()) }
+func (s *PostgresStore) Ledger() LedgerRepository          { return NewPostgresLedger(s.q()) }
+func (s *PostgresStore) Prices() PriceRepository           { return NewPostgresPrices(s.q()) }
+func (s *PostgresStore) Snapshots() SnapshotRepository     { return NewPostgresSnapshots(s.q()) }
+func (s *PostgresStore) Instruments() InstrumentRepository { return NewPostgresInstruments(s.q()) }
+func (s *PostgresStore) CorporateActions() CorporateActionRepository {
+	return NewPostgresCorporateActions(s.q())
+}
+func (s *PostgresStore) FeeSchedules() FeeScheduleRepository { return NewPostgresFeeSchedules(s.q()) }
+
+func (s *PostgresStore) WithContext(ctx context.Context) Store {
+	return &PostgresStore{db: s.db, conn: s.conn, ctx: ctx, depth: s.depth}
+}
+
+func (s *PostgresStore) InTx(fn func(tx Store) error) error {
+	if s.db == nil {
+		return s.inSavepoint(fn)
+	}
+
+	tx, err := s.db.BeginTx(s.ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(&PostgresStore{conn: tx, ctx: s.ctx}); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// inSavepoint runs a nested InTx. Rolling back to the savepoint when fn fails undoes its
+// writes and clears the aborted state an error leaves the transaction in, so the caller
+// can carry on with the transaction.
+func (s *PostgresStore) inSavepoint(fn func(tx Store) error) error {
+	savepoint := fmt.Sprintf("nested_%d", s.depth+1)
+	if _, err := s.conn.ExecContext(s.ctx, "SAVEPOINT "+savepoint); err != nil {
+		return err
+	}
+
+	if err := fn(&PostgresStore{conn: s.conn, ctx: s.ctx, depth: s.depth + 1}); err != nil {
+		if _, rollbackErr := s.conn.ExecContext(s.ctx, "ROLLBACK TO SAVEPOINT "+savepoint); rollbackErr != nil {
+			return fmt.Errorf("%w (rolling back to savepoint: %v)", err, rollbackErr)
+		}
+		return err
+	}
+	_, err := s.conn.ExecContext(s.ctx, "RELEASE SAVEPOINT "+savepoint)
+	return err
+}
+
+// PostgresRewards implements RewardRepository
+type PostgresRewards struct {
+	q Querier
+}
+
+func NewPostgresRewards(q Querier) *PostgresRewards {
+	return &PostgresRewards{q: q}
+}
+
+func (r *PostgresRewards) GetByEventID(eventID string) (*models.RewardEvent, error) {
+	var reward models.RewardEvent
+	err := r.q.QueryRow(`
+		SELECT id, user_id, stock_symbol, quantity, reward_timestamp, event_id,
+		       COALESCE(exchange, ''), COALESCE(fee_schedule_id::TEXT, ''), COALESCE(payload_hash, ''),
+		       created_at, updated_at
+		FROM reward_events
+		WHERE event_id = $1
+	`, eventID).Scan(&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity, &reward.RewardTimestamp, &reward.EventID,
+		&reward.Exchange, &reward.FeeScheduleID, &reward.PayloadHash, &reward.CreatedAt, &reward.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+func (r *PostgresRewards) Create(reward *models.RewardEvent) error {
+	_, err := r.q.Exec(`
+		INSERT INTO reward_events (id, user_id, stock_symbol, quantity, reward_timestamp, event_id, exchange, fee_schedule_id, payload_hash)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, reward.ID, reward.UserID, reward.StockSymbol, reward.Quantity, reward.RewardTimestamp, reward.EventID,
+		reward.Exchange, nullString(reward.FeeScheduleID), nullString(reward.PayloadHash))
+	return err
+}
+
+func (r *PostgresRewards) GetForUpdate(id string) (*models.RewardEvent, error) {
+	var reward models.RewardEvent
+	err := r.q.QueryRow(`
+		SELECT id, user_id, stock_symbol, quantity, reward_timestamp, event_id,
+		       COALESCE(exchange, ''), COALESCE(fee_schedule_id::TEXT, ''), created_at, updated_at
+		FROM reward_events
+		WHERE id = $1
+		FOR UPDATE
+	`, id).Scan(&reward.ID, &reward.UserID, &reward.StockSymbol, &reward.Quantity, &reward.RewardTimestamp, &reward.EventID,
+		&reward.Exchange, &reward.FeeScheduleID, &reward.CreatedAt, &reward.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &reward, nil
+}
+
+func (r *PostgresRewards) AdjustedQuantity(rewardID string) (string, error) {
+	var adjusted string
+	err := r.q.QueryRow(`
+		SELECT COALESCE(SUM(quantity), 0) FROM reward_adjustments
+		WHERE reward_event_id = $1
+	`, rewardID).Scan(&adjusted)
+	return adjusted, err
+}
+
+func (r *PostgresRewards) CreateAdjustment(adjustment *models.RewardAdjustment) error {
+	return r.q.QueryRow(`
+		INSERT INTO reward_adjustments (reward_event_id, adjustment_type, quantity, reason)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`, adjustment.RewardEventID, adjustment.AdjustmentType, adjustment.Quantity, adjustment.Reason).
+		Scan(&adjustment.ID, &adjustment.CreatedAt)
+}
+
+func (r *PostgresRewards) RestatedAfter(stockSymbol string, since time.Time) (bool, error) {
+	var restated bool
+	err := r.q.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM corporate_actions
+			WHERE stock_symbol = $1 AND status = $2 AND effective_date > $3
+		)
+	`, stockSymbol, corporateActionApplied, since.Format("2006-01-02")).Scan(&restated)
+	return restated, err
+}
+
+func (r *PostgresRewards) RewardsBetween(userID string, from, to time.Time) ([]models.TodayStock, error) {
+	rows, err := r.q.Query(`
+		SELECT stock_symbol, SUM(quantity) AS quantity, rewarded_at
+		FROM holding_movements
+		WHERE user_id = $1
+		AND rewarded_at >= $2 AND rewarded_at < $3
+		GROUP BY reward_event_id, stock_symbol, rewarded_at
+		HAVING SUM(quantity) <> 0
+		ORDER BY rewarded_at DESC
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var stocks []models.TodayStock
+	for rows.Next() {
+		var stock models.TodayStock
+		var timestamp time.Time
+		if err := rows.Scan(&stock.StockSymbol, &stock.Quantity, &timestamp); err != nil {
+			return nil, err
+		}
+		stock.RewardedAt = timestamp.In(from.Location()).Format(time.RFC3339)
+		stocks = append(stocks, stock)
+	}
+	return stocks, rows.Err()
+}
+
+func (r *PostgresRewards) RewardedQuantitiesBetween(userID string, from, to time.Time) (map[string]string, error) {
+	rows, err := r.q.Query(`
+		SELECT stock_symbol, SUM(quantity) as total_quantity
+		FROM holding_movements
+		WHERE user_id = $1
+		AND rewarded_at >= $2 AND rewarded_at < $3
+		GROUP BY stock_symbol
+		HAVING SUM(quantity) <> 0
+	`, userID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[string]string)
+	for rows.Next() {
+		var symbol, quantity string
+		if err := rows.Scan(&symbol, &quantity); err != nil {
+			return nil, err
+		}
+		quantities[symbol] = quantity
+	}
+	return quantities, rows.Err()
+}
+
+func (r *PostgresRewards) Holdings(userID string, at time.Time) ([]Holding, error) {
+	return queryHoldings(r.q, `
+		SELECT stock_symbol, SUM(quantity) as total_quantity
+		FROM holding_movements
+		WHERE user_id = $1
+		AND effective_at <= $2
+		GROUP BY stock_symbol
+		HAVING SUM(quantity) <> 0
+	`, userID, at)
+}
+
+func (r *PostgresRewards) HoldingsBefore(userID string, end time.Time) ([]Holding, error) {
+	return queryHoldings(r.q, `
+		SELECT stock_symbol, SUM(quantity) as total_quantity
+		FROM holding_movements
+		WHERE user_id = $1
+		AND effective_at < $2
+		GROUP BY stock_symbol
+	`, userID, end)
+}
+
+func queryHoldings(q Querier, query string, args ...interface{}) ([]Holding, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holdings []Holding
+	for rows.Next() {
+		var h Holding
+		if err := rows.Scan(&h.StockSymbol, &h.Quantity); err != nil {
+			return nil, err
+		}
+		holdings = append(holdings, h)
+	}
+	return holdings, rows.Err()
+}
+
+func (r *PostgresRewards) UserIDs() ([]string, error) {
+	return queryStrings(r.q, `SELECT DISTINCT user_id FROM reward_events`)
+}
+
+func queryStrings(q Querier, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []string
+	for rows.Next() {
+		var value string
+		if err := rows.Scan(&value); err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, rows.Err()
+}
+
+// PostgresLedger implements LedgerRepository
+type PostgresLedger struct {
+	q Querier
+}
+
+func NewPostgresLedger(q Querier) *PostgresLedger {
+	return &PostgresLedger{q: q}
+}
+
+// PostJournal writes the journal and its entries. Run it inside a transaction:
+// the database re-checks the balance at commit via a deferred constraint trigger.
+func (l *PostgresLedger) PostJournal(j models.Journal) (string, error) {
+	var journalID string
+	err := l.q.QueryRow(`
+		INSERT INTO journals (journal_type, reward_event_id, adjustment_id, corporate_action_id, description)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id
+	`, j.JournalType, nullString(j.RewardEventID), nullString(j.AdjustmentID), nullString(j.CorporateActionID), j.Description).Scan(&journalID)
+	if err != nil {
+		return "", err
+	}
+
+	accountTypes := make(map[string]string)
+	for _, line := range j.Lines {
+		accountType, ok := accountTypes[line.AccountCode]
+		if !ok {
+			accountType, err = l.resolveAccount(line.AccountCode)
+			if err != nil {
+				return "", err
+			}
+			accountTypes[line.AccountCode] = accountType
+		}
+
+		_, err = l.q.Exec(`
+			INSERT INTO ledger_entries (id, journal_id, reward_event_id, adjustment_id, corporate_action_id, entry_type, account_code, account_type, side, stock_symbol, quantity, amount, description)
+			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		`, journalID, nullString(j.RewardEventID), nullString(j.AdjustmentID), nullString(j.CorporateActionID),
+			line.EntryType, line.AccountCode, accountType, line.Side, nullString(line.StockSymbol), nullString(line.Quantity),
+			line.Amount.String(), line.Description)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return journalID, nil
+}
+
+// resolveAccount returns the reporting account_type of an account, opening
+// per-symbol sub-accounts from their parent on first use
+func (l *PostgresLedger) resolveAccount(code string) (string, error) {
+	if parent, symbol, ok := strings.Cut(code, ":"); ok {
+		_, err := l.q.Exec(`
+			INSERT INTO accounts (code, name, account_class, account_type, parent_code, stock_symbol)
+			SELECT $1, p.name || ' - ' || $2::VARCHAR, p.account_class, p.account_type, p.code, $2
+			FROM accounts p
+			WHERE p.code = $3
+			ON CONFLICT (code) DO NOTHING
+		`, code, symbol, parent)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	var accountType string
+	var active bool
+	err := l.q.QueryRow(`
+		SELECT account_type, is_active FROM accounts WHERE code = $1
+	`, code).Scan(&accountType, &active)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("%w: %s", ErrUnknownAccount, code)
+	}
+	if err != nil {
+		return "", err
+	}
+	if !active {
+		return "", fmt.Errorf("%w: %s is closed", ErrUnknownAccount, code)
+	}
+
+	return accountType, nil
+}
+
+func (l *PostgresLedger) RewardEntries(rewardID string) ([]models.LedgerEntry, error) {
+	rows, err := l.q.Query(`
+		SELECT id, reward_event_id, journal_id, adjustment_id, entry_type, account_code, account_type,
+		       side, stock_symbol, quantity, amount, description, created_at
+		FROM ledger_entries
+		WHERE reward_event_id = $1
+		ORDER BY adjustment_id NULLS FIRST, created_at
+	`, rewardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.LedgerEntry
+	for rows.Next() {
+		var e models.LedgerEntry
+		err := rows.Scan(&e.ID, &e.RewardEventID, &e.JournalID, &e.AdjustmentID, &e.EntryType, &e.AccountCode, &e.AccountType,
+			&e.Side, &e.StockSymbol, &e.Quantity, &e.Amount, &e.Description, &e.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+func (l *PostgresLedger) AccountTotals(from, to time.Time) ([]AccountTotal, error) {
+	rows, err := l.q.Query(`
+		SELECT account_type,
+		       COALESCE(SUM(amount) FILTER (WHERE side = 'DEBIT'), 0) AS debits,
+		       COALESCE(SUM(amount) FILTER (WHERE side = 'CREDIT'), 0) AS credits
+		FROM ledger_entries
+		WHERE created_at >= $1 AND created_at < $2
+		GROUP BY account_type
+		ORDER BY account_type
+	`, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var totals []AccountTotal
+	for rows.Next() {
+		var t AccountTotal
+		if err := rows.Scan(&t.AccountType, &t.Debits, &t.Credits); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// PostgresPrices implements PriceRepository
+type PostgresPrices struct {
+	q Querier
+}
+
+func NewPostgresPrices(q Querier) *PostgresPrices {
+	return &PostgresPrices{q: q}
+}
+
+func (p *PostgresPrices) Latest(stockSymbol string) (*models.StockPrice, error) {
+	price := &models.StockPrice{StockSymbol: stockSymbol}
+	err := p.q.QueryRow(`
+		SELECT id, price, price_timestamp, created_at FROM stock_prices
+		WHERE stock_symbol = $1
+		ORDER BY price_timestamp DESC
+		LIMIT 1
+	`, stockSymbol).Scan(&price.ID, &price.Price, &price.PriceTimestamp, &price.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+func (p *PostgresPrices) LatestBefore(stockSymbol string, end time.Time) (string, error) {
+	return p.price(`
+		SELECT price FROM stock_prices
+		WHERE stock_symbol = $1
+		AND price_timestamp < $2
+		ORDER BY price_timestamp DESC
+		LIMIT 1
+	`, stockSymbol, end)
+}
+
+func (p *PostgresPrices) price(query string, args ...interface{}) (string, error) {
+	var price string
+	err := p.q.QueryRow(query, args...).Scan(&price)
+	if err == sql.ErrNoRows {
+		return "", ErrNotFound
+	}
+	return price, err
+}
+
+func (p *PostgresPrices) Save(stockSymbol, price string, at time.Time) error {
+	_, err := p.q.Exec(`
+		INSERT INTO stock_prices (stock_symbol, price, price_timestamp)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (stock_symbol, price_timestamp) DO UPDATE
+		SET price = EXCLUDED.price
+	`, stockSymbol, price, at)
+	return err
+}
+
+func (p *PostgresPrices) Instrument(stockSymbol string) (*models.Instrument, error) {
+	instrument := &models.Instrument{StockSymbol: stockSymbol}
+	err := p.q.QueryRow(`
+		SELECT COALESCE(isin, ''), COALESCE(exchange, ''), COALESCE(company_name, ''), COALESCE(sector, ''),
+		       COALESCE(face_value::TEXT, ''), COALESCE(tick_size::TEXT, ''),
+		       status, valuation_rule, COALESCE(status_reason, ''), status_changed_at
+		FROM instruments
+		WHERE stock_symbol = $1
+	`, stockSymbol).Scan(&instrument.ISIN, &instrument.Exchange, &instrument.CompanyName, &instrument.Sector,
+		&instrument.FaceValue, &instrument.TickSize,
+		&instrument.Status, &instrument.ValuationRule, &instrument.StatusReason, &instrument.StatusChangedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return instrument, nil
+}
+
+func (p *PostgresPrices) TradingSymbols() ([]string, error) {
+	// Includes symbols introduced by corporate actions
+	return queryStrings(p.q, `
+		SELECT m.stock_symbol
+		FROM holding_movements m
+		LEFT JOIN instruments i ON i.stock_symbol = m.stock_symbol
+		WHERE COALESCE(i.status, $1) = $1
+		GROUP BY m.stock_symbol
+		HAVING SUM(m.quantity) <> 0
+	`, instrumentActive)
+}
+
+// PostgresSnapshots implements SnapshotRepository
+type PostgresSnapshots struct {
+	q Querier
+}
+
+func NewPostgresSnapshots(q Querier) *PostgresSnapshots {
+	return &PostgresSnapshots{q: q}
+}
+
+func (s *PostgresSnapshots) Save(snapshot models.PortfolioSnapshot) error {
+	_, err := s.q.Exec(`
+		INSERT INTO portfolio_snapshots (user_id, snapshot_date, stock_symbol, total_quantity, price_per_unit, total_inr_value)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (user_id, snapshot_date, stock_symbol) DO UPDATE
+		SET total_quantity = EXCLUDED.total_quantity,
+		    price_per_unit = EXCLUDED.price_per_unit,
+		    total_inr_value = EXCLUDED.total_inr_value
+	`, snapshot.UserID, snapshot.SnapshotDate.Format("2006-01-02"), snapshot.StockSymbol,
+		snapshot.TotalQuantity, snapshot.PricePerUnit, snapshot.TotalINRValue)
+	return err
+}
+
+func (s *PostgresSnapshots) DailyValues(userID, before string) ([]models.HistoricalINR, error) {
+	rows, err := s.q.Query(`
+		SELECT snapshot_date, SUM(total_inr_value) as daily_value
+		FROM portfolio_snapshots
+		WHERE user_id = $1
+		AND snapshot_date < $2
+		GROUP BY snapshot_date
+		ORDER BY snapshot_date DESC
+	`, userID, before)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var historical []models.HistoricalINR
+	for rows.Next() {
+		var h models.HistoricalINR
+		var date time.Time
+		if err := rows.Scan(&date, &h.Value); err != nil {
+			return nil, err
+		}
+		h.Date = date.Format("2006-01-02")
+		historical = append(historical, h)
+	}
+	return historical, rows.Err()
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+func (s *PostgresSnapshots) Invalidate(userID, from string) error {
+	_, err := s.q.Exec(`
+		INSERT INTO snapshot_invalidations (user_id, dirty_from, marked_at)
+		VALUES ($1, $2, clock_timestamp())
+		ON CONFLICT (user_id) DO UPDATE
+		SET dirty_from = LEAST(snapshot_invalidations.dirty_from, EXCLUDED.dirty_from),
+		    marked_at = EXCLUDED.marked_at
+	`, userID, from)
+	return err
+}
+
+func (s *PostgresSnapshots) Invalidations() ([]models.SnapshotInvalidation, error) {
+	rows, err := s.q.Query(`
+		SELECT user_id, dirty_from, marked_at
+		FROM snapshot_invalidations
+		ORDER BY dirty_from, user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var invalidations []models.SnapshotInvalidation
+	for rows.Next() {
+		var inv models.SnapshotInvalidation
+		var dirtyFrom time.Time
+		if err := rows.Scan(&inv.UserID, &dirtyFrom, &inv.MarkedAt); err != nil {
+			return nil, err
+		}
+		inv.DirtyFrom = dirtyFrom.Format("2006-01-02")
+		invalidations = append(invalidations, inv)
+	}
+	return invalidations, rows.Err()
+}
+
+func (s *PostgresSnapshots) ClearInvalidation(invalidation models.SnapshotInvalidation) error {
+	_, err := s.q.Exec(`
+		DELETE FROM snapshot_invalidations
+		WHERE user_id = $1 AND marked_at = $2
+	`, invalidation.UserID, invalidation.MarkedAt)
+	return err
+}
+
+// PostgresInstruments implements InstrumentRepository
+type PostgresInstruments struct {
+	q Querier
+}
+
+func NewPostgresInstruments(q Querier) *PostgresInstruments {
+	return &PostgresInstruments{q: q}
+}
+
+const instrumentColumns = `stock_symbol, COALESCE(isin, ''), COALESCE(exchange, ''), COALESCE(company_name, ''), COALESCE(sector, ''),
+		       COALESCE(face_value::TEXT, ''), COALESCE(tick_size::TEXT, ''),
+		       status, valuation_rule, COALESCE(status_reason, ''), status_changed_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanInstrument(row rowScanner) (*models.Instrument, error) {
+	var instrument models.Instrument
+	err := row.Scan(&instrument.StockSymbol, &instrument.ISIN, &instrument.Exchange, &instrument.CompanyName, &instrument.Sector,
+		&instrument.FaceValue, &instrument.TickSize,
+		&instrument.Status, &instrument.ValuationRule, &instrument.StatusReason, &instrument.StatusChangedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &instrument, nil
+}
+
+// instrumentError maps a write refused by the ISIN's unique index to ErrISINTaken,
+// so an ISIN claimed concurrently is reported like one claimed earlier
+func instrumentError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "idx_instruments_isin" {
+		return ErrISINTaken
+	}
+	return err
+}
+
+func (r *PostgresInstruments) List(status, exchange string) ([]models.Instrument, error) {
+	rows, err := r.q.Query(`
+		SELECT `+instrumentColumns+`
+		FROM instruments
+		WHERE ($1 = '' OR status = $1) AND ($2 = '' OR exchange = $2)
+		ORDER BY stock_symbol
+	`, status, exchange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	instruments := []models.Instrument{}
+	for rows.Next() {
+		instrument, err := scanInstrument(rows)
+		if err != nil {
+			return nil, err
+		}
+		instruments = append(instruments, *instrument)
+	}
+	return instruments, rows.Err()
+}
+
+func (r *PostgresInstruments) GetByISIN(isin string) (*models.Instrument, error) {
+	instrument, err := scanInstrument(r.q.QueryRow(`SELECT `+instrumentColumns+` FROM instruments WHERE isin = $1`, isin))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return instrument, err
+}
+
+func (r *PostgresInstruments) Create(instrument models.Instrument) (*models.Instrument, error) {
+	created, err := scanInstrument(r.q.QueryRow(`
+		INSERT INTO instruments (stock_symbol, isin, exchange, company_name, sector, face_value, tick_size, status)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::NUMERIC, NULLIF($7, '')::NUMERIC, $8)
+		ON CONFLICT (stock_symbol) DO NOTHING
+		RETURNING `+instrumentColumns,
+		instrument.StockSymbol, instrument.ISIN, instrument.Exchange, instrument.CompanyName, instrument.Sector,
+		instrument.FaceValue, instrument.TickSize, instrument.Status))
+	if err == sql.ErrNoRows {
+		return nil, ErrExists
+	}
+	return created, instrumentError(err)
+}
+
+func (r *PostgresInstruments) Update(instrument models.Instrument) (*models.Instrument, error) {
+	updated, err := scanInstrument(r.q.QueryRow(`
+		UPDATE instruments
+		SET isin = $2,
+		    exchange = $3,
+		    company_name = $4,
+		    sector = NULLIF($5, ''),
+		    face_value = NULLIF($6, '')::NUMERIC,
+		    tick_size = NULLIF($7, '')::NUMERIC,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE stock_symbol = $1
+		RETURNING `+instrumentColumns,
+		instrument.StockSymbol, instrument.ISIN, instrument.Exchange, instrument.CompanyName, instrument.Sector,
+		instrument.FaceValue, instrument.TickSize))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return updated, instrumentError(err)
+}
+
+func (r *PostgresInstruments) Upsert(instrument models.Instrument) (bool, error) {
+	var created bool
+	err := r.q.QueryRow(`
+		INSERT INTO instruments (stock_symbol, isin, exchange, company_name, sector, face_value, tick_size, status)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, '')::NUMERIC, NULLIF($7, '')::NUMERIC, $8)
+		ON CONFLICT (stock_symbol) DO UPDATE
+		SET isin = EXCLUDED.isin,
+		    exchange = EXCLUDED.exchange,
+		    company_name = EXCLUDED.company_name,
+		    sector = EXCLUDED.sector,
+		    face_value = EXCLUDED.face_value,
+		    tick_size = EXCLUDED.tick_size,
+		    updated_at = CURRENT_TIMESTAMP
+		RETURNING xmax = 0
+	`, instrument.StockSymbol, instrument.ISIN, instrument.Exchange, instrument.CompanyName, instrument.Sector,
+		instrument.FaceValue, instrument.TickSize, instrument.Status).Scan(&created)
+	return created, instrumentError(err)
+}
+
+func (r *PostgresInstruments) SetStatus(stockSymbol, status, valuationRule, reason string) (*models.Instrument, error) {
+	instrument, err := scanInstrument(r.q.QueryRow(`
+		UPDATE instruments
+		SET status = $2,
+		    valuation_rule = $3,
+		    status_reason = $4,
+		    status_changed_at = CASE WHEN status = $2 THEN status_changed_at ELSE CURRENT_TIMESTAMP END,
+		    updated_at = CURRENT_TIMESTAMP
+		WHERE stock_symbol = $1
+		RETURNING `+instrumentColumns, stockSymbol, status, valuationRule, reason))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return instrument, err
+}
+
+func (r *PostgresInstruments) Delete(stockSymbol string) error {
+	result, err := r.q.Exec(`
+		DELETE FROM instruments
+		WHERE stock_symbol = $1
+		  AND NOT EXISTS (SELECT 1 FROM reward_events WHERE stock_symbol = $1)
+		  AND NOT EXISTS (SELECT 1 FROM stock_prices WHERE stock_symbol = $1)
+		  AND NOT EXISTS (SELECT 1 FROM corporate_actions WHERE stock_symbol = $1 OR new_stock_symbol = $1)
+	`, stockSymbol)
+	if err != nil {
+		return err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil || deleted > 0 {
+		return err
+	}
+
+	var exists bool
+	if err := r.q.QueryRow(`SELECT EXISTS (SELECT 1 FROM instruments WHERE stock_symbol = $1)`, stockSymbol).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrInUse
+	}
+	return ErrNotFound
+}
+
+// PostgresCorporateActions implements CorporateActionRepository
+type PostgresCorporateActions struct {
+	q Querier
+}
+
+func NewPostgresCorporateActions(q Querier) *PostgresCorporateActions {
+	return &PostgresCorporateActions{q: q}
+}
+
+const corporateActionColumns = `id, action_type, stock_symbol, COALESCE(new_stock_symbol, ''), ratio_from, ratio_to,
+		       effective_date, COALESCE(description, ''), status, applied_at, created_at`
+
+func scanCorporateAction(row rowScanner) (*models.CorporateAction, error) {
+	var action models.CorporateAction
+	var effectiveDate time.Time
+	var appliedAt sql.NullTime
+	err := row.Scan(
+		&action.ID, &action.ActionType, &action.StockSymbol, &action.NewStockSymbol,
+		&action.RatioFrom, &action.RatioTo, &effectiveDate, &action.Description,
+		&action.Status, &appliedAt, &action.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	action.EffectiveDate = effectiveDate.Format("2006-01-02")
+	if appliedAt.Valid {
+		action.AppliedAt = &appliedAt.Time
+	}
+	return &action, nil
+}
+
+func (r *PostgresCorporateActions) Create(action *models.CorporateAction) error {
+	action.Status = corporateActionPending
+	return r.q.QueryRow(`
+		INSERT INTO corporate_actions (action_type, stock_symbol, new_stock_symbol, ratio_from, ratio_to, effective_date, description, status)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8)
+		RETURNING id, created_at
+	`, action.ActionType, action.StockSymbol, action.NewStockSymbol, action.RatioFrom, action.RatioTo,
+		action.EffectiveDate, action.Description, action.Status).Scan(&action.ID, &action.CreatedAt)
+}
+
+func (r *PostgresCorporateActions) List(stockSymbol string) ([]models.CorporateAction, error) {
+	rows, err := r.q.Query(`
+		SELECT `+corporateActionColumns+`
+		FROM corporate_actions
+		WHERE $1 = '' OR stock_symbol = $1 OR new_stock_symbol = $1
+		ORDER BY effective_date DESC, created_at DESC
+	`, stockSymbol)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	actions := []models.CorporateAction{}
+	for rows.Next() {
+		action, err := scanCorporateAction(rows)
+		if err != nil {
+			return nil, err
+		}
+		actions = append(actions, *action)
+	}
+	return actions, rows.Err()
+}
+
+func (r *PostgresCorporateActions) Due(date string) ([]string, error) {
+	return queryStrings(r.q, `
+		SELECT id FROM corporate_actions
+		WHERE status = $1 AND effective_date <= $2
+		ORDER BY effective_date, created_at
+	`, corporateActionPending, date)
+}
+
+func (r *PostgresCorporateActions) GetForUpdate(id string) (*models.CorporateAction, error) {
+	action, err := scanCorporateAction(r.q.QueryRow(`
+		SELECT `+corporateActionColumns+`
+		FROM corporate_actions
+		WHERE id = $1
+		FOR UPDATE
+	`, id))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return action, err
+}
+
+func (r *PostgresCorporateActions) Holders(stockSymbol string, at time.Time) ([]UserHolding, error) {
+	rows, err := r.q.Query(`
+		SELECT user_id, SUM(quantity)
+		FROM holding_movements
+		WHERE stock_symbol = $1
+		AND (effective_at < $2 OR (source = 'CORPORATE_ACTION' AND effective_at <= $2))
+		GROUP BY user_id
+		HAVING SUM(quantity) > 0
+		ORDER BY user_id
+	`, stockSymbol, at)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var holders []UserHolding
+	for rows.Next() {
+		var h UserHolding
+		if err := rows.Scan(&h.UserID, &h.Quantity); err != nil {
+			return nil, err
+		}
+		holders = append(holders, h)
+	}
+	return holders, rows.Err()
+}
+
+func (r *PostgresCorporateActions) CreateAdjustment(actionID, userID, stockSymbol, quantity string, effectiveAt time.Time) error {
+	_, err := r.q.Exec(`
+		INSERT INTO corporate_action_adjustments (corporate_action_id, user_id, stock_symbol, quantity, effective_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, actionID, userID, stockSymbol, quantity, effectiveAt)
+	return err
+}
+
+func (r *PostgresCorporateActions) MarkApplied(id string) (time.Time, error) {
+	var appliedAt time.Time
+	err := r.q.QueryRow(`
+		UPDATE corporate_actions
+		SET status = $2, applied_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING applied_at
+	`, id, corporateActionApplied).Scan(&appliedAt)
+	return appliedAt, err
+}
+
+// PostgresFeeSchedules implements FeeScheduleRepository
+type PostgresFeeSchedules struct {
+	q Querier
+}
+
+func NewPostgresFeeSchedules(q Querier) *PostgresFeeSchedules {
+	return &PostgresFeeSchedules{q: q}
+}
+
+const feeScheduleColumns = `id, exchange, effective_from, brokerage_rate, brokerage_min, COALESCE(brokerage_max::TEXT, ''),
+		       stt_rate, gst_rate, other_fees_flat, COALESCE(description, ''), created_at`
+
+func scanFeeSchedule(row rowScanner) (*models.FeeSchedule, error) {
+	var schedule models.FeeSchedule
+	var effectiveFrom time.Time
+	err := row.Scan(&schedule.ID, &schedule.Exchange, &effectiveFrom, &schedule.BrokerageRate, &schedule.BrokerageMin,
+		&schedule.BrokerageMax, &schedule.STTRate, &schedule.GSTRate, &schedule.OtherFeesFlat, &schedule.Description, &schedule.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	schedule.EffectiveFrom = effectiveFrom.Format("2006-01-02")
+	return &schedule, nil
+}
+
+func (r *PostgresFeeSchedules) At(exchange string, at time.Time) (*models.FeeSchedule, error) {
+	schedule, err := scanFeeSchedule(r.q.QueryRow(`
+		SELECT `+feeScheduleColumns+`
+		FROM fee_schedules
+		WHERE exchange = $1 AND effective_from <= $2
+		ORDER BY effective_from DESC
+		LIMIT 1
+	`, exchange, at.Format("2006-01-02")))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotFound
+	}
+	return schedule, err
+}
+
+func (r *PostgresFeeSchedules) List(exchange string) ([]models.FeeSchedule, error) {
+	rows, err := r.q.Query(`
+		SELECT `+feeScheduleColumns+`
+		FROM fee_schedules
+		WHERE $1 = '' OR exchange = $1
+		ORDER BY exchange, effective_from DESC
+	`, exchange)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []models.FeeSchedule{}
+	for rows.Next() {
+		schedule, err := scanFeeSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, *schedule)
+	}
+	return schedules, rows.Err()
+}
+
+func (r *PostgresFeeSchedules) Create(schedule *models.FeeSchedule) error {
+	err := r.q.QueryRow(`
+		INSERT INTO fee_schedules (exchange, effective_from, brokerage_rate, brokerage_min, brokerage_max, stt_rate, gst_rate, other_fees_flat, description)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::NUMERIC, $6, $7, $8, $9)
+		ON CONFLICT (exchange, effective_from) DO NOTHING
+		RETURNING id, created_at
+	`, schedule.Exchange, schedule.EffectiveFrom, schedule.BrokerageRate, schedule.BrokerageMin, schedule.BrokerageMax,
+		schedule.STTRate, schedule.GSTRate, schedule.OtherFeesFlat, schedule.Description).Scan(&schedule.ID, &schedule.CreatedAt)
+	if err == sql.ErrNoRows {
+		return ErrExists
+	}
+	return err
+}
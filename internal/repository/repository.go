@@ -0,0 +1,232 @@
+// Package repository holds the persistence behind the reward, ledger, price,
+// snapshot, instrument, corporate action and fee services. Each repository has a Postgres implementation used in
+// production and an in-memory one for exercising business logic without a database.
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"stocky/internal/models"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("not found")
+	ErrUnknownAccount = errors.New("unknown ledger account")
+	ErrExists         = errors.New("already exists")
+	ErrISINTaken      = errors.New("isin already used by another instrument")
+	ErrInUse          = errors.New("in use")
+)
+
+// Querier is satisfied by both *sql.DB and *sql.Tx
+type Querier interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// ContextQuerier is the context-aware Querier, also satisfied by both *sql.DB and *sql.Tx
+type ContextQuerier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// WithContext returns a Querier whose queries run under ctx, so they are cancelled
+// when ctx is done
+func WithContext(ctx context.Context, q ContextQuerier) Querier {
+	return contextQuerier{ctx: ctx, q: q}
+}
+
+type contextQuerier struct {
+	ctx context.Context
+	q   ContextQuerier
+}
+
+func (c contextQuerier) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.q.ExecContext(c.ctx, query, args...)
+}
+
+func (c contextQuerier) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.q.QueryContext(c.ctx, query, args...)
+}
+
+func (c contextQuerier) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.q.QueryRowContext(c.ctx, query, args...)
+}
+
+// Store hands out the repositories and runs groups of writes atomically
+type Store interface {
+	Rewards() RewardRepository
+	Ledger() LedgerRepository
+	Prices() PriceRepository
+	Snapshots() SnapshotRepository
+	Instruments() InstrumentRepository
+	CorporateActions() CorporateActionRepository
+	FeeSchedules() FeeScheduleRepository
+
+	// InTx runs fn against repositories that share one transaction. If fn returns
+	// an error nothing it wrote is kept. Calling InTx inside fn reuses the transaction
+	// behind a savepoint, so a failed nested call only undoes its own writes.
+	InTx(fn func(tx Store) error) error
+	// WithContext returns the store with its queries, and transactions it begins, bound
+	// to ctx. Inside InTx the transaction is kept.
+	WithContext(ctx context.Context) Store
+}
+
+// Holding is a user's net quantity of one symbol
+type Holding struct {
+	StockSymbol string
+	Quantity    string
+}
+
+// RewardRepository stores reward events, their adjustments and the holdings derived from them
+type RewardRepository interface {
+	// GetByEventID returns the reward with the issuer's event_id, or ErrNotFound
+	GetByEventID(eventID string) (*models.RewardEvent, error)
+	Create(reward *models.RewardEvent) error
+	// GetForUpdate returns a reward and, inside InTx, locks it until the transaction ends
+	GetForUpdate(id string) (*models.RewardEvent, error)
+	// AdjustedQuantity is the signed sum of every adjustment to a reward
+	AdjustedQuantity(rewardID string) (string, error)
+	// CreateAdjustment records an adjustment and fills in its ID and CreatedAt
+	CreateAdjustment(adjustment *models.RewardAdjustment) error
+	// RestatedAfter reports whether an applied corporate action on the symbol took effect on
+	// a date after since's date in since's location
+	RestatedAfter(stockSymbol string, since time.Time) (bool, error)
+
+	// RewardsBetween lists a user's rewards granted in [from, to), net of adjustments,
+	// omitting those fully reversed. Newest first, timestamps in from's location.
+	RewardsBetween(userID string, from, to time.Time) ([]models.TodayStock, error)
+	// RewardedQuantitiesBetween is RewardsBetween summed per symbol
+	RewardedQuantitiesBetween(userID string, from, to time.Time) (map[string]string, error)
+	// Holdings returns the user's non-zero holdings as of at
+	Holdings(userID string, at time.Time) ([]Holding, error)
+	// HoldingsBefore returns the user's holdings from movements effective before end,
+	// including symbols that netted to zero
+	HoldingsBefore(userID string, end time.Time) ([]Holding, error)
+	// UserIDs lists every user that has been rewarded
+	UserIDs() ([]string, error)
+}
+
+// LedgerRepository stores journals and their ledger entries
+type LedgerRepository interface {
+	// PostJournal writes a journal and its entries, opening per-symbol accounts
+	// from their parent on first use. It does not check the journal balances.
+	PostJournal(journal models.Journal) (string, error)
+	// RewardEntries returns every entry posted for a reward, original entries first
+	RewardEntries(rewardID string) ([]models.LedgerEntry, error)
+	// AccountTotals sums the entries created in [from, to) per account type, ordered by account type
+	AccountTotals(from, to time.Time) ([]AccountTotal, error)
+}
+
+// AccountTotal is the debits and credits posted to one account type
+type AccountTotal struct {
+	AccountType string
+	Debits      string
+	Credits     string
+}
+
+// FeeScheduleRepository stores the effective-dated fee schedules of each exchange
+type FeeScheduleRepository interface {
+	// At returns the exchange's schedule in effect on at's date in at's location, or ErrNotFound
+	At(exchange string, at time.Time) (*models.FeeSchedule, error)
+	// List returns schedules by exchange, newest first, for one exchange or all of them when it is empty
+	List(exchange string) ([]models.FeeSchedule, error)
+	// Create inserts a schedule and fills in its ID and CreatedAt. It returns ErrExists when
+	// the exchange already has a schedule from the same date.
+	Create(schedule *models.FeeSchedule) error
+}
+
+// PriceRepository stores stock prices and the instrument status that governs valuation
+type PriceRepository interface {
+	// Latest returns the most recent price of a symbol and when it was taken, or ErrNotFound
+	Latest(stockSymbol string) (*models.StockPrice, error)
+	// LatestBefore returns the last price taken before end, or ErrNotFound
+	LatestBefore(stockSymbol string, end time.Time) (string, error)
+	Save(stockSymbol, price string, at time.Time) error
+	// Instrument returns the instrument master row, or ErrNotFound for symbols without one
+	Instrument(stockSymbol string) (*models.Instrument, error)
+	// TradingSymbols lists symbols someone holds whose instrument is active
+	TradingSymbols() ([]string, error)
+}
+
+// SnapshotRepository stores daily portfolio valuations
+type SnapshotRepository interface {
+	// Save inserts or replaces the snapshot for its user, date and symbol
+	Save(snapshot models.PortfolioSnapshot) error
+	// DailyValues sums a user's snapshots per date for dates before date (YYYY-MM-DD), newest first
+	DailyValues(userID, before string) ([]models.HistoricalINR, error)
+
+	// Invalidate marks the user's snapshots from date (YYYY-MM-DD) onwards for recomputation,
+	// keeping an earlier date already marked
+	Invalidate(userID, from string) error
+	// Invalidations lists the pending invalidations, earliest dirty date first
+	Invalidations() ([]models.SnapshotInvalidation, error)
+	// ClearInvalidation removes an invalidation unless it was marked again since it was read
+	ClearInvalidation(invalidation models.SnapshotInvalidation) error
+}
+
+// InstrumentRepository stores the instrument master. Single instruments are read
+// through PriceRepository.Instrument, which valuation shares.
+type InstrumentRepository interface {
+	// List returns instruments ordered by symbol, keeping only those with the given
+	// status and exchange when they are not empty
+	List(status, exchange string) ([]models.Instrument, error)
+	// GetByISIN returns the instrument holding an ISIN, or ErrNotFound
+	GetByISIN(isin string) (*models.Instrument, error)
+	// Create inserts an instrument valued CARRY_FORWARD. It returns ErrExists for a symbol
+	// already in the master and ErrISINTaken for an ISIN another symbol holds.
+	Create(instrument models.Instrument) (*models.Instrument, error)
+	// Update replaces an instrument's reference data, keeping its status, or returns
+	// ErrNotFound or ErrISINTaken
+	Update(instrument models.Instrument) (*models.Instrument, error)
+	// Upsert creates an instrument like Create, or replaces the reference data of an
+	// existing one like Update, and reports whether it was created
+	Upsert(instrument models.Instrument) (bool, error)
+	// SetStatus changes an instrument's status and valuation rule, moving StatusChangedAt
+	// only when the status changes, or returns ErrNotFound
+	SetStatus(stockSymbol, status, valuationRule, reason string) (*models.Instrument, error)
+	// Delete removes an instrument, or returns ErrInUse while rewards, prices or corporate
+	// actions refer to it and ErrNotFound when there is none
+	Delete(stockSymbol string) error
+}
+
+// UserHolding is one user's net quantity of a symbol
+type UserHolding struct {
+	UserID   string
+	Quantity string
+}
+
+// CorporateActionRepository stores corporate actions and the holding changes recorded
+// when they are applied, which count as movements towards holdings
+type CorporateActionRepository interface {
+	// Create records a pending action and fills in its ID, Status and CreatedAt
+	Create(action *models.CorporateAction) error
+	// List returns the actions involving a symbol, as old or new symbol, or every action
+	// when stockSymbol is empty, latest effective date first
+	List(stockSymbol string) ([]models.CorporateAction, error)
+	// Due lists the pending actions effective on or before date (YYYY-MM-DD) in the order they apply
+	Due(date string) ([]string, error)
+	// GetForUpdate returns an action and, inside InTx, locks it until the transaction ends,
+	// or returns ErrNotFound
+	GetForUpdate(id string) (*models.CorporateAction, error)
+	// Holders returns each user's positive holding of a symbol just before at. Changes from
+	// corporate actions effective at at are included, so actions on one date compose in the
+	// order they were applied.
+	Holders(stockSymbol string, at time.Time) ([]UserHolding, error)
+	// CreateAdjustment records a signed change to a user's holding made by an action
+	CreateAdjustment(actionID, userID, stockSymbol, quantity string, effectiveAt time.Time) error
+	// MarkApplied marks an action applied and returns when
+	MarkApplied(id string) (time.Time, error)
+}
+
+// instrumentActive is the status of symbols without an instruments row
+const instrumentActive = "ACTIVE"
+
+// Corporate action statuses
+const (
+	corporateActionPending = "PENDING"
+	corporateActionApplied = "APPLIED"
+)
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var ErrInvalidTimezone = errors.New("invalid timezone")
+
+var locations sync.Map // IANA name -> *time.Location
+
+// LoadLocation returns the IANA timezone called name, e.g. "Asia/Kolkata". "Local" is
+// refused: which day a reward falls on must not depend on where the server runs.
+func LoadLocation(name string) (*time.Location, error) {
+	if cached, ok := locations.Load(name); ok {
+		return cached.(*time.Location), nil
+	}
+	if name == "" || name == "Local" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTimezone, name)
+	}
+	locations.Store(name, loc)
+	return loc, nil
+}
+
+// dateIn returns the calendar date (YYYY-MM-DD) of t in loc
+func dateIn(t time.Time, loc *time.Location) string {
+	return t.In(loc).Format("2006-01-02")
+}
+
+// todayIn returns today's date (YYYY-MM-DD) in loc
+func todayIn(loc *time.Location) string {
+	return dateIn(time.Now(), loc)
+}
+
+// yesterdayIn returns yesterday's date in loc as a calendar date at UTC midnight,
+// the form RebuildSnapshots and BackfillSnapshots take dates in
+func yesterdayIn(loc *time.Location) time.Time {
+	now := time.Now().In(loc)
+	return time.Date(now.Year(), now.Month(), now.Day()-1, 0, 0, 0, 0, time.UTC)
+}
+
+// dayBounds returns the instants at which date (YYYY-MM-DD) starts and ends in loc.
+// Every day boundary is computed here; queries only compare instants against them.
+func dayBounds(date string, loc *time.Location) (time.Time, time.Time, error) {
+	start, err := time.ParseInLocation("2006-01-02", date, loc)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return start, start.AddDate(0, 0, 1), nil
+}
+
+// orLocation returns loc, or fallback when loc is nil
+func orLocation(loc, fallback *time.Location) *time.Location {
+	if loc == nil {
+		return fallback
+	}
+	return loc
+}
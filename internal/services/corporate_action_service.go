@@ -0,0 +1,331 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidCorporateAction  = errors.New("invalid corporate action")
+	ErrCorporateActionNotFound = errors.New("corporate action not found")
+	ErrCorporateActionApplied  = errors.New("corporate action already applied")
+	ErrCorporateActionNotDue   = errors.New("corporate action not yet effective")
+)
+
+const (
+	CorporateActionSplit        = "SPLIT"
+	CorporateActionBonus        = "BONUS"
+	CorporateActionSymbolChange = "SYMBOL_CHANGE"
+	CorporateActionMerger       = "MERGER"
+
+	corporateActionApplied = "APPLIED"
+)
+
+type CorporateActionService struct {
+	store            repository.Store
+	portfolioService *PortfolioService
+	location         *time.Location // Effective dates start at midnight in the business timezone
+	logger           *logrus.Logger
+}
+
+func NewCorporateActionService(store repository.Store, portfolioService *PortfolioService, location *time.Location, logger *logrus.Logger) *CorporateActionService {
+	return &CorporateActionService{
+		store:            store,
+		portfolioService: portfolioService,
+		location:         location,
+		logger:           logger,
+	}
+}
+
+// CreateCorporateAction records a pending corporate action.
+// Ratios read as ratio_from:ratio_to - a 1:5 split turns 1 share into 5,
+// a 1:2 bonus grants 2 shares for every 1 held, a 10:3 merger swaps 10 old shares for 3 new ones.
+func (s *CorporateActionService) CreateCorporateAction(ctx context.Context, actionType, stockSymbol, newStockSymbol, ratioFrom, ratioTo string, effectiveDate time.Time, description string) (*models.CorporateAction, error) {
+	actionType = strings.ToUpper(actionType)
+	stockSymbol = strings.ToUpper(stockSymbol)
+	newStockSymbol = strings.ToUpper(newStockSymbol)
+	if ratioFrom == "" {
+		ratioFrom = "1"
+	}
+	if ratioTo == "" {
+		ratioTo = "1"
+	}
+
+	from, err := decimal.Parse(ratioFrom)
+	if err != nil || from.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: ratio_from must be a positive number", ErrInvalidCorporateAction)
+	}
+	to, err := decimal.Parse(ratioTo)
+	if err != nil || to.Sign() <= 0 {
+		return nil, fmt.Errorf("%w: ratio_to must be a positive number", ErrInvalidCorporateAction)
+	}
+
+	switch actionType {
+	case CorporateActionSplit:
+		if from.Equal(to) {
+			return nil, fmt.Errorf("%w: split ratio must change the share count", ErrInvalidCorporateAction)
+		}
+		newStockSymbol = ""
+	case CorporateActionBonus:
+		newStockSymbol = ""
+	case CorporateActionSymbolChange, CorporateActionMerger:
+		if newStockSymbol == "" || newStockSymbol == stockSymbol {
+			return nil, fmt.Errorf("%w: new_stock_symbol must differ from stock_symbol", ErrInvalidCorporateAction)
+		}
+		if actionType == CorporateActionSymbolChange && !from.Equal(to) {
+			return nil, fmt.Errorf("%w: symbol change cannot carry a ratio", ErrInvalidCorporateAction)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown action_type %q", ErrInvalidCorporateAction, actionType)
+	}
+
+	store := s.store.WithContext(ctx)
+
+	// Both symbols must be in the instrument master, so a new symbol is added before
+	// the symbol change or merger that introduces it
+	for _, symbol := range []string{stockSymbol, newStockSymbol} {
+		if symbol == "" {
+			continue
+		}
+		if _, err := store.Prices().Instrument(symbol); errors.Is(err, repository.ErrNotFound) {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, symbol)
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	action := &models.CorporateAction{
+		ActionType:     actionType,
+		StockSymbol:    stockSymbol,
+		NewStockSymbol: newStockSymbol,
+		RatioFrom:      ratioFrom,
+		RatioTo:        ratioTo,
+		EffectiveDate:  effectiveDate.Format("2006-01-02"),
+		Description:    description,
+	}
+	if err := store.CorporateActions().Create(action); err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"corporate_action_id": action.ID,
+		"action_type":         actionType,
+		"stock_symbol":        stockSymbol,
+		"effective_date":      action.EffectiveDate,
+	}).Info("Corporate action recorded")
+
+	return action, nil
+}
+
+// ListCorporateActions returns corporate actions, optionally filtered by symbol
+func (s *CorporateActionService) ListCorporateActions(ctx context.Context, stockSymbol string) ([]models.CorporateAction, error) {
+	return s.store.WithContext(ctx).CorporateActions().List(strings.ToUpper(stockSymbol))
+}
+
+// ApplyDueActions applies every pending action whose effective date has been reached
+func (s *CorporateActionService) ApplyDueActions(ctx context.Context) error {
+	ids, err := s.store.WithContext(ctx).CorporateActions().Due(todayIn(s.location))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if _, err := s.ApplyCorporateAction(ctx, id); err != nil && !errors.Is(err, ErrCorporateActionApplied) {
+			return err
+		}
+	}
+	return nil
+}
+
+// holdingChange is a single signed change to one user's holding of one symbol
+type holdingChange struct {
+	userID      string
+	stockSymbol string
+	quantity    decimal.Decimal
+}
+
+// ApplyCorporateAction converts every holding of the action's symbol as of its
+// effective date into effective-dated adjustments and matching ledger entries,
+// then rebuilds any snapshots already written on or after that date.
+func (s *CorporateActionService) ApplyCorporateAction(ctx context.Context, id string) (*models.CorporateAction, error) {
+	var action *models.CorporateAction
+	var effectiveDate time.Time
+	var userIDs []string
+	err := s.store.WithContext(ctx).InTx(func(tx repository.Store) error {
+		var err error
+		action, err = tx.CorporateActions().GetForUpdate(id)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrCorporateActionNotFound
+		} else if err != nil {
+			return err
+		}
+		if action.Status == corporateActionApplied {
+			return ErrCorporateActionApplied
+		}
+
+		effectiveDate, err = time.Parse("2006-01-02", action.EffectiveDate)
+		if err != nil {
+			return err
+		}
+		if action.EffectiveDate > todayIn(s.location) {
+			return ErrCorporateActionNotDue
+		}
+		effectiveAt, _, err := dayBounds(action.EffectiveDate, s.location)
+		if err != nil {
+			return err
+		}
+
+		ratioFrom, err := decimal.Parse(action.RatioFrom)
+		if err != nil {
+			return err
+		}
+		ratioTo, err := decimal.Parse(action.RatioTo)
+		if err != nil {
+			return err
+		}
+
+		// Holdings just before the effective date. Earlier corporate actions on the
+		// same date are included so they compose in the order they were applied.
+		holders, err := tx.CorporateActions().Holders(action.StockSymbol, effectiveAt)
+		if err != nil {
+			return err
+		}
+
+		var changes []holdingChange
+		for _, holder := range holders {
+			held, err := decimal.Parse(holder.Quantity)
+			if err != nil {
+				return err
+			}
+			userChanges, err := corporateActionChanges(action, holder.UserID, held, ratioFrom, ratioTo)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, userChanges...)
+			userIDs = append(userIDs, holder.UserID)
+		}
+
+		// Corporate actions change share counts but not cost, so every leg is zero-valued.
+		// The user's stock liability and the stock inventory backing it move together.
+		lines := make([]models.JournalLine, 0, 2*len(changes))
+		for _, change := range changes {
+			err := tx.CorporateActions().CreateAdjustment(action.ID, change.userID, change.stockSymbol, change.quantity.String(), effectiveAt)
+			if err != nil {
+				return err
+			}
+
+			entryType, userSide := "CORPORATE_ACTION_CREDIT", SideCredit
+			if change.quantity.Sign() < 0 {
+				entryType, userSide = "CORPORATE_ACTION_DEBIT", SideDebit
+			}
+			quantity := change.quantity.Abs().String()
+			description := fmt.Sprintf("%s of %s for user %s", action.ActionType, action.StockSymbol, change.userID)
+			lines = append(lines,
+				models.JournalLine{
+					EntryType:   entryType,
+					AccountCode: SymbolAccount(AccountUserStockLiability, change.stockSymbol),
+					Side:        userSide,
+					StockSymbol: change.stockSymbol,
+					Quantity:    quantity,
+					Amount:      decimal.Zero(decimal.AmountScale),
+					Description: description,
+				},
+				models.JournalLine{
+					EntryType:   "INVENTORY_ADJUSTMENT",
+					AccountCode: SymbolAccount(AccountStockInventory, change.stockSymbol),
+					Side:        oppositeSide(userSide),
+					StockSymbol: change.stockSymbol,
+					Quantity:    quantity,
+					Amount:      decimal.Zero(decimal.AmountScale),
+					Description: description,
+				},
+			)
+		}
+
+		if len(lines) > 0 {
+			_, err = PostJournal(tx.Ledger(), models.Journal{
+				JournalType:       JournalTypeCorporateAction,
+				CorporateActionID: action.ID,
+				Description:       fmt.Sprintf("%s of %s effective %s", action.ActionType, action.StockSymbol, action.EffectiveDate),
+				Lines:             lines,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		appliedAt, err := tx.CorporateActions().MarkApplied(action.ID)
+		if err != nil {
+			return err
+		}
+		action.Status = corporateActionApplied
+		action.AppliedAt = &appliedAt
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"corporate_action_id": action.ID,
+		"action_type":         action.ActionType,
+		"stock_symbol":        action.StockSymbol,
+		"users":               len(userIDs),
+	}).Info("Corporate action applied")
+
+	// Snapshots from the effective date onwards were valued with pre-action holdings
+	yesterday := yesterdayIn(s.location)
+	if len(userIDs) > 0 && !effectiveDate.After(yesterday) {
+		if err := s.portfolioService.RebuildSnapshots(ctx, userIDs, effectiveDate, yesterday); err != nil {
+			s.logger.WithError(err).WithField("corporate_action_id", action.ID).Error("Failed to rebuild snapshots after corporate action")
+		}
+	}
+
+	return action, nil
+}
+
+// corporateActionChanges returns the holding changes an action causes for one user.
+// Fractional entitlements are truncated to NUMERIC(18, 6).
+func corporateActionChanges(action *models.CorporateAction, userID string, held, ratioFrom, ratioTo decimal.Decimal) ([]holdingChange, error) {
+	converted, err := held.Mul(ratioTo).Div(ratioFrom, decimal.QuantityScale, decimal.RoundDown)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []holdingChange
+	switch action.ActionType {
+	case CorporateActionSplit:
+		changes = append(changes, holdingChange{userID, action.StockSymbol, converted.Sub(held)})
+	case CorporateActionBonus:
+		changes = append(changes, holdingChange{userID, action.StockSymbol, converted})
+	case CorporateActionSymbolChange:
+		changes = append(changes,
+			holdingChange{userID, action.StockSymbol, held.Neg()},
+			holdingChange{userID, action.NewStockSymbol, held},
+		)
+	case CorporateActionMerger:
+		changes = append(changes,
+			holdingChange{userID, action.StockSymbol, held.Neg()},
+			holdingChange{userID, action.NewStockSymbol, converted},
+		)
+	default:
+		return nil, fmt.Errorf("%w: unknown action_type %q", ErrInvalidCorporateAction, action.ActionType)
+	}
+
+	// Drop no-op changes (e.g. a bonus too small to yield a whole unit at our precision)
+	filtered := changes[:0]
+	for _, change := range changes {
+		if !change.quantity.IsZero() {
+			filtered = append(filtered, change)
+		}
+	}
+	return filtered, nil
+}
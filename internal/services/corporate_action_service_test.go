@@ -0,0 +1,138 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestCorporateActionChanges(t *testing.T) {
+	tests := []struct {
+		name       string
+		actionType string
+		held       string
+		from, to   string
+		want       map[string]string // Symbol to signed change
+	}{
+		{"split 1:5", CorporateActionSplit, "3", "1", "5", map[string]string{"TCS": "12"}},
+		{"reverse split 10:1", CorporateActionSplit, "25", "10", "1", map[string]string{"TCS": "-22.5"}},
+		{"bonus 1:2", CorporateActionBonus, "4", "1", "2", map[string]string{"TCS": "8"}},
+		{"symbol change", CorporateActionSymbolChange, "4.5", "1", "1", map[string]string{"TCS": "-4.5", "INFY": "4.5"}},
+		{"merger 10:3", CorporateActionMerger, "10", "10", "3", map[string]string{"TCS": "-10", "INFY": "3"}},
+		// 7 * 1 / 3 = 2.3333333..., truncated rather than rounded to six places
+		{"merger rounds down", CorporateActionMerger, "7", "3", "1", map[string]string{"TCS": "-7", "INFY": "2.333333"}},
+		{"split rounds down", CorporateActionSplit, "2", "3", "2", map[string]string{"TCS": "-0.666667"}},
+		// A bonus worth less than a millionth of a share yields nothing
+		{"bonus below precision", CorporateActionBonus, "0.000001", "3", "1", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			action := &models.CorporateAction{ActionType: tt.actionType, StockSymbol: "TCS", NewStockSymbol: "INFY"}
+			changes, err := corporateActionChanges(action, "u1", decimal.MustParse(tt.held), decimal.MustParse(tt.from), decimal.MustParse(tt.to))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(changes) != len(tt.want) {
+				t.Fatalf("changes = %+v, want %v", changes, tt.want)
+			}
+			for _, change := range changes {
+				want, ok := tt.want[change.stockSymbol]
+				if !ok || !change.quantity.Equal(decimal.MustParse(want)) || change.userID != "u1" {
+					t.Errorf("%s change = %s for %s, want %s", change.stockSymbol, change.quantity, change.userID, want)
+				}
+			}
+		})
+	}
+
+	action := &models.CorporateAction{ActionType: "DEMERGER", StockSymbol: "TCS"}
+	one := decimal.MustParse("1")
+	if _, err := corporateActionChanges(action, "u1", one, one, one); !errors.Is(err, ErrInvalidCorporateAction) {
+		t.Errorf("unknown type: err = %v, want %v", err, ErrInvalidCorporateAction)
+	}
+}
+
+func TestApplyCorporateAction(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	today := time.Now().In(testLocation)
+	if _, err := newTestRewardService(store).CreateReward(ctx, "u1", "TCS", "7", "NSE", "evt-1", today.AddDate(0, 0, -2)); err != nil {
+		t.Fatal(err)
+	}
+	portfolio := NewPortfolioService(store, nil, false, testLocation, discardLogger())
+	service := NewCorporateActionService(store, portfolio, testLocation, discardLogger())
+
+	action, err := service.CreateCorporateAction(ctx, "merger", "tcs", "infy", "3", "1", today, "TCS into INFY")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action.Status != "PENDING" || action.StockSymbol != "TCS" || action.NewStockSymbol != "INFY" {
+		t.Errorf("created = %+v", action)
+	}
+
+	if err := service.ApplyDueActions(ctx); err != nil {
+		t.Fatal(err)
+	}
+	actions, err := service.ListCorporateActions(ctx, "infy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(actions) != 1 || actions[0].Status != corporateActionApplied || actions[0].AppliedAt == nil {
+		t.Fatalf("actions = %+v, want the merger applied", actions)
+	}
+
+	holdings, err := store.Rewards().Holdings("u1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holdings) != 1 || holdings[0].StockSymbol != "INFY" || !decimal.MustParse(holdings[0].Quantity).Equal(decimal.MustParse("2.333333")) {
+		t.Errorf("holdings = %+v, want 2.333333 INFY", holdings)
+	}
+
+	if _, err := service.ApplyCorporateAction(ctx, action.ID); !errors.Is(err, ErrCorporateActionApplied) {
+		t.Errorf("reapply: err = %v, want %v", err, ErrCorporateActionApplied)
+	}
+	if _, err := service.ApplyCorporateAction(ctx, "missing"); !errors.Is(err, ErrCorporateActionNotFound) {
+		t.Errorf("missing: err = %v, want %v", err, ErrCorporateActionNotFound)
+	}
+
+	tomorrow, err := service.CreateCorporateAction(ctx, CorporateActionSplit, "INFY", "", "1", "2", today.AddDate(0, 0, 1), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ApplyCorporateAction(ctx, tomorrow.ID); !errors.Is(err, ErrCorporateActionNotDue) {
+		t.Errorf("future: err = %v, want %v", err, ErrCorporateActionNotDue)
+	}
+}
+
+func TestCreateCorporateActionRejects(t *testing.T) {
+	store := repository.NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "TCS", Status: InstrumentActive, Exchange: "NSE"})
+	service := NewCorporateActionService(store, nil, testLocation, discardLogger())
+	ctx := context.Background()
+	today := time.Now().In(testLocation)
+
+	tests := []struct {
+		name                 string
+		actionType, old, new string
+		ratioFrom, ratioTo   string
+		want                 error
+	}{
+		{"unknown new symbol", CorporateActionSymbolChange, "TCS", "NEWCO", "", "", ErrUnknownSymbol},
+		{"unknown old symbol", CorporateActionSplit, "OLDCO", "", "1", "2", ErrUnknownSymbol},
+		{"split without change", CorporateActionSplit, "TCS", "", "2", "2", ErrInvalidCorporateAction},
+		{"zero ratio", CorporateActionBonus, "TCS", "", "0", "1", ErrInvalidCorporateAction},
+		{"symbol change with ratio", CorporateActionSymbolChange, "TCS", "TCS2", "1", "2", ErrInvalidCorporateAction},
+		{"merger into itself", CorporateActionMerger, "TCS", "TCS", "1", "1", ErrInvalidCorporateAction},
+		{"unknown type", "DEMERGER", "TCS", "", "1", "1", ErrInvalidCorporateAction},
+	}
+	for _, tt := range tests {
+		_, err := service.CreateCorporateAction(ctx, tt.actionType, tt.old, tt.new, tt.ratioFrom, tt.ratioTo, today, "")
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
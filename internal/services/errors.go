@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+)
+
+// Code is the machine-readable kind of an error reported to API clients
+type Code string
+
+const (
+	CodeValidationFailed     Code = "VALIDATION_FAILED"      // The request is malformed or has invalid fields
+	CodeUnauthorized         Code = "UNAUTHORIZED"           // Missing or invalid credentials
+	CodeForbidden            Code = "FORBIDDEN"              // The caller may not do this
+	CodeNotFound             Code = "NOT_FOUND"              // The resource does not exist
+	CodeConflict             Code = "CONFLICT"               // The request clashes with the resource's current state
+	CodePayloadTooLarge      Code = "PAYLOAD_TOO_LARGE"      // The request carries too many items
+	CodeDuplicateEvent       Code = "DUPLICATE_EVENT"        // An event_id was reused for a different reward
+	CodeIdempotencyKeyReused Code = "IDEMPOTENCY_KEY_REUSED" // An Idempotency-Key was reused for a different request
+	CodeUnknownSymbol        Code = "UNKNOWN_SYMBOL"         // The stock symbol is not in the instrument master
+	CodeNoFeeSchedule        Code = "NO_FEE_SCHEDULE"        // No fee schedule covers the exchange and date
+	CodeRateLimited          Code = "RATE_LIMITED"           // The caller's rate limit is exhausted
+	CodePriceUnavailable     Code = "PRICE_UNAVAILABLE"      // Prices are missing or too stale to value holdings
+	CodeTimeout              Code = "TIMEOUT"                // The request's deadline passed before it finished
+	CodeCanceled             Code = "CANCELED"               // The client went away before the request finished
+	CodeInternal             Code = "INTERNAL"               // Anything unexpected; the cause is logged, not returned
+)
+
+// Error is an error with a code for API clients. Details, when set, is returned
+// alongside the message; Err is the underlying cause, if any.
+type Error struct {
+	Code    Code
+	Message string
+	Details interface{}
+	Err     error
+}
+
+// NewError returns an Error with the given code and message
+func NewError(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// detailedError is implemented by errors that carry structured details for clients,
+// such as the invalid fields of a *ValidationError
+type detailedError interface {
+	error
+	ErrorDetails() interface{}
+}
+
+// errorCodes gives the code of each sentinel error a service may return. Malformed
+// numbers are only a client's fault where request input is validated, so
+// decimal.ErrInvalidDecimal is deliberately absent: a corrupt stored value is INTERNAL.
+var errorCodes = []struct {
+	err  error
+	code Code
+}{
+	{ErrValidation, CodeValidationFailed},
+	{ErrInvalidBatchMode, CodeValidationFailed},
+	{ErrInvalidAdjustment, CodeValidationFailed},
+	{ErrInvalidBackfillRange, CodeValidationFailed},
+	{ErrInvalidCorporateAction, CodeValidationFailed},
+	{ErrInvalidFeeSchedule, CodeValidationFailed},
+	{ErrInvalidInstrumentStatus, CodeValidationFailed},
+	{ErrInvalidPrice, CodeValidationFailed},
+	{ErrInvalidTimezone, CodeValidationFailed},
+
+	{ErrRewardNotFound, CodeNotFound},
+	{ErrCorporateActionNotFound, CodeNotFound},
+	{ErrInstrumentNotFound, CodeNotFound},
+
+	{ErrRewardFullyReversed, CodeConflict},
+	{ErrRewardRestated, CodeConflict},
+	{ErrCorporateActionApplied, CodeConflict},
+	{ErrCorporateActionNotDue, CodeConflict},
+	{ErrInstrumentExists, CodeConflict},
+	{ErrInstrumentInUse, CodeConflict},
+	{ErrRewardPredatesCorporateAction, CodeConflict},
+
+	{ErrDuplicateEvent, CodeDuplicateEvent},
+	{ErrEventConflict, CodeDuplicateEvent},
+	{ErrUnknownSymbol, CodeUnknownSymbol},
+	{ErrNoFeeSchedule, CodeNoFeeSchedule},
+
+	{ErrStaleValuation, CodePriceUnavailable},
+	{ErrPriceUnavailable, CodePriceUnavailable},
+}
+
+// AsError classifies err for an API response. An *Error in the chain is returned as is;
+// errors wrapping a known sentinel take its code and keep their message, and a passed
+// deadline or cancelled context is CodeTimeout or CodeCanceled. Anything else is
+// CodeInternal, with err kept as the cause so it can be logged.
+func AsError(err error) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return &Error{Code: CodeTimeout, Message: "request deadline exceeded", Err: err}
+	case errors.Is(err, context.Canceled):
+		return &Error{Code: CodeCanceled, Message: "request canceled", Err: err}
+	}
+
+	for _, known := range errorCodes {
+		if errors.Is(err, known.err) {
+			classified := &Error{Code: known.code, Message: err.Error(), Err: err}
+			var detailed detailedError
+			if errors.As(err, &detailed) {
+				classified.Message = known.err.Error()
+				classified.Details = detailed.ErrorDetails()
+			}
+			return classified
+		}
+	}
+
+	return &Error{Code: CodeInternal, Message: "internal server error", Err: err}
+}
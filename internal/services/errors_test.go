@@ -0,0 +1,34 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"testing"
+	"time"
+)
+
+func TestAsErrorStoredDecimalIsInternal(t *testing.T) {
+	_, err := decimal.Parse("12..5")
+	if err == nil {
+		t.Fatal("expected a parse error")
+	}
+	// What costReward returns for a corrupt stored price
+	err = fmt.Errorf("invalid stored price for TCS: %w", err)
+	if got := AsError(err).Code; got != CodeInternal {
+		t.Errorf("code = %s, want %s", got, CodeInternal)
+	}
+}
+
+func TestPreviewRewardInvalidQuantity(t *testing.T) {
+	service := newTestRewardService(newTestStore(t))
+
+	_, err := service.PreviewReward(context.Background(), "TCS", "ten", "NSE", time.Now())
+	if !errors.Is(err, ErrValidation) {
+		t.Fatalf("err = %v, want ErrValidation", err)
+	}
+	if got := AsError(err).Code; got != CodeValidationFailed {
+		t.Errorf("code = %s, want %s", got, CodeValidationFailed)
+	}
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrNoFeeSchedule      = errors.New("no fee schedule in effect")
+	ErrInvalidFeeSchedule = errors.New("invalid fee schedule")
+)
+
+// DefaultExchange is used for rewards that do not name an exchange
+const DefaultExchange = "NSE"
+
+type FeeService struct {
+	store  repository.Store
+	logger *logrus.Logger
+}
+
+func NewFeeService(store repository.Store, logger *logrus.Logger) *FeeService {
+	return &FeeService{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// CreateFeeSchedule records the rates for an exchange from effectiveFrom onwards.
+// Rewards already issued keep the schedule they were priced with.
+func (s *FeeService) CreateFeeSchedule(ctx context.Context, schedule models.FeeSchedule) (*models.FeeSchedule, error) {
+	schedule.Exchange = strings.ToUpper(schedule.Exchange)
+	if schedule.Exchange == "" {
+		return nil, fmt.Errorf("%w: exchange is required", ErrInvalidFeeSchedule)
+	}
+	if _, err := time.Parse("2006-01-02", schedule.EffectiveFrom); err != nil {
+		return nil, fmt.Errorf("%w: effective_from must be YYYY-MM-DD", ErrInvalidFeeSchedule)
+	}
+	if schedule.BrokerageMin == "" {
+		schedule.BrokerageMin = "0"
+	}
+	if schedule.OtherFeesFlat == "" {
+		schedule.OtherFeesFlat = "0"
+	}
+	if _, err := parseFeeRates(&schedule); err != nil {
+		return nil, err
+	}
+
+	err := s.store.WithContext(ctx).FeeSchedules().Create(&schedule)
+	if errors.Is(err, repository.ErrExists) {
+		return nil, fmt.Errorf("%w: %s already has a schedule from %s", ErrInvalidFeeSchedule, schedule.Exchange, schedule.EffectiveFrom)
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"fee_schedule_id": schedule.ID,
+		"exchange":        schedule.Exchange,
+		"effective_from":  schedule.EffectiveFrom,
+	}).Info("Fee schedule recorded")
+
+	return &schedule, nil
+}
+
+// ListFeeSchedules returns fee schedules, newest first, optionally filtered by exchange
+func (s *FeeService) ListFeeSchedules(ctx context.Context, exchange string) ([]models.FeeSchedule, error) {
+	return s.store.WithContext(ctx).FeeSchedules().List(strings.ToUpper(exchange))
+}
+
+// feeScheduleAt returns the schedule for exchange in effect at the given time
+func feeScheduleAt(schedules repository.FeeScheduleRepository, exchange string, at time.Time) (*models.FeeSchedule, error) {
+	schedule, err := schedules.At(exchange, at)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s on %s", ErrNoFeeSchedule, exchange, at.Format("2006-01-02"))
+	}
+	return schedule, err
+}
+
+// feeRates is a fee schedule parsed for calculation
+type feeRates struct {
+	brokerageRate decimal.Decimal
+	brokerageMin  decimal.Decimal
+	brokerageMax  *decimal.Decimal // nil means uncapped
+	sttRate       decimal.Decimal
+	gstRate       decimal.Decimal
+	otherFeesFlat decimal.Decimal
+}
+
+func parseFeeRates(schedule *models.FeeSchedule) (*feeRates, error) {
+	parse := func(field, value string) (decimal.Decimal, error) {
+		d, err := decimal.Parse(value)
+		if err != nil || d.Sign() < 0 {
+			return decimal.Decimal{}, fmt.Errorf("%w: %s must be a non-negative number", ErrInvalidFeeSchedule, field)
+		}
+		return d, nil
+	}
+
+	var rates feeRates
+	var err error
+	if rates.brokerageRate, err = parse("brokerage_rate", schedule.BrokerageRate); err != nil {
+		return nil, err
+	}
+	if rates.brokerageMin, err = parse("brokerage_min", schedule.BrokerageMin); err != nil {
+		return nil, err
+	}
+	if schedule.BrokerageMax != "" {
+		brokerageMax, err := parse("brokerage_max", schedule.BrokerageMax)
+		if err != nil {
+			return nil, err
+		}
+		if brokerageMax.Cmp(rates.brokerageMin) < 0 {
+			return nil, fmt.Errorf("%w: brokerage_max is below brokerage_min", ErrInvalidFeeSchedule)
+		}
+		rates.brokerageMax = &brokerageMax
+	}
+	if rates.sttRate, err = parse("stt_rate", schedule.STTRate); err != nil {
+		return nil, err
+	}
+	if rates.gstRate, err = parse("gst_rate", schedule.GSTRate); err != nil {
+		return nil, err
+	}
+	if rates.otherFeesFlat, err = parse("other_fees_flat", schedule.OtherFeesFlat); err != nil {
+		return nil, err
+	}
+	return &rates, nil
+}
+
+// fees is the fee breakdown for one trade. All amounts are rounded to NUMERIC(18, 4) precision.
+type fees struct {
+	brokerage decimal.Decimal
+	stt       decimal.Decimal
+	gst       decimal.Decimal
+	otherFees decimal.Decimal
+}
+
+func (f fees) total() decimal.Decimal {
+	return f.brokerage.Add(f.stt).Add(f.gst).Add(f.otherFees)
+}
+
+// calculateFees applies a fee schedule to a trade value
+func calculateFees(schedule *models.FeeSchedule, tradeValue decimal.Decimal) (fees, error) {
+	rates, err := parseFeeRates(schedule)
+	if err != nil {
+		// A stored schedule was checked when it was created; this is a data fault, not the caller's
+		return fees{}, fmt.Errorf("fee schedule %s: %v", schedule.ID, err)
+	}
+
+	// Brokerage is a percentage of trade value, clamped to the schedule's minimum and cap
+	brokerage := roundAmount(tradeValue.Mul(rates.brokerageRate))
+	if brokerage.Cmp(rates.brokerageMin) < 0 {
+		brokerage = roundAmount(rates.brokerageMin)
+	}
+	if rates.brokerageMax != nil && brokerage.Cmp(*rates.brokerageMax) > 0 {
+		brokerage = roundAmount(*rates.brokerageMax)
+	}
+
+	return fees{
+		brokerage: brokerage,
+		stt:       roundAmount(tradeValue.Mul(rates.sttRate)),
+		gst:       roundAmount(brokerage.Mul(rates.gstRate)), // GST is charged on brokerage
+		otherFees: roundAmount(rates.otherFeesFlat),
+	}, nil
+}
@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"testing"
+	"time"
+)
+
+func TestCalculateFees(t *testing.T) {
+	schedule := &models.FeeSchedule{
+		ID:            "s1",
+		BrokerageRate: "0.0003",
+		BrokerageMin:  "20",
+		BrokerageMax:  "100",
+		STTRate:       "0.001",
+		GSTRate:       "0.18",
+		OtherFeesFlat: "5.5",
+	}
+	uncapped := *schedule
+	uncapped.BrokerageMin, uncapped.BrokerageMax = "0", ""
+
+	tests := []struct {
+		name                           string
+		schedule                       *models.FeeSchedule
+		tradeValue                     string
+		brokerage, stt, gst, otherFees string
+	}{
+		// 0.0003 of 10000 is 3, raised to the minimum; GST follows the clamped brokerage
+		{"below minimum", schedule, "10000", "20.0000", "10.0000", "3.6000", "5.5000"},
+		{"within range", schedule, "100000", "30.0000", "100.0000", "5.4000", "5.5000"},
+		// 0.0003 of 1000000 is 300, cut to the cap
+		{"above cap", schedule, "1000000", "100.0000", "1000.0000", "18.0000", "5.5000"},
+		{"uncapped", &uncapped, "1000000", "300.0000", "1000.0000", "54.0000", "5.5000"},
+		// 0.0003 of 333.3333 is 0.09999999; GST is on the rounded 0.1000
+		{"rounded before gst", &uncapped, "333.3333", "0.1000", "0.3333", "0.0180", "5.5000"},
+	}
+	for _, tt := range tests {
+		f, err := calculateFees(tt.schedule, decimal.MustParse(tt.tradeValue))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		got := []string{f.brokerage.String(), f.stt.String(), f.gst.String(), f.otherFees.String()}
+		want := []string{tt.brokerage, tt.stt, tt.gst, tt.otherFees}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("%s: fees = %v, want %v", tt.name, got, want)
+				break
+			}
+		}
+	}
+
+	f, err := calculateFees(schedule, decimal.MustParse("10000"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.total().String() != "39.1000" {
+		t.Errorf("total = %s, want 39.1000", f.total())
+	}
+
+	corrupt := *schedule
+	corrupt.STTRate = "-0.001"
+	if _, err := calculateFees(&corrupt, decimal.MustParse("10000")); err == nil || errors.Is(err, ErrInvalidFeeSchedule) {
+		t.Errorf("corrupt schedule: err = %v, want an internal error", err)
+	}
+}
+
+func TestCreateFeeSchedule(t *testing.T) {
+	store := newTestStore(t)
+	service := NewFeeService(store, discardLogger())
+	ctx := context.Background()
+
+	valid := models.FeeSchedule{
+		Exchange:      "nse",
+		EffectiveFrom: "2024-04-01",
+		BrokerageRate: "0.0003",
+		BrokerageMin:  "20",
+		BrokerageMax:  "100",
+		STTRate:       "0.001",
+		GSTRate:       "0.18",
+	}
+	created, err := service.CreateFeeSchedule(ctx, valid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ID == "" || created.Exchange != "NSE" || created.OtherFeesFlat != "0" {
+		t.Errorf("created = %+v", created)
+	}
+
+	// The new schedule applies from its date; the seeded default still covers earlier rewards
+	schedule, err := feeScheduleAt(store.FeeSchedules(), "NSE", time.Date(2024, 4, 1, 0, 0, 0, 0, testLocation))
+	if err != nil || schedule.ID != created.ID {
+		t.Errorf("schedule on 2024-04-01 = %+v, %v; want %s", schedule, err, created.ID)
+	}
+	schedule, err = feeScheduleAt(store.FeeSchedules(), "NSE", time.Date(2024, 3, 31, 23, 59, 0, 0, testLocation))
+	if err != nil || schedule.ID == created.ID {
+		t.Errorf("schedule on 2024-03-31 = %+v, %v; want the default", schedule, err)
+	}
+	if _, err := feeScheduleAt(store.FeeSchedules(), "MCX", time.Now()); !errors.Is(err, ErrNoFeeSchedule) {
+		t.Errorf("unknown exchange: err = %v, want %v", err, ErrNoFeeSchedule)
+	}
+
+	schedules, err := service.ListFeeSchedules(ctx, "nse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 2 || schedules[0].ID != created.ID || schedules[0].BrokerageMax != "100.0000" {
+		t.Errorf("schedules = %+v, want the new one first", schedules)
+	}
+
+	invalid := func(change func(*models.FeeSchedule)) models.FeeSchedule {
+		s := valid
+		s.EffectiveFrom = "2025-01-01"
+		change(&s)
+		return s
+	}
+	tests := map[string]models.FeeSchedule{
+		"duplicate date":    valid,
+		"no exchange":       invalid(func(s *models.FeeSchedule) { s.Exchange = "" }),
+		"bad date":          invalid(func(s *models.FeeSchedule) { s.EffectiveFrom = "01/01/2025" }),
+		"negative rate":     invalid(func(s *models.FeeSchedule) { s.BrokerageRate = "-0.0003" }),
+		"missing gst":       invalid(func(s *models.FeeSchedule) { s.GSTRate = "" }),
+		"cap below minimum": invalid(func(s *models.FeeSchedule) { s.BrokerageMax = "10" }),
+	}
+	for name, schedule := range tests {
+		if _, err := service.CreateFeeSchedule(ctx, schedule); !errors.Is(err, ErrInvalidFeeSchedule) {
+			t.Errorf("%s: err = %v, want %v", name, err, ErrInvalidFeeSchedule)
+		}
+	}
+}
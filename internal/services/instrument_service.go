@@ -0,0 +1,349 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidInstrumentStatus = errors.New("invalid instrument status")
+	ErrInstrumentNotFound      = errors.New("instrument not found")
+	ErrInstrumentExists        = errors.New("instrument already exists")
+	ErrInstrumentInUse         = errors.New("instrument has rewards, prices or corporate actions")
+)
+
+const (
+	InstrumentActive    = "ACTIVE"
+	InstrumentSuspended = "SUSPENDED"
+	InstrumentDelisted  = "DELISTED"
+
+	// Valuation rules for instruments that are no longer trading
+	ValuationCarryForward = "CARRY_FORWARD" // Keep valuing at the last valid price
+	ValuationWriteOff     = "WRITE_OFF"     // Value at zero once delisted
+)
+
+var (
+	// Two-letter country code, nine alphanumerics and a check digit, e.g. INE002A01018
+	isinPattern = regexp.MustCompile(`^[A-Z]{2}[A-Z0-9]{9}[0-9]$`)
+
+	// maxInstrumentAmount is the first value too large for NUMERIC(18, 4)
+	maxInstrumentAmount = decimal.MustParse("100000000000000")
+)
+
+type InstrumentService struct {
+	store  repository.Store
+	logger *logrus.Logger
+}
+
+func NewInstrumentService(store repository.Store, logger *logrus.Logger) *InstrumentService {
+	return &InstrumentService{
+		store:  store,
+		logger: logger,
+	}
+}
+
+// ListInstruments returns the instrument master ordered by symbol, optionally filtered by status and exchange
+func (s *InstrumentService) ListInstruments(ctx context.Context, status, exchange string) ([]models.Instrument, error) {
+	return s.store.WithContext(ctx).Instruments().List(strings.ToUpper(status), strings.ToUpper(exchange))
+}
+
+// GetInstrument returns an instrument from the master, or ErrInstrumentNotFound
+func (s *InstrumentService) GetInstrument(ctx context.Context, stockSymbol string) (*models.Instrument, error) {
+	instrument, err := s.store.WithContext(ctx).Prices().Instrument(strings.ToUpper(stockSymbol))
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInstrumentNotFound
+	}
+	return instrument, err
+}
+
+// CreateInstrument adds an instrument to the master. Status defaults to ACTIVE;
+// invalid fields are reported together in a *ValidationError.
+func (s *InstrumentService) CreateInstrument(ctx context.Context, instrument models.Instrument) (*models.Instrument, error) {
+	normalizeInstrument(&instrument)
+	if instrument.Status == "" {
+		instrument.Status = InstrumentActive
+	}
+	if err := checkInstrument(&instrument); err != nil {
+		return nil, err
+	}
+
+	instruments := s.store.WithContext(ctx).Instruments()
+	created, err := instruments.Create(instrument)
+	if errors.Is(err, repository.ErrExists) {
+		return nil, fmt.Errorf("%w: %s", ErrInstrumentExists, instrument.StockSymbol)
+	} else if errors.Is(err, repository.ErrISINTaken) {
+		return nil, isinTaken(instruments, instrument.ISIN)
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"stock_symbol": created.StockSymbol,
+		"isin":         created.ISIN,
+		"exchange":     created.Exchange,
+	}).Info("Instrument created")
+
+	return created, nil
+}
+
+// UpdateInstrument replaces an instrument's reference data. Its status is changed with SetStatus.
+func (s *InstrumentService) UpdateInstrument(ctx context.Context, instrument models.Instrument) (*models.Instrument, error) {
+	normalizeInstrument(&instrument)
+	instrument.Status = ""
+	if err := checkInstrument(&instrument); err != nil {
+		return nil, err
+	}
+
+	instruments := s.store.WithContext(ctx).Instruments()
+	updated, err := instruments.Update(instrument)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInstrumentNotFound
+	} else if errors.Is(err, repository.ErrISINTaken) {
+		return nil, isinTaken(instruments, instrument.ISIN)
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithField("stock_symbol", updated.StockSymbol).Info("Instrument updated")
+
+	return updated, nil
+}
+
+// SeedInstrument creates an instrument or replaces the reference data of an existing one,
+// as UpdateInstrument would; instrument.Status only applies to new instruments. It reports
+// whether the instrument was created. With dryRun set the write is rolled back.
+func (s *InstrumentService) SeedInstrument(ctx context.Context, instrument models.Instrument, dryRun bool) (bool, error) {
+	normalizeInstrument(&instrument)
+	if instrument.Status == "" {
+		instrument.Status = InstrumentActive
+	}
+	if err := checkInstrument(&instrument); err != nil {
+		return false, err
+	}
+
+	store := s.store.WithContext(ctx)
+	var created bool
+	err := store.InTx(func(tx repository.Store) error {
+		var err error
+		if created, err = tx.Instruments().Upsert(instrument); err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, repository.ErrISINTaken) {
+		return false, isinTaken(store.Instruments(), instrument.ISIN)
+	} else if err != nil && !errors.Is(err, errDryRun) {
+		return false, err
+	}
+	return created, nil
+}
+
+// DeleteInstrument removes an instrument that was never used. Instruments with rewards,
+// prices or corporate actions are refused with ErrInstrumentInUse; delist them instead.
+func (s *InstrumentService) DeleteInstrument(ctx context.Context, stockSymbol string) error {
+	stockSymbol = strings.ToUpper(stockSymbol)
+	err := s.store.WithContext(ctx).Instruments().Delete(stockSymbol)
+	if errors.Is(err, repository.ErrNotFound) {
+		return ErrInstrumentNotFound
+	} else if errors.Is(err, repository.ErrInUse) {
+		return fmt.Errorf("%w: %s", ErrInstrumentInUse, stockSymbol)
+	} else if err != nil {
+		return err
+	}
+
+	s.logger.WithField("stock_symbol", stockSymbol).Info("Instrument deleted")
+
+	return nil
+}
+
+// SetStatus changes an instrument's trading status and valuation rule, or returns ErrInstrumentNotFound
+func (s *InstrumentService) SetStatus(ctx context.Context, stockSymbol, status, valuationRule, reason string) (*models.Instrument, error) {
+	stockSymbol = strings.ToUpper(stockSymbol)
+	status = strings.ToUpper(status)
+	valuationRule = strings.ToUpper(valuationRule)
+	if valuationRule == "" {
+		valuationRule = ValuationCarryForward
+	}
+
+	switch status {
+	case InstrumentActive, InstrumentSuspended, InstrumentDelisted:
+	default:
+		return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInstrumentStatus, status)
+	}
+	switch valuationRule {
+	case ValuationCarryForward, ValuationWriteOff:
+	default:
+		return nil, fmt.Errorf("%w: unknown valuation_rule %q", ErrInvalidInstrumentStatus, valuationRule)
+	}
+
+	instrument, err := s.store.WithContext(ctx).Instruments().SetStatus(stockSymbol, status, valuationRule, reason)
+	if errors.Is(err, repository.ErrNotFound) {
+		return nil, ErrInstrumentNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"stock_symbol":   stockSymbol,
+		"status":         status,
+		"valuation_rule": valuationRule,
+	}).Info("Instrument status updated")
+
+	return instrument, nil
+}
+
+// normalizeInstrument trims the reference data and upper-cases its codes
+func normalizeInstrument(instrument *models.Instrument) {
+	instrument.StockSymbol = strings.ToUpper(strings.TrimSpace(instrument.StockSymbol))
+	instrument.ISIN = strings.ToUpper(strings.TrimSpace(instrument.ISIN))
+	instrument.Exchange = strings.ToUpper(strings.TrimSpace(instrument.Exchange))
+	instrument.CompanyName = strings.TrimSpace(instrument.CompanyName)
+	instrument.Sector = strings.TrimSpace(instrument.Sector)
+	instrument.FaceValue = strings.TrimSpace(instrument.FaceValue)
+	instrument.TickSize = strings.TrimSpace(instrument.TickSize)
+	instrument.Status = strings.ToUpper(strings.TrimSpace(instrument.Status))
+}
+
+// checkInstrument validates an instrument's reference data, and its status when set,
+// reporting every invalid field in a *ValidationError
+func checkInstrument(instrument *models.Instrument) error {
+	var v ValidationError
+	checkInstrumentFields(&v, instrument)
+	return v.Err()
+}
+
+// isinTaken reports an ISIN that belongs to another symbol as a field error naming it.
+// The repository refuses the write itself, so an ISIN claimed concurrently is caught too.
+func isinTaken(instruments repository.InstrumentRepository, isin string) error {
+	message := "is already used by another instrument"
+	if owner, err := instruments.GetByISIN(isin); err == nil {
+		message = "is already used by " + owner.StockSymbol
+	}
+	var v ValidationError
+	v.Add("isin", message)
+	return &v
+}
+
+// checkInstrumentFields validates the fields of a normalized instrument, adding a FieldError for each problem
+func checkInstrumentFields(v *ValidationError, instrument *models.Instrument) {
+	switch {
+	case instrument.StockSymbol == "":
+		v.Add("stock_symbol", "is required")
+	case !stockSymbolPattern.MatchString(instrument.StockSymbol):
+		v.Add("stock_symbol", "must be at most 50 upper-case letters, digits or & . _ -")
+	}
+
+	switch {
+	case instrument.ISIN == "":
+		v.Add("isin", "is required")
+	case !isinPattern.MatchString(instrument.ISIN) || !validISINCheckDigit(instrument.ISIN):
+		v.Add("isin", "must be a 12-character ISIN with a valid check digit")
+	}
+
+	switch instrument.Exchange {
+	case "":
+		v.Add("exchange", "is required")
+	case "NSE", "BSE":
+	default:
+		v.Add("exchange", "must be NSE or BSE")
+	}
+
+	switch {
+	case instrument.CompanyName == "":
+		v.Add("company_name", "is required")
+	case len(instrument.CompanyName) > 255:
+		v.Add("company_name", "must be at most 255 characters")
+	}
+
+	if len(instrument.Sector) > 100 {
+		v.Add("sector", "must be at most 100 characters")
+	}
+
+	checkInstrumentAmount(v, "face_value", instrument.FaceValue)
+	checkInstrumentAmount(v, "tick_size", instrument.TickSize)
+
+	switch instrument.Status {
+	case "", InstrumentActive, InstrumentSuspended, InstrumentDelisted:
+	default:
+		v.Add("status", "must be ACTIVE, SUSPENDED or DELISTED")
+	}
+}
+
+// checkInstrumentAmount validates an optional INR amount of the instrument
+func checkInstrumentAmount(v *ValidationError, field, value string) {
+	if value == "" {
+		return
+	}
+	amount, err := decimal.Parse(value)
+	switch {
+	case err != nil:
+		v.Add(field, "must be a decimal number")
+	case amount.Sign() <= 0:
+		v.Add(field, "must be positive")
+	case !amount.Round(decimal.AmountScale, decimal.RoundDown).Equal(amount):
+		v.Add(field, fmt.Sprintf("must have at most %d decimal places", decimal.AmountScale))
+	case amount.Cmp(maxInstrumentAmount) >= 0:
+		v.Add(field, fmt.Sprintf("must be less than %s", maxInstrumentAmount))
+	}
+}
+
+// validISINCheckDigit applies the Luhn check to the ISIN with letters expanded to 10-35
+func validISINCheckDigit(isin string) bool {
+	var digits strings.Builder
+	for _, r := range isin {
+		if r >= 'A' && r <= 'Z' {
+			digits.WriteString(strconv.Itoa(int(r-'A') + 10))
+		} else {
+			digits.WriteRune(r)
+		}
+	}
+
+	sum, double := 0, false
+	expanded := digits.String()
+	for i := len(expanded) - 1; i >= 0; i-- {
+		d := int(expanded[i] - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
+
+// getInstrument returns the stored instrument; symbols without a row are active and carried forward
+func getInstrument(prices repository.PriceRepository, stockSymbol string) (*models.Instrument, error) {
+	instrument, err := prices.Instrument(stockSymbol)
+	if errors.Is(err, repository.ErrNotFound) {
+		return &models.Instrument{
+			StockSymbol:   stockSymbol,
+			Status:        InstrumentActive,
+			ValuationRule: ValuationCarryForward,
+		}, nil
+	}
+	return instrument, err
+}
+
+// writtenOffBefore reports whether holdings of the instrument are valued at zero at end,
+// i.e. it was delisted with a write-off before then
+func writtenOffBefore(instrument *models.Instrument, end time.Time) bool {
+	return instrument.Status == InstrumentDelisted &&
+		instrument.ValuationRule == ValuationWriteOff &&
+		instrument.StatusChangedAt.Before(end)
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestValidISINCheckDigit(t *testing.T) {
+	tests := []struct {
+		isin string
+		want bool
+	}{
+		{"INE002A01018", true},
+		{"INE467B01029", true},
+		{"INE009A01021", true},
+		{"US0378331005", true},
+		{"GB0002634946", true},
+		{"INE002A01019", false},
+		{"INE467B01028", false},
+		{"US0378331006", false},
+		{"INE020A01018", false}, // Adjacent digits swapped
+	}
+	for _, tt := range tests {
+		if got := validISINCheckDigit(tt.isin); got != tt.want {
+			t.Errorf("validISINCheckDigit(%q) = %v, want %v", tt.isin, got, tt.want)
+		}
+	}
+}
+
+// fieldErrors returns the fields a *ValidationError refused, by name
+func fieldErrors(t *testing.T, err error) map[string]string {
+	t.Helper()
+	var v *ValidationError
+	if !errors.As(err, &v) {
+		t.Fatalf("err = %v, want a *ValidationError", err)
+	}
+	fields := make(map[string]string)
+	for _, f := range v.Fields {
+		fields[f.Field] = f.Message
+	}
+	return fields
+}
+
+func TestCreateInstrumentValidation(t *testing.T) {
+	service := NewInstrumentService(repository.NewMemoryStore(), discardLogger())
+	ctx := context.Background()
+
+	_, err := service.CreateInstrument(ctx, models.Instrument{
+		StockSymbol: "reliance",
+		ISIN:        "ine002a01019",
+		Exchange:    "NYSE",
+		FaceValue:   "10.00005",
+		TickSize:    "-0.05",
+		Status:      "LISTED",
+	})
+	want := map[string]string{
+		"isin":         "must be a 12-character ISIN with a valid check digit",
+		"exchange":     "must be NSE or BSE",
+		"company_name": "is required",
+		"face_value":   "must have at most 4 decimal places",
+		"tick_size":    "must be positive",
+		"status":       "must be ACTIVE, SUSPENDED or DELISTED",
+	}
+	got := fieldErrors(t, err)
+	for field, message := range want {
+		if got[field] != message {
+			t.Errorf("%s: got %q, want %q", field, got[field], message)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("fields = %v, want %v", got, want)
+	}
+}
+
+func TestCreateInstrument(t *testing.T) {
+	service := NewInstrumentService(repository.NewMemoryStore(), discardLogger())
+	ctx := context.Background()
+
+	created, err := service.CreateInstrument(ctx, models.Instrument{
+		StockSymbol: " reliance ",
+		ISIN:        "ine002a01018",
+		Exchange:    "nse",
+		CompanyName: "Reliance Industries Ltd",
+		FaceValue:   "10",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.StockSymbol != "RELIANCE" || created.ISIN != "INE002A01018" || created.Status != InstrumentActive ||
+		created.ValuationRule != ValuationCarryForward || created.FaceValue != "10.0000" {
+		t.Errorf("created %+v", created)
+	}
+
+	_, err = service.CreateInstrument(ctx, models.Instrument{StockSymbol: "RELIANCE", ISIN: "INE467B01029", Exchange: "NSE", CompanyName: "Again"})
+	if !errors.Is(err, ErrInstrumentExists) {
+		t.Errorf("same symbol: err = %v, want %v", err, ErrInstrumentExists)
+	}
+
+	// The store refuses the ISIN, as the unique index does for a concurrent insert
+	_, err = service.CreateInstrument(ctx, models.Instrument{StockSymbol: "RIL", ISIN: "INE002A01018", Exchange: "BSE", CompanyName: "Reliance"})
+	if got := fieldErrors(t, err)["isin"]; got != "is already used by RELIANCE" {
+		t.Errorf("same ISIN: isin %q", got)
+	}
+	if code := AsError(err).Code; code != CodeValidationFailed {
+		t.Errorf("same ISIN: code = %s, want %s", code, CodeValidationFailed)
+	}
+}
+
+func TestUpdateInstrument(t *testing.T) {
+	store := repository.NewMemoryStore()
+	service := NewInstrumentService(store, discardLogger())
+	ctx := context.Background()
+	for _, instrument := range []models.Instrument{
+		{StockSymbol: "TCS", ISIN: "INE467B01029", Exchange: "NSE", CompanyName: "TCS"},
+		{StockSymbol: "INFY", ISIN: "INE009A01021", Exchange: "NSE", CompanyName: "Infosys"},
+	} {
+		if _, err := service.CreateInstrument(ctx, instrument); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := service.SetStatus(ctx, "TCS", InstrumentSuspended, "", "halted"); err != nil {
+		t.Fatal(err)
+	}
+
+	updated, err := service.UpdateInstrument(ctx, models.Instrument{StockSymbol: "tcs", ISIN: "INE467B01029", Exchange: "BSE", CompanyName: "Tata Consultancy Services", Status: InstrumentActive})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Exchange != "BSE" || updated.CompanyName != "Tata Consultancy Services" || updated.Status != InstrumentSuspended {
+		t.Errorf("updated %+v, want new reference data and the status kept", updated)
+	}
+
+	_, err = service.UpdateInstrument(ctx, models.Instrument{StockSymbol: "TCS", ISIN: "INE009A01021", Exchange: "NSE", CompanyName: "TCS"})
+	if got := fieldErrors(t, err)["isin"]; got != "is already used by INFY" {
+		t.Errorf("taking another symbol's ISIN: isin %q", got)
+	}
+	_, err = service.UpdateInstrument(ctx, models.Instrument{StockSymbol: "WIPRO", ISIN: "INE075A01022", Exchange: "NSE", CompanyName: "Wipro"})
+	if !errors.Is(err, ErrInstrumentNotFound) {
+		t.Errorf("unknown symbol: err = %v, want %v", err, ErrInstrumentNotFound)
+	}
+}
+
+func TestSeedInstrumentDryRun(t *testing.T) {
+	store := repository.NewMemoryStore()
+	service := NewInstrumentService(store, discardLogger())
+	ctx := context.Background()
+	tcs := models.Instrument{StockSymbol: "TCS", ISIN: "INE467B01029", Exchange: "NSE", CompanyName: "TCS"}
+
+	created, err := service.SeedInstrument(ctx, tcs, true)
+	if err != nil || !created {
+		t.Fatalf("dry run: created = %v, %v; want true", created, err)
+	}
+	if _, err := service.GetInstrument(ctx, "TCS"); !errors.Is(err, ErrInstrumentNotFound) {
+		t.Fatalf("dry run wrote the instrument: %v", err)
+	}
+
+	if created, err := service.SeedInstrument(ctx, tcs, false); err != nil || !created {
+		t.Fatalf("seed: created = %v, %v; want true", created, err)
+	}
+	tcs.CompanyName = "Tata Consultancy Services"
+	if created, err := service.SeedInstrument(ctx, tcs, false); err != nil || created {
+		t.Fatalf("reseed: created = %v, %v; want false", created, err)
+	}
+	if instrument, _ := service.GetInstrument(ctx, "TCS"); instrument.CompanyName != "Tata Consultancy Services" {
+		t.Errorf("reseed kept %q", instrument.CompanyName)
+	}
+
+	_, err = service.SeedInstrument(ctx, models.Instrument{StockSymbol: "TCS2", ISIN: "INE467B01029", Exchange: "NSE", CompanyName: "Copy"}, true)
+	if got := fieldErrors(t, err)["isin"]; got != "is already used by TCS" {
+		t.Errorf("dry run with a taken ISIN: isin %q", got)
+	}
+}
+
+func TestDeleteInstrument(t *testing.T) {
+	store := newTestStore(t)
+	service := NewInstrumentService(store, discardLogger())
+	rewards := newTestRewardService(store)
+	ctx := context.Background()
+	for _, instrument := range []models.Instrument{
+		{StockSymbol: "UNUSED", ISIN: "INE002A01018", Exchange: "NSE", CompanyName: "Unused"},
+		{StockSymbol: "RESTATED", ISIN: "INE062A01020", Exchange: "NSE", CompanyName: "Restated"},
+	} {
+		if _, err := service.CreateInstrument(ctx, instrument); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := rewards.CreateReward(ctx, "u1", "TCS", "1", "NSE", "evt-1", time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	store.AddAppliedCorporateAction("RESTATED", time.Now())
+
+	tests := []struct {
+		symbol string
+		want   error
+	}{
+		{"TCS", ErrInstrumentInUse},      // Rewarded
+		{"INFY", ErrInstrumentInUse},     // Priced
+		{"RESTATED", ErrInstrumentInUse}, // Corporate action
+		{"WIPRO", ErrInstrumentNotFound},
+		{"unused", nil},
+	}
+	for _, tt := range tests {
+		if err := service.DeleteInstrument(ctx, tt.symbol); !errors.Is(err, tt.want) {
+			t.Errorf("DeleteInstrument(%s) = %v, want %v", tt.symbol, err, tt.want)
+		}
+	}
+
+	if _, err := service.GetInstrument(ctx, "UNUSED"); !errors.Is(err, ErrInstrumentNotFound) {
+		t.Errorf("UNUSED still there: %v", err)
+	}
+	for _, symbol := range []string{"TCS", "INFY", "RESTATED"} {
+		if _, err := service.GetInstrument(ctx, symbol); err != nil {
+			t.Errorf("%s was deleted: %v", symbol, err)
+		}
+	}
+	if code := AsError(service.DeleteInstrument(ctx, "TCS")).Code; code != CodeConflict {
+		t.Errorf("in use: code = %s, want %s", code, CodeConflict)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+)
+
+var (
+	ErrUnbalancedJournal = errors.New("journal debits and credits do not balance")
+	ErrUnknownAccount    = repository.ErrUnknownAccount
+)
+
+const (
+	SideDebit  = "DEBIT"
+	SideCredit = "CREDIT"
+
+	JournalTypeReward           = "REWARD"
+	JournalTypeRewardAdjustment = "REWARD_ADJUSTMENT"
+	JournalTypeCorporateAction  = "CORPORATE_ACTION"
+)
+
+// Chart of accounts codes. Per-symbol accounts are "<parent>:<SYMBOL>" and are
+// opened on first use from their parent account.
+const (
+	AccountCompanyCash        = "COMPANY_CASH"
+	AccountStockInventory     = "STOCK_INVENTORY"
+	AccountUserStockLiability = "USER_STOCK_LIABILITY"
+	AccountBrokeragePayable   = "BROKERAGE_PAYABLE"
+	AccountSTTPayable         = "STT_PAYABLE"
+	AccountGSTPayable         = "GST_PAYABLE"
+	AccountOtherFeesPayable   = "OTHER_FEES_PAYABLE"
+	AccountFeeExpense         = "FEE_EXPENSE"
+	AccountRewardExpense      = "REWARD_EXPENSE"
+)
+
+// SymbolAccount returns the per-symbol sub-account of parent
+func SymbolAccount(parent, stockSymbol string) string {
+	return parent + ":" + stockSymbol
+}
+
+// validateJournal checks every leg and that total debits equal total credits
+func validateJournal(j *models.Journal) error {
+	if len(j.Lines) == 0 {
+		return fmt.Errorf("%w: journal has no lines", ErrUnbalancedJournal)
+	}
+
+	debits := decimal.Zero(decimal.AmountScale)
+	credits := decimal.Zero(decimal.AmountScale)
+	for _, line := range j.Lines {
+		if line.AccountCode == "" {
+			return fmt.Errorf("%w: no account on %s", ErrUnknownAccount, line.EntryType)
+		}
+		if line.Amount.Sign() < 0 {
+			return fmt.Errorf("%w: negative amount on %s", ErrUnbalancedJournal, line.EntryType)
+		}
+		switch line.Side {
+		case SideDebit:
+			debits = debits.Add(line.Amount)
+		case SideCredit:
+			credits = credits.Add(line.Amount)
+		default:
+			return fmt.Errorf("%w: unknown side %q on %s", ErrUnbalancedJournal, line.Side, line.EntryType)
+		}
+	}
+
+	if !debits.Equal(credits) {
+		return fmt.Errorf("%w: debits %s, credits %s", ErrUnbalancedJournal, debits, credits)
+	}
+	return nil
+}
+
+// PostJournal validates a journal and writes it with its ledger entries, amounts
+// rounded to INR precision. Every business event that moves money or stock goes
+// through here rather than inserting into ledger_entries directly.
+func PostJournal(ledger repository.LedgerRepository, j models.Journal) (string, error) {
+	if err := validateJournal(&j); err != nil {
+		return "", err
+	}
+
+	lines := make([]models.JournalLine, len(j.Lines))
+	for i, line := range j.Lines {
+		line.Amount = roundAmount(line.Amount)
+		lines[i] = line
+	}
+	j.Lines = lines
+
+	return ledger.PostJournal(j)
+}
@@ -0,0 +1,75 @@
+package services
+
+import (
+	"errors"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"testing"
+)
+
+func journalLine(entryType, account, side, amount string) models.JournalLine {
+	return models.JournalLine{EntryType: entryType, AccountCode: account, Side: side, Amount: decimal.MustParse(amount)}
+}
+
+func TestValidateJournal(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines []models.JournalLine
+		want  error
+	}{
+		{"balanced", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "1000.0000"),
+			journalLine("FEE_EXPENSE", AccountFeeExpense, SideDebit, "10.5000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "1010.5000"),
+		}, nil},
+		{"unbalanced", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "1000.0000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "999.9999"),
+		}, ErrUnbalancedJournal},
+		{"one-sided", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "1000.0000"),
+		}, ErrUnbalancedJournal},
+		{"no lines", nil, ErrUnbalancedJournal},
+		{"negative amount", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "-5.0000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "-5.0000"),
+		}, ErrUnbalancedJournal},
+		{"unknown side", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, "LEFT", "5.0000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "5.0000"),
+		}, ErrUnbalancedJournal},
+		{"no account", []models.JournalLine{
+			journalLine("STOCK_PURCHASE", "", SideDebit, "5.0000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "5.0000"),
+		}, ErrUnknownAccount},
+	}
+	for _, tt := range tests {
+		err := validateJournal(&models.Journal{JournalType: JournalTypeReward, Lines: tt.lines})
+		if !errors.Is(err, tt.want) || (tt.want == nil && err != nil) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestPostJournalRejectsUnbalanced(t *testing.T) {
+	store := newTestStore(t)
+	_, err := PostJournal(store.Ledger(), models.Journal{
+		JournalType:   JournalTypeReward,
+		RewardEventID: "r1",
+		Lines: []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "1000.0000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "999.9999"),
+		},
+	})
+	if !errors.Is(err, ErrUnbalancedJournal) {
+		t.Fatalf("err = %v, want %v", err, ErrUnbalancedJournal)
+	}
+
+	entries, err := store.Ledger().RewardEntries("r1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("entries = %+v, want nothing posted", entries)
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerService struct {
+	store    repository.Store
+	location *time.Location
+	logger   *logrus.Logger
+}
+
+func NewLedgerService(store repository.Store, location *time.Location, logger *logrus.Logger) *LedgerService {
+	return &LedgerService{
+		store:    store,
+		location: location,
+		logger:   logger,
+	}
+}
+
+// Location returns the business timezone trial balance dates are days in
+func (s *LedgerService) Location() *time.Location {
+	return s.location
+}
+
+// GetTrialBalance totals debits and credits per account_type for entries
+// created between from and to (inclusive dates in the business timezone)
+func (s *LedgerService) GetTrialBalance(ctx context.Context, from, to time.Time) (*models.TrialBalance, error) {
+	start, _, err := dayBounds(from.Format("2006-01-02"), s.location)
+	if err != nil {
+		return nil, err
+	}
+	_, end, err := dayBounds(to.Format("2006-01-02"), s.location)
+	if err != nil {
+		return nil, err
+	}
+
+	totals, err := s.store.WithContext(ctx).Ledger().AccountTotals(start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.TrialBalance{
+		From:     from.Format("2006-01-02"),
+		To:       to.Format("2006-01-02"),
+		Accounts: []models.TrialBalanceLine{},
+	}
+
+	totalDebits := decimal.Zero(decimal.AmountScale)
+	totalCredits := decimal.Zero(decimal.AmountScale)
+	for _, total := range totals {
+		debits, err := decimal.Parse(total.Debits)
+		if err != nil {
+			return nil, err
+		}
+		credits, err := decimal.Parse(total.Credits)
+		if err != nil {
+			return nil, err
+		}
+
+		report.Accounts = append(report.Accounts, models.TrialBalanceLine{
+			AccountType: total.AccountType,
+			Debits:      roundAmount(debits).String(),
+			Credits:     roundAmount(credits).String(),
+			Net:         roundAmount(debits.Sub(credits)).String(),
+		})
+		totalDebits = totalDebits.Add(debits)
+		totalCredits = totalCredits.Add(credits)
+	}
+
+	report.TotalDebits = roundAmount(totalDebits).String()
+	report.TotalCredits = roundAmount(totalCredits).String()
+	report.Balanced = totalDebits.Equal(totalCredits)
+
+	if !report.Balanced {
+		s.logger.WithFields(logrus.Fields{
+			"from":          report.From,
+			"to":            report.To,
+			"total_debits":  report.TotalDebits,
+			"total_credits": report.TotalCredits,
+		}).Warn("Trial balance does not balance")
+	}
+
+	return report, nil
+}
@@ -0,0 +1,79 @@
+package services
+
+import (
+	"context"
+	"stocky/internal/models"
+	"testing"
+	"time"
+)
+
+func TestGetTrialBalance(t *testing.T) {
+	store := newTestStore(t)
+	ctx := context.Background()
+	journals := []models.Journal{
+		{JournalType: JournalTypeReward, Lines: []models.JournalLine{
+			journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "1000.0000"),
+			journalLine("FEE_EXPENSE", AccountFeeExpense, SideDebit, "10.5000"),
+			journalLine("CASH_CREDIT", AccountCompanyCash, SideCredit, "1010.5000"),
+		}},
+		{JournalType: JournalTypeReward, Lines: []models.JournalLine{
+			journalLine("REWARD_EXPENSE", AccountRewardExpense, SideDebit, "1000.0000"),
+			journalLine("STOCK_CREDIT", SymbolAccount(AccountUserStockLiability, "TCS"), SideCredit, "1000.0000"),
+		}},
+	}
+	for _, j := range journals {
+		if _, err := PostJournal(store.Ledger(), j); err != nil {
+			t.Fatal(err)
+		}
+	}
+	service := NewLedgerService(store, testLocation, discardLogger())
+	today := time.Now().In(testLocation)
+
+	report, err := service.GetTrialBalance(ctx, today.AddDate(0, 0, -1), today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.Balanced || report.TotalDebits != "2010.5000" || report.TotalCredits != "2010.5000" {
+		t.Errorf("totals = %s debits, %s credits, balanced %t; want 2010.5000 each and balanced",
+			report.TotalDebits, report.TotalCredits, report.Balanced)
+	}
+	want := []models.TrialBalanceLine{
+		{AccountType: "CASH", Debits: "0.0000", Credits: "1010.5000", Net: "-1010.5000"},
+		{AccountType: "EXPENSE", Debits: "1000.0000", Credits: "0.0000", Net: "1000.0000"},
+		{AccountType: "FEES", Debits: "10.5000", Credits: "0.0000", Net: "10.5000"},
+		{AccountType: "STOCK", Debits: "1000.0000", Credits: "0.0000", Net: "1000.0000"},
+		{AccountType: "USER_STOCK", Debits: "0.0000", Credits: "1000.0000", Net: "-1000.0000"},
+	}
+	if len(report.Accounts) != len(want) {
+		t.Fatalf("accounts = %+v, want %+v", report.Accounts, want)
+	}
+	for i, line := range report.Accounts {
+		if line != want[i] {
+			t.Errorf("account %d = %+v, want %+v", i, line, want[i])
+		}
+	}
+
+	// Nothing was posted before yesterday
+	empty, err := service.GetTrialBalance(ctx, today.AddDate(0, 0, -10), today.AddDate(0, 0, -2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(empty.Accounts) != 0 || !empty.Balanced || empty.TotalDebits != "0.0000" {
+		t.Errorf("earlier range = %+v, want no accounts", empty)
+	}
+
+	// An entry written around PostJournal's check shows up as an imbalance
+	_, err = store.Ledger().PostJournal(models.Journal{JournalType: JournalTypeReward, Lines: []models.JournalLine{
+		journalLine("STOCK_PURCHASE", AccountStockInventory, SideDebit, "0.0001"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err = service.GetTrialBalance(ctx, today, today)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Balanced || report.TotalDebits != "2010.5001" {
+		t.Errorf("totals = %s debits, balanced %t; want 2010.5001 and unbalanced", report.TotalDebits, report.Balanced)
+	}
+}
@@ -1,280 +1,392 @@
 package services
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
+	"stocky/internal/decimal"
 	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+var (
+	ErrStaleValuation       = errors.New("prices too stale to value portfolio")
+	ErrInvalidBackfillRange = errors.New("invalid backfill range")
+)
+
+// StalePrice is a holding whose price is missing or older than the staleness threshold
+type StalePrice struct {
+	StockSymbol string     `json:"stock_symbol"`
+	PriceAsOf   *time.Time `json:"price_as_of"` // Nil when there is no price at all
+}
+
+// StaleValuationError refuses a valuation and lists the prices that caused it
+type StaleValuationError struct {
+	Prices []StalePrice
+}
+
+func (e *StaleValuationError) Error() string {
+	symbols := make([]string, len(e.Prices))
+	for i, p := range e.Prices {
+		symbols[i] = p.StockSymbol
+	}
+	return fmt.Sprintf("%s: %s", ErrStaleValuation, strings.Join(symbols, ", "))
+}
+
+func (e *StaleValuationError) Unwrap() error {
+	return ErrStaleValuation
+}
+
+// ErrorDetails lists the prices that caused the refusal
+func (e *StaleValuationError) ErrorDetails() interface{} {
+	return map[string]interface{}{"stale_prices": e.Prices}
+}
+
 type PortfolioService struct {
-	db                *sql.DB
+	store             repository.Store
 	stockPriceService *StockPriceService
 	logger            *logrus.Logger
+	// Fail valuations that would use a stale price instead of flagging them
+	rejectStale bool
+	// Business timezone; snapshot dates are days in it
+	location *time.Location
 }
 
-func NewPortfolioService(db *sql.DB, stockPriceService *StockPriceService, logger *logrus.Logger) *PortfolioService {
+func NewPortfolioService(store repository.Store, stockPriceService *StockPriceService, rejectStale bool, location *time.Location, logger *logrus.Logger) *PortfolioService {
 	return &PortfolioService{
-		db:                db,
+		store:             store,
 		stockPriceService: stockPriceService,
 		logger:            logger,
+		rejectStale:       rejectStale,
+		location:          location,
 	}
 }
 
-// GetHistoricalINR returns the INR value of user's stock rewards for all past days
-func (s *PortfolioService) GetHistoricalINR(userID string) ([]models.HistoricalINR, error) {
-	rows, err := s.db.Query(`
-		SELECT snapshot_date, SUM(total_inr_value) as daily_value
-		FROM portfolio_snapshots
-		WHERE user_id = $1 
-		AND snapshot_date < CURRENT_DATE
-		GROUP BY snapshot_date
-		ORDER BY snapshot_date DESC
-	`, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	var historical []models.HistoricalINR
-	for rows.Next() {
-		var h models.HistoricalINR
-		var date time.Time
-		var value string
-		if err := rows.Scan(&date, &value); err != nil {
-			return nil, err
-		}
-		h.Date = date.Format("2006-01-02")
-		h.Value = value
-		historical = append(historical, h)
-	}
-
-	return historical, rows.Err()
+// GetHistoricalINR returns the INR value of user's stock rewards for all days before today
+// in loc. Snapshots are end-of-day values in the business timezone whatever loc is; loc
+// only decides which day is today. A nil loc means the business timezone.
+func (s *PortfolioService) GetHistoricalINR(ctx context.Context, userID string, loc *time.Location) ([]models.HistoricalINR, error) {
+	return s.store.WithContext(ctx).Snapshots().DailyValues(userID, todayIn(orLocation(loc, s.location)))
 }
 
-// GetStats returns user statistics
-func (s *PortfolioService) GetStats(userID string) (*models.Stats, error) {
-	stats := &models.Stats{
-		TotalSharesToday: make(map[string]string),
-	}
-
-	// Get total shares rewarded today (grouped by stock symbol)
-	rows, err := s.db.Query(`
-		SELECT stock_symbol, SUM(quantity) as total_quantity
-		FROM reward_events
-		WHERE user_id = $1 
-		AND DATE(reward_timestamp) = CURRENT_DATE
-		GROUP BY stock_symbol
-	`, userID)
+// GetStats returns user statistics, with today and timestamps in loc (nil for the business timezone)
+func (s *PortfolioService) GetStats(ctx context.Context, userID string, loc *time.Location) (*models.Stats, error) {
+	loc = orLocation(loc, s.location)
+	start, end, err := dayBounds(todayIn(loc), loc)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	for rows.Next() {
-		var symbol, quantity string
-		if err := rows.Scan(&symbol, &quantity); err != nil {
-			return nil, err
-		}
-		stats.TotalSharesToday[symbol] = quantity
+	// Get total shares rewarded today (grouped by stock symbol), net of reversals
+	totals, err := s.store.WithContext(ctx).Rewards().RewardedQuantitiesBetween(userID, start, end)
+	if err != nil {
+		return nil, err
 	}
-	rows.Close()
 
 	// Get current portfolio value
-	currentValue, err := s.calculateCurrentPortfolioValue(userID)
+	portfolio, err := s.GetPortfolio(ctx, userID, loc)
 	if err != nil {
 		return nil, err
 	}
-	stats.CurrentPortfolioValue = currentValue
 
-	return stats, nil
+	return &models.Stats{
+		TotalSharesToday:      totals,
+		CurrentPortfolioValue: portfolio.TotalValue,
+		PricesAsOf:            portfolio.PricesAsOf,
+		Stale:                 portfolio.Stale,
+	}, nil
 }
 
-// GetPortfolio returns user portfolio with holdings per stock
-func (s *PortfolioService) GetPortfolio(userID string) (*models.Portfolio, error) {
+// GetPortfolio returns user portfolio with holdings per stock, each valued at its latest
+// price with the time that price was taken. With rejectStale set, a portfolio holding any
+// stale price is refused with a *StaleValuationError instead. Timestamps are given in loc,
+// or the business timezone when loc is nil.
+func (s *PortfolioService) GetPortfolio(ctx context.Context, userID string, loc *time.Location) (*models.Portfolio, error) {
+	loc = orLocation(loc, s.location)
+
 	// Get all holdings for user
-	rows, err := s.db.Query(`
-		SELECT stock_symbol, SUM(quantity) as total_quantity
-		FROM reward_events
-		WHERE user_id = $1
-		GROUP BY stock_symbol
-	`, userID)
+	holdings, err := s.store.WithContext(ctx).Rewards().Holdings(userID, time.Now())
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
 	portfolio := &models.Portfolio{
 		Holdings: []models.Holding{},
 	}
 
-	var totalValue float64
-	for rows.Next() {
-		var symbol, quantity string
-		if err := rows.Scan(&symbol, &quantity); err != nil {
-			return nil, err
-		}
+	totalValue := decimal.Zero(decimal.AmountScale)
+	var stale []StalePrice
+	for _, h := range holdings {
+		symbol, quantity := h.StockSymbol, h.Quantity
 
 		// Get current price
-		price, err := s.stockPriceService.GetLatestPrice(s.db, symbol)
+		quote, err := s.stockPriceService.GetLatestPrice(ctx, symbol)
 		if err != nil {
-			s.logger.WithError(err).WithField("stock_symbol", symbol).Warn("Failed to get price")
-			price = "0.0000"
+			if ctxErr := ctx.Err(); ctxErr != nil {
+				// Out of time; valuing the rest at zero would misstate the portfolio
+				return nil, ctxErr
+			}
+			s.logger.WithError(err).WithField("stock_symbol", symbol).Warn("Failed to get price, using 0")
+			quote = &PriceQuote{Price: "0.0000", Status: InstrumentActive, Stale: true}
+		}
+		if quote.PricedAt != nil {
+			pricedAt := quote.PricedAt.In(loc)
+			quote.PricedAt = &pricedAt
 		}
 
 		// Calculate current value
-		value := multiplyAmounts(quantity, price)
+		value, err := valueOf(quantity, quote.Price)
+		if err != nil {
+			return nil, err
+		}
 
 		holding := models.Holding{
 			StockSymbol:  symbol,
+			CompanyName:  quote.CompanyName,
+			Exchange:     quote.Exchange,
 			Quantity:     quantity,
-			CurrentPrice: price,
-			CurrentValue: value,
+			CurrentPrice: quote.Price,
+			CurrentValue: value.String(),
+			Status:       quote.Status,
+			PriceAsOf:    quote.PricedAt,
+			PriceStale:   quote.Stale,
 		}
 		portfolio.Holdings = append(portfolio.Holdings, holding)
 
-		var val float64
-		_, _ = fmt.Sscanf(value, "%f", &val)
-		totalValue += val
+		totalValue = totalValue.Add(value)
+		if quote.PricedAt != nil && (portfolio.PricesAsOf == nil || quote.PricedAt.Before(*portfolio.PricesAsOf)) {
+			portfolio.PricesAsOf = quote.PricedAt
+		}
+		if quote.Stale {
+			portfolio.Stale = true
+			stale = append(stale, StalePrice{StockSymbol: symbol, PriceAsOf: quote.PricedAt})
+		}
+	}
+
+	if len(stale) > 0 && s.rejectStale {
+		return nil, &StaleValuationError{Prices: stale}
 	}
 
-	portfolio.TotalValue = fmt.Sprintf("%.4f", totalValue)
-	return portfolio, rows.Err()
+	portfolio.TotalValue = totalValue.String()
+	return portfolio, nil
 }
 
-// calculateCurrentPortfolioValue calculates the current INR value of user's portfolio
-func (s *PortfolioService) calculateCurrentPortfolioValue(userID string) (string, error) {
-	// Get all holdings
-	rows, err := s.db.Query(`
-		SELECT stock_symbol, SUM(quantity) as total_quantity
-		FROM reward_events
-		WHERE user_id = $1
-		GROUP BY stock_symbol
-	`, userID)
+// UpdatePortfolioSnapshots creates daily snapshots for all users, stopping once ctx is done
+func (s *PortfolioService) UpdatePortfolioSnapshots(ctx context.Context) error {
+	// Get all unique user IDs
+	userIDs, err := s.store.WithContext(ctx).Rewards().UserIDs()
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer rows.Close()
 
-	var totalValue float64
-	for rows.Next() {
-		var symbol, quantity string
-		if err := rows.Scan(&symbol, &quantity); err != nil {
-			return "", err
+	// Get yesterday's date in the business timezone
+	yesterday := yesterdayIn(s.location).Format("2006-01-02")
+
+	// Create snapshots for each user
+	for _, userID := range userIDs {
+		if err := ctx.Err(); err != nil {
+			return err
 		}
+		if _, err := s.writeSnapshot(ctx, userID, yesterday); err != nil {
+			s.logger.WithError(err).WithField("user_id", userID).Error("Failed to write snapshot")
+		}
+	}
 
-		// Get current price
-		price, err := s.stockPriceService.GetLatestPrice(s.db, symbol)
+	s.logger.Info("Portfolio snapshots updated")
+	return nil
+}
+
+// RebuildSnapshots rewrites the snapshots of the given users for every date in [from, to]
+func (s *PortfolioService) RebuildSnapshots(ctx context.Context, userIDs []string, from, to time.Time) error {
+	_, err := s.rebuildSnapshots(ctx, userIDs, from, to)
+	return err
+}
+
+// BackfillSnapshots regenerates snapshots for every date in [from, to] for the given users,
+// or for every rewarded user when none are given, valuing each date at the price effective
+// on it. Rows are upserted, so overlapping or repeated backfills are harmless.
+func (s *PortfolioService) BackfillSnapshots(ctx context.Context, userIDs []string, from, to time.Time) (*models.SnapshotBackfill, error) {
+	fromDate, toDate := from.Format("2006-01-02"), to.Format("2006-01-02")
+	if fromDate > toDate {
+		return nil, fmt.Errorf("%w: from %s is after to %s", ErrInvalidBackfillRange, fromDate, toDate)
+	}
+	if today := todayIn(s.location); toDate >= today {
+		return nil, fmt.Errorf("%w: snapshots are end-of-day values, so to must be before %s", ErrInvalidBackfillRange, today)
+	}
+
+	if len(userIDs) == 0 {
+		var err error
+		userIDs, err = s.store.WithContext(ctx).Rewards().UserIDs()
 		if err != nil {
-			s.logger.WithError(err).WithField("stock_symbol", symbol).Warn("Failed to get price, using 0")
-			price = "0.0000"
+			return nil, err
 		}
+	}
 
-		// Calculate value
-		value := multiplyAmounts(quantity, price)
-		var val float64
-		_, _ = fmt.Sscanf(value, "%f", &val)
-		totalValue += val
+	written, err := s.rebuildSnapshots(ctx, userIDs, from, to)
+	if err != nil {
+		return nil, err
 	}
 
-	return fmt.Sprintf("%.4f", totalValue), rows.Err()
+	result := &models.SnapshotBackfill{
+		From:             fromDate,
+		To:               toDate,
+		Users:            len(userIDs),
+		Days:             int(to.Sub(from).Hours()/24) + 1,
+		SnapshotsWritten: written,
+	}
+	s.logger.WithFields(logrus.Fields{
+		"from":              result.From,
+		"to":                result.To,
+		"users":             result.Users,
+		"snapshots_written": result.SnapshotsWritten,
+	}).Info("Portfolio snapshots backfilled")
+	return result, nil
 }
 
-// UpdatePortfolioSnapshots creates daily snapshots for all users
-func (s *PortfolioService) UpdatePortfolioSnapshots() error {
-	// Get all unique user IDs
-	rows, err := s.db.Query(`SELECT DISTINCT user_id FROM reward_events`)
+// RecomputeInvalidatedSnapshots rebuilds the snapshots of every user marked by
+// invalidateSnapshots, from the earliest dirty date to yesterday, and returns how many
+// users were recomputed. A user that fails stays marked and is retried on the next run.
+func (s *PortfolioService) RecomputeInvalidatedSnapshots(ctx context.Context) (int, error) {
+	snapshots := s.store.WithContext(ctx).Snapshots()
+	invalidations, err := snapshots.Invalidations()
 	if err != nil {
-		return err
+		return 0, err
 	}
-	defer rows.Close()
 
-	var userIDs []string
-	for rows.Next() {
-		var userID string
-		if err := rows.Scan(&userID); err != nil {
-			return err
+	to := yesterdayIn(s.location)
+
+	recomputed := 0
+	for _, inv := range invalidations {
+		logger := s.logger.WithFields(logrus.Fields{
+			"user_id":    inv.UserID,
+			"dirty_from": inv.DirtyFrom,
+		})
+
+		from, err := time.Parse("2006-01-02", inv.DirtyFrom)
+		if err != nil {
+			return recomputed, err
+		}
+		// Dates from today onwards have no snapshot yet; the daily job writes them
+		if !from.After(to) {
+			written, err := s.rebuildSnapshots(ctx, []string{inv.UserID}, from, to)
+			if err != nil {
+				logger.WithError(err).Error("Failed to recompute invalidated snapshots")
+				continue
+			}
+			logger.WithField("snapshots_written", written).Info("Recomputed invalidated snapshots")
 		}
-		userIDs = append(userIDs, userID)
+
+		if err := snapshots.ClearInvalidation(inv); err != nil {
+			return recomputed, err
+		}
+		recomputed++
 	}
+	return recomputed, nil
+}
 
-	if err = rows.Err(); err != nil {
-		return err
+// invalidateSnapshots marks a user's snapshots dirty from the date in loc a holding change
+// takes effect, when that date already has a snapshot. Rewards can be backdated; adjustments
+// take effect when recorded, so they only reach back when the day rolled over mid-request.
+func invalidateSnapshots(tx repository.Store, loc *time.Location, userID string, effectiveAt time.Time) error {
+	date := dateIn(effectiveAt, loc)
+	if date >= todayIn(loc) {
+		return nil
 	}
+	return tx.Snapshots().Invalidate(userID, date)
+}
 
-	// Get yesterday's date
-	yesterday := time.Now().AddDate(0, 0, -1).Format("2006-01-02")
+func (s *PortfolioService) rebuildSnapshots(ctx context.Context, userIDs []string, from, to time.Time) (int, error) {
+	written := 0
+	for date := from; !date.After(to); date = date.AddDate(0, 0, 1) {
+		for _, userID := range userIDs {
+			n, err := s.writeSnapshot(ctx, userID, date.Format("2006-01-02"))
+			if err != nil {
+				return written, fmt.Errorf("snapshot of %s on %s: %w", userID, date.Format("2006-01-02"), err)
+			}
+			written += n
+		}
+	}
+	return written, nil
+}
 
-	// Create snapshots for each user
-	for _, userID := range userIDs {
-		// Get holdings per stock
-		holdingsRows, err := s.db.Query(`
-			SELECT stock_symbol, SUM(quantity) as total_quantity
-			FROM reward_events
-			WHERE user_id = $1
-			AND DATE(reward_timestamp) <= $2
-			GROUP BY stock_symbol
-		`, userID, yesterday)
-		if err != nil {
-			s.logger.WithError(err).WithField("user_id", userID).Error("Failed to get holdings")
+// writeSnapshot upserts one user's holdings at the end of date in the business timezone,
+// valued at the price effective then, and returns how many rows it wrote
+func (s *PortfolioService) writeSnapshot(ctx context.Context, userID, date string) (int, error) {
+	store := s.store.WithContext(ctx)
+	_, end, err := dayBounds(date, s.location)
+	if err != nil {
+		return 0, err
+	}
+	snapshotDate, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return 0, err
+	}
+
+	// Get holdings per stock, net of reversals and corporate actions. Symbols that
+	// netted to zero are still written so an earlier snapshot for the date is overwritten.
+	holdings, err := store.Rewards().HoldingsBefore(userID, end)
+	if err != nil {
+		return 0, err
+	}
+
+	written := 0
+	for _, h := range holdings {
+		price, err := s.snapshotPrice(store.Prices(), h.StockSymbol, date, end)
+		if errors.Is(err, ErrPriceUnavailable) {
+			// Leave the symbol out rather than recording a fake zero valuation
+			s.logger.WithFields(logrus.Fields{
+				"user_id":      userID,
+				"stock_symbol": h.StockSymbol,
+				"date":         date,
+			}).Warn("No price found for snapshot, skipping symbol")
 			continue
+		} else if err != nil {
+			return written, err
 		}
 
-		for holdingsRows.Next() {
-			var symbol, quantity string
-			if err := holdingsRows.Scan(&symbol, &quantity); err != nil {
-				holdingsRows.Close()
-				return err
-			}
-
-			// Get price for yesterday (or latest available)
-			var price string
-			err = s.db.QueryRow(`
-				SELECT price FROM stock_prices 
-				WHERE stock_symbol = $1 
-				AND DATE(price_timestamp) <= $2
-				ORDER BY price_timestamp DESC 
-				LIMIT 1
-			`, symbol, yesterday).Scan(&price)
-
-			if err == sql.ErrNoRows {
-				// No price available, use 0
-				price = "0.0000"
-				s.logger.WithFields(logrus.Fields{
-					"user_id": userID,
-					"stock_symbol": symbol,
-					"date": yesterday,
-				}).Warn("No price found for snapshot")
-			} else if err != nil {
-				holdingsRows.Close()
-				return err
-			}
+		// Calculate total value
+		totalValue, err := valueOf(h.Quantity, price)
+		if err != nil {
+			return written, err
+		}
 
-			// Calculate total value
-			totalValue := multiplyAmounts(quantity, price)
-
-			// Insert or update snapshot
-			_, err = s.db.Exec(`
-				INSERT INTO portfolio_snapshots (user_id, snapshot_date, stock_symbol, total_quantity, price_per_unit, total_inr_value)
-				VALUES ($1, $2, $3, $4, $5, $6)
-				ON CONFLICT (user_id, snapshot_date, stock_symbol) DO UPDATE
-				SET total_quantity = EXCLUDED.total_quantity,
-				    price_per_unit = EXCLUDED.price_per_unit,
-				    total_inr_value = EXCLUDED.total_inr_value
-			`, userID, yesterday, symbol, quantity, price, totalValue)
-			if err != nil {
-				holdingsRows.Close()
-				return err
-			}
+		// Insert or update snapshot
+		err = store.Snapshots().Save(models.PortfolioSnapshot{
+			UserID:        userID,
+			SnapshotDate:  snapshotDate,
+			StockSymbol:   h.StockSymbol,
+			TotalQuantity: h.Quantity,
+			PricePerUnit:  price,
+			TotalINRValue: totalValue.String(),
+		})
+		if err != nil {
+			return written, err
 		}
-		holdingsRows.Close()
+		written++
 	}
 
-	s.logger.Info("Portfolio snapshots updated")
-	return nil
+	return written, nil
 }
 
-// Note: multiplyAmounts is defined in reward_service.go (same package)
+// snapshotPrice returns the price used to value a symbol on date, which ends at end: the
+// last price before end, or zero once a delisted instrument is written off. A later price
+// is never used, so a date before the first stored price is ErrPriceUnavailable.
+func (s *PortfolioService) snapshotPrice(prices repository.PriceRepository, symbol, date string, end time.Time) (string, error) {
+	instrument, err := getInstrument(prices, symbol)
+	if err != nil {
+		return "", err
+	}
+	if writtenOffBefore(instrument, end) {
+		return "0.0000", nil
+	}
 
+	price, err := prices.LatestBefore(symbol, end)
+	if errors.Is(err, repository.ErrNotFound) {
+		return "", fmt.Errorf("%w: no stored price for %s on or before %s", ErrPriceUnavailable, symbol, date)
+	}
+	return price, err
+}
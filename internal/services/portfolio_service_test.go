@@ -0,0 +1,90 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"testing"
+	"time"
+)
+
+func TestBackfillSnapshots(t *testing.T) {
+	// newTestStore's price an hour ago may fall on yesterday, so price TCS only in the past
+	store := repository.NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "TCS", Status: InstrumentActive, Exchange: "NSE"})
+	ctx := context.Background()
+	today := time.Now().In(testLocation)
+	if err := store.Prices().Save("TCS", "3000.0000", today.AddDate(0, 0, -10)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestRewardService(store).CreateReward(ctx, "u1", "TCS", "2", "NSE", "evt-1", today.AddDate(0, 0, -2)); err != nil {
+		t.Fatal(err)
+	}
+	portfolio := NewPortfolioService(store, nil, false, testLocation, discardLogger())
+
+	from, to := today.AddDate(0, 0, -3), today.AddDate(0, 0, -1)
+	result, err := portfolio.BackfillSnapshots(ctx, nil, from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Users != 1 || result.Days != 3 || result.SnapshotsWritten != 2 {
+		t.Errorf("backfill = %+v, want 1 user over 3 days with 2 snapshots", result)
+	}
+
+	// Nothing was held on the first day; the reward is valued at the price effective then
+	historical, err := portfolio.GetHistoricalINR(ctx, "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(historical) != 2 {
+		t.Fatalf("historical = %+v, want 2 days", historical)
+	}
+	for _, day := range historical {
+		if day.Value != "6000.0000" {
+			t.Errorf("value on %s = %s, want 6000.0000", day.Date, day.Value)
+		}
+	}
+	if historical[0].Date != to.Format("2006-01-02") {
+		t.Errorf("latest day = %s, want %s first", historical[0].Date, to.Format("2006-01-02"))
+	}
+
+	if _, err := portfolio.BackfillSnapshots(ctx, nil, to, from); !errors.Is(err, ErrInvalidBackfillRange) {
+		t.Errorf("reversed range: err = %v, want %v", err, ErrInvalidBackfillRange)
+	}
+}
+
+func TestSnapshotsSkipDatesBeforeFirstPrice(t *testing.T) {
+	store := repository.NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "TCS", Status: InstrumentActive, Exchange: "NSE"})
+	ctx := context.Background()
+	today := time.Now().In(testLocation)
+	if err := store.Prices().Save("TCS", "4000.0000", today.AddDate(0, 0, -2)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newTestRewardService(store).CreateReward(ctx, "u1", "TCS", "2", "NSE", "evt-1", today.AddDate(0, 0, -5)); err != nil {
+		t.Fatal(err)
+	}
+	portfolio := NewPortfolioService(store, nil, false, testLocation, discardLogger())
+
+	// Days before the first price are left out rather than valued at a later price
+	result, err := portfolio.BackfillSnapshots(ctx, nil, today.AddDate(0, 0, -5), today.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.SnapshotsWritten != 2 {
+		t.Errorf("wrote %d snapshots, want 2", result.SnapshotsWritten)
+	}
+	historical, err := portfolio.GetHistoricalINR(ctx, "u1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(historical) != 2 || historical[1].Date != today.AddDate(0, 0, -2).Format("2006-01-02") {
+		t.Fatalf("historical = %+v, want the 2 days from the first price", historical)
+	}
+	for _, day := range historical {
+		if day.Value != "8000.0000" {
+			t.Errorf("value on %s = %s, want 8000.0000", day.Date, day.Value)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PriceCache holds recently fetched provider prices. It is safe for concurrent use.
+// An entry is served as fresh until its TTL passes; after that the next read refetches,
+// and only if that fetch fails is the old price served, flagged stale. Nothing older
+// than maxAge is ever served. Concurrent misses for one symbol share a single fetch,
+// which no single caller owns: each caller stops waiting when its own context is done,
+// while the fetch runs on until fetchTimeout for the others.
+type PriceCache struct {
+	ttl          time.Duration
+	maxAge       time.Duration
+	fetchTimeout time.Duration // Bound on a shared fetch; zero leaves it to the provider
+	now          func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]priceEntry
+	calls   map[string]*priceCall // In-flight fetches by symbol
+
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	coalesced atomic.Uint64
+	staleHits atomic.Uint64
+}
+
+type priceEntry struct {
+	price     string
+	fetchedAt time.Time
+}
+
+type priceCall struct {
+	done  chan struct{}
+	price CachedPrice
+	err   error
+}
+
+// CachedPrice is a price served by the cache and how old it is
+type CachedPrice struct {
+	Price     string
+	FetchedAt time.Time
+	Stale     bool // Older than the TTL, served because a refetch failed
+}
+
+// PriceCacheStats counts how reads were served since the cache was created
+type PriceCacheStats struct {
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`     // Reads that fetched from the provider
+	Coalesced uint64 `json:"coalesced"`  // Misses that waited on another read's fetch
+	StaleHits uint64 `json:"stale_hits"` // Misses answered with a stale entry after the fetch failed
+	Entries   int    `json:"entries"`
+}
+
+func NewPriceCache(ttl, maxAge, fetchTimeout time.Duration) *PriceCache {
+	if maxAge < ttl {
+		maxAge = ttl
+	}
+	return &PriceCache{
+		ttl:          ttl,
+		maxAge:       maxAge,
+		fetchTimeout: fetchTimeout,
+		now:          time.Now,
+		entries:      make(map[string]priceEntry),
+		calls:        make(map[string]*priceCall),
+	}
+}
+
+// Get returns the cached price of symbol, calling fetch when there is no fresh entry.
+// fetch gets a context carrying ctx's values but not its cancellation, since its result
+// is shared with every caller that misses meanwhile.
+func (c *PriceCache) Get(ctx context.Context, symbol string, fetch func(ctx context.Context) (string, error)) (CachedPrice, error) {
+	c.mu.Lock()
+	now := c.now()
+	if entry, ok := c.entries[symbol]; ok && now.Sub(entry.fetchedAt) < c.ttl {
+		c.mu.Unlock()
+		c.hits.Add(1)
+		return CachedPrice{Price: entry.price, FetchedAt: entry.fetchedAt}, nil
+	}
+
+	call, ok := c.calls[symbol]
+	if ok {
+		c.coalesced.Add(1)
+	} else {
+		call = &priceCall{done: make(chan struct{})}
+		c.calls[symbol] = call
+		c.misses.Add(1)
+		go c.fetch(context.WithoutCancel(ctx), symbol, call, fetch)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.price, call.err
+	case <-ctx.Done():
+		return CachedPrice{}, ctx.Err()
+	}
+}
+
+// fetch runs a shared fetch for symbol and publishes its result to call
+func (c *PriceCache) fetch(ctx context.Context, symbol string, call *priceCall, fetch func(ctx context.Context) (string, error)) {
+	defer func() {
+		c.mu.Lock()
+		delete(c.calls, symbol)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	if c.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.fetchTimeout)
+		defer cancel()
+	}
+	price, err := fetch(ctx)
+	call.price, call.err = c.resolve(symbol, price, err)
+}
+
+// resolve turns the outcome of a fetch into the price served for symbol
+func (c *PriceCache) resolve(symbol, price string, err error) (CachedPrice, error) {
+	if err == nil {
+		return c.Set(symbol, price, c.now()), nil
+	}
+
+	// Fall back to the old entry while it is within maxAge
+	c.mu.Lock()
+	entry, ok := c.entries[symbol]
+	if ok && c.now().Sub(entry.fetchedAt) >= c.maxAge {
+		delete(c.entries, symbol)
+		ok = false
+	}
+	c.mu.Unlock()
+
+	if !ok {
+		return CachedPrice{}, err
+	}
+	c.staleHits.Add(1)
+	return CachedPrice{Price: entry.price, FetchedAt: entry.fetchedAt, Stale: true}, nil
+}
+
+// Set stores a price fetched at fetchedAt, unless a newer one is already cached
+func (c *PriceCache) Set(symbol, price string, fetchedAt time.Time) CachedPrice {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if entry, ok := c.entries[symbol]; ok && entry.fetchedAt.After(fetchedAt) {
+		return CachedPrice{Price: entry.price, FetchedAt: entry.fetchedAt}
+	}
+	c.entries[symbol] = priceEntry{price: price, fetchedAt: fetchedAt}
+	return CachedPrice{Price: price, FetchedAt: fetchedAt}
+}
+
+// Stats returns the cache counters and drops entries past maxAge
+func (c *PriceCache) Stats() PriceCacheStats {
+	c.mu.Lock()
+	now := c.now()
+	for symbol, entry := range c.entries {
+		if now.Sub(entry.fetchedAt) >= c.maxAge {
+			delete(c.entries, symbol)
+		}
+	}
+	entries := len(c.entries)
+	c.mu.Unlock()
+
+	return PriceCacheStats{
+		Hits:      c.hits.Load(),
+		Misses:    c.misses.Load(),
+		Coalesced: c.coalesced.Load(),
+		StaleHits: c.staleHits.Load(),
+		Entries:   entries,
+	}
+}
@@ -0,0 +1,223 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable clock for PriceCache.now
+type fakeClock struct {
+	mu sync.Mutex
+	t  time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.t = c.t.Add(d)
+}
+
+// fakeProvider answers with price, or err when set, and counts its calls
+type fakeProvider struct {
+	price string
+	err   error
+	calls atomic.Int32
+	gate  chan struct{} // When set, each call waits for it to be closed
+}
+
+func (p *fakeProvider) Name() string { return "fake" }
+
+func (p *fakeProvider) GetPrice(ctx context.Context, stockSymbol string) (string, error) {
+	p.calls.Add(1)
+	if p.gate != nil {
+		<-p.gate
+	}
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return p.price, p.err
+}
+
+func (p *fakeProvider) fetch(symbol string) func(ctx context.Context) (string, error) {
+	return func(ctx context.Context) (string, error) { return p.GetPrice(ctx, symbol) }
+}
+
+func newTestPriceCache(ttl, maxAge time.Duration) (*PriceCache, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)}
+	cache := NewPriceCache(ttl, maxAge, time.Second)
+	cache.now = clock.Now
+	return cache, clock
+}
+
+func TestPriceCacheTTL(t *testing.T) {
+	cache, clock := newTestPriceCache(time.Minute, time.Hour)
+	provider := &fakeProvider{price: "100.0000"}
+
+	first, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider.price = "101.0000"
+	clock.Advance(59 * time.Second)
+	cached, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cached.Price != "100.0000" || !cached.FetchedAt.Equal(first.FetchedAt) || provider.calls.Load() != 1 {
+		t.Errorf("within the TTL got %+v after %d fetches, want the cached price", cached, provider.calls.Load())
+	}
+
+	clock.Advance(time.Second)
+	refreshed, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if refreshed.Price != "101.0000" || refreshed.Stale || !refreshed.FetchedAt.Equal(clock.Now()) || provider.calls.Load() != 2 {
+		t.Errorf("after the TTL got %+v after %d fetches, want a refetch", refreshed, provider.calls.Load())
+	}
+
+	stats := cache.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Entries != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPriceCacheServesStaleUpToMaxAge(t *testing.T) {
+	cache, clock := newTestPriceCache(time.Minute, time.Hour)
+	provider := &fakeProvider{price: "100.0000"}
+	if _, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS")); err != nil {
+		t.Fatal(err)
+	}
+	fetchedAt := clock.Now()
+
+	provider.err = fmt.Errorf("%w: feed down", ErrPriceUnavailable)
+	clock.Advance(time.Hour - time.Second)
+	stale, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+	if err != nil {
+		t.Fatalf("within maxAge: %v", err)
+	}
+	if stale.Price != "100.0000" || !stale.Stale || !stale.FetchedAt.Equal(fetchedAt) {
+		t.Errorf("within maxAge got %+v, want the old price flagged stale", stale)
+	}
+
+	clock.Advance(time.Second)
+	if _, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS")); !errors.Is(err, ErrPriceUnavailable) {
+		t.Errorf("at maxAge: err = %v, want the provider error", err)
+	}
+	if stats := cache.Stats(); stats.StaleHits != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v, want one stale hit and the expired entry dropped", stats)
+	}
+
+	// A fetch that fails with nothing cached returns the error
+	if _, err := cache.Get(context.Background(), "INFY", provider.fetch("INFY")); !errors.Is(err, ErrPriceUnavailable) {
+		t.Errorf("uncached: err = %v, want the provider error", err)
+	}
+}
+
+func TestPriceCacheCoalescesMisses(t *testing.T) {
+	cache, _ := newTestPriceCache(time.Minute, time.Hour)
+	provider := &fakeProvider{price: "100.0000", gate: make(chan struct{})}
+
+	const readers = 8
+	var wg sync.WaitGroup
+	results := make([]CachedPrice, readers)
+	errs := make([]error, readers)
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results[i], errs[i] = cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+		}(i)
+	}
+
+	// Release the fetch once every other reader is waiting on it
+	deadline := time.Now().Add(5 * time.Second)
+	for cache.Stats().Coalesced < readers-1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("readers did not coalesce: %+v", cache.Stats())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(provider.gate)
+	wg.Wait()
+
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+	for i := range results {
+		if errs[i] != nil || results[i].Price != "100.0000" {
+			t.Errorf("reader %d got %+v, %v", i, results[i], errs[i])
+		}
+	}
+	if stats := cache.Stats(); stats.Misses != 1 || stats.Coalesced != readers-1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPriceCacheSetKeepsNewer(t *testing.T) {
+	cache, clock := newTestPriceCache(time.Minute, time.Hour)
+	cache.Set("TCS", "101.0000", clock.Now())
+	if got := cache.Set("TCS", "100.0000", clock.Now().Add(-time.Second)); got.Price != "101.0000" {
+		t.Errorf("Set with an older price = %+v, want the newer price kept", got)
+	}
+}
+
+func TestPriceCacheFetchOutlivesFirstCaller(t *testing.T) {
+	cache, _ := newTestPriceCache(time.Minute, time.Hour)
+	provider := &fakeProvider{price: "100.0000", gate: make(chan struct{})}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(ctx, "TCS", provider.fetch("TCS"))
+		first <- err
+	}()
+	waitFor(t, func() bool { return cache.Stats().Misses == 1 })
+
+	second := make(chan CachedPrice, 1)
+	go func() {
+		price, err := cache.Get(context.Background(), "TCS", provider.fetch("TCS"))
+		if err != nil {
+			t.Errorf("second caller: %v", err)
+		}
+		second <- price
+	}()
+
+	waitFor(t, func() bool { return cache.Stats().Coalesced == 1 })
+
+	// The first caller goes away; only it stops waiting
+	cancel()
+	if err := <-first; !errors.Is(err, context.Canceled) {
+		t.Errorf("first caller: err = %v, want context.Canceled", err)
+	}
+	close(provider.gate)
+	if price := <-second; price.Price != "100.0000" || price.Stale {
+		t.Errorf("second caller got %+v, want the fetched price", price)
+	}
+	if calls := provider.calls.Load(); calls != 1 {
+		t.Errorf("provider called %d times, want 1", calls)
+	}
+}
+
+// waitFor polls cond until it holds, failing the test after a few seconds
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not reached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,64 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"stocky/internal/config"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrPriceUnavailable = errors.New("price unavailable")
+)
+
+// PriceProvider is a source of current stock prices (NSE/BSE vendor, file feed, ...).
+// Prices are returned as NUMERIC(18, 4) strings. Providers that call out stop waiting
+// once ctx is done.
+type PriceProvider interface {
+	Name() string
+	GetPrice(ctx context.Context, stockSymbol string) (string, error)
+}
+
+// NewPriceProvider builds the provider selected by cfg.PriceProvider
+func NewPriceProvider(cfg *config.Config, logger *logrus.Logger) (PriceProvider, error) {
+	switch cfg.PriceProvider {
+	case "", "random":
+		return NewRandomPriceProvider(), nil
+	case "file":
+		return NewFilePriceProvider(cfg.PriceFeedFile, logger)
+	case "http":
+		return NewHTTPPriceProvider(cfg.PriceFeedURL, cfg.PriceFeedAPIKey, cfg.PriceFeedTimeout)
+	default:
+		return nil, fmt.Errorf("unknown price provider %q", cfg.PriceProvider)
+	}
+}
+
+// RandomPriceProvider returns random prices between 100 and 5000 INR.
+// It is meant for demos and local development only.
+type RandomPriceProvider struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func NewRandomPriceProvider() *RandomPriceProvider {
+	return &RandomPriceProvider{
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+func (p *RandomPriceProvider) Name() string {
+	return "random"
+}
+
+func (p *RandomPriceProvider) GetPrice(ctx context.Context, stockSymbol string) (string, error) {
+	p.mu.Lock()
+	basePrice := 100.0 + p.rnd.Float64()*4900.0
+	p.mu.Unlock()
+
+	return fmt.Sprintf("%.4f", basePrice), nil
+}
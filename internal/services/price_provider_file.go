@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"stocky/internal/decimal"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// FilePriceProvider serves deterministic prices from a CSV file with
+// "stock_symbol,price" rows (an optional header row is skipped).
+// The file is re-read whenever its modification time changes.
+type FilePriceProvider struct {
+	path   string
+	logger *logrus.Logger
+
+	mu      sync.RWMutex
+	prices  map[string]string
+	modTime time.Time
+}
+
+func NewFilePriceProvider(path string, logger *logrus.Logger) (*FilePriceProvider, error) {
+	p := &FilePriceProvider{
+		path:   path,
+		logger: logger,
+	}
+	if err := p.reloadIfChanged(); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func (p *FilePriceProvider) Name() string {
+	return "file"
+}
+
+func (p *FilePriceProvider) GetPrice(ctx context.Context, stockSymbol string) (string, error) {
+	if err := p.reloadIfChanged(); err != nil {
+		// Keep serving the last good copy of the file
+		p.logger.WithError(err).WithField("path", p.path).Warn("Failed to reload price file")
+	}
+
+	p.mu.RLock()
+	price, ok := p.prices[strings.ToUpper(stockSymbol)]
+	p.mu.RUnlock()
+
+	if !ok {
+		return "", fmt.Errorf("%w: %s not in price file", ErrPriceUnavailable, stockSymbol)
+	}
+	return price, nil
+}
+
+func (p *FilePriceProvider) reloadIfChanged() error {
+	info, err := os.Stat(p.path)
+	if err != nil {
+		return err
+	}
+
+	p.mu.RLock()
+	unchanged := p.prices != nil && info.ModTime().Equal(p.modTime)
+	p.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	prices, err := parsePriceCSV(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", p.path, err)
+	}
+
+	p.mu.Lock()
+	p.prices = prices
+	p.modTime = info.ModTime()
+	p.mu.Unlock()
+
+	p.logger.WithFields(logrus.Fields{
+		"path":  p.path,
+		"count": len(prices),
+	}).Info("Loaded price file")
+	return nil
+}
+
+func parsePriceCSV(r io.Reader) (map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+
+	prices := make(map[string]string)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		symbol := strings.ToUpper(strings.TrimSpace(record[0]))
+		price, err := decimal.Parse(record[1])
+		if err != nil {
+			if line == 1 {
+				// Header row
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if price.Sign() <= 0 {
+			return nil, fmt.Errorf("line %d: price must be positive", line)
+		}
+		prices[symbol] = roundAmount(price).String()
+	}
+
+	return prices, nil
+}
@@ -0,0 +1,109 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParsePriceCSV(t *testing.T) {
+	prices, err := parsePriceCSV(strings.NewReader("stock_symbol,price\ntcs, 3500.5\ninfy,1500.12345\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"TCS": "3500.5000", "INFY": "1500.1234"}
+	if len(prices) != len(want) {
+		t.Fatalf("prices = %v, want %v", prices, want)
+	}
+	for symbol, price := range want {
+		if prices[symbol] != price {
+			t.Errorf("%s = %s, want %s", symbol, prices[symbol], price)
+		}
+	}
+
+	// Without a header the first row is a price like any other
+	prices, err = parsePriceCSV(strings.NewReader("TCS,3500\n"))
+	if err != nil || prices["TCS"] != "3500.0000" {
+		t.Errorf("headerless: prices = %v, err = %v", prices, err)
+	}
+}
+
+func TestParsePriceCSVRejects(t *testing.T) {
+	tests := map[string]string{
+		"zero price":     "TCS,0\n",
+		"negative price": "symbol,price\nTCS,-3500\n",
+		"invalid price":  "symbol,price\nTCS,n/a\n",
+		"missing field":  "symbol,price\nTCS\n",
+		"extra field":    "symbol,price\nTCS,3500,NSE\n",
+		"unterminated":   "symbol,price\n\"TCS,3500\n",
+	}
+	for name, data := range tests {
+		if prices, err := parsePriceCSV(strings.NewReader(data)); err == nil {
+			t.Errorf("%s: prices = %v, want an error", name, prices)
+		}
+	}
+}
+
+func TestFilePriceProviderReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.csv")
+	modTime := time.Now().Add(-time.Hour)
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		// Step the mtime explicitly, as two quick writes can share one on coarse filesystems
+		modTime = modTime.Add(time.Minute)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ctx := context.Background()
+
+	write("symbol,price\nTCS,3500\n")
+	p, err := NewFilePriceProvider(path, discardLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(symbol string) (string, error) { return p.GetPrice(ctx, symbol) }
+
+	if price, err := get("tcs"); err != nil || price != "3500.0000" {
+		t.Errorf("tcs = %s, %v; want 3500.0000", price, err)
+	}
+	if _, err := get("INFY"); !errors.Is(err, ErrPriceUnavailable) {
+		t.Errorf("INFY: err = %v, want %v", err, ErrPriceUnavailable)
+	}
+
+	write("symbol,price\nTCS,3600\nINFY,1500\n")
+	if price, err := get("TCS"); err != nil || price != "3600.0000" {
+		t.Errorf("after reload TCS = %s, %v; want 3600.0000", price, err)
+	}
+	if price, err := get("INFY"); err != nil || price != "1500.0000" {
+		t.Errorf("after reload INFY = %s, %v; want 1500.0000", price, err)
+	}
+
+	// Same mtime, so the file is not re-read
+	if err := os.WriteFile(path, []byte("symbol,price\nTCS,3700\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+	if price, err := get("TCS"); err != nil || price != "3600.0000" {
+		t.Errorf("unchanged mtime TCS = %s, %v; want 3600.0000", price, err)
+	}
+
+	// A bad edit keeps the last good copy
+	write("symbol,price\nTCS,-1\n")
+	if price, err := get("TCS"); err != nil || price != "3600.0000" {
+		t.Errorf("after bad edit TCS = %s, %v; want 3600.0000", price, err)
+	}
+
+	if _, err := NewFilePriceProvider(filepath.Join(t.TempDir(), "missing.csv"), discardLogger()); err == nil {
+		t.Error("missing file: want an error")
+	}
+}
@@ -0,0 +1,91 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"stocky/internal/decimal"
+	"strings"
+	"time"
+)
+
+// HTTPPriceProvider fetches prices from a JSON feed.
+// It requests GET <baseURL>/<symbol> and expects a body such as
+// {"symbol": "RELIANCE", "price": "2450.5000"}; price may also be a JSON number.
+type HTTPPriceProvider struct {
+	baseURL string
+	apiKey  string
+	client  *http.Client
+}
+
+type httpPriceResponse struct {
+	Symbol string      `json:"symbol"`
+	Price  json.Number `json:"price"`
+}
+
+func NewHTTPPriceProvider(baseURL, apiKey string, timeout time.Duration) (*HTTPPriceProvider, error) {
+	if baseURL == "" {
+		return nil, errors.New("http price provider requires PRICE_FEED_URL")
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid PRICE_FEED_URL: %w", err)
+	}
+
+	return &HTTPPriceProvider{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		client:  &http.Client{Timeout: timeout},
+	}, nil
+}
+
+func (p *HTTPPriceProvider) Name() string {
+	return "http"
+}
+
+func (p *HTTPPriceProvider) GetPrice(ctx context.Context, stockSymbol string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.baseURL+"/"+url.PathEscape(stockSymbol), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if p.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+p.apiKey)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrPriceUnavailable, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", fmt.Errorf("%w: %s not found in price feed", ErrPriceUnavailable, stockSymbol)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%w: price feed returned status %d", ErrPriceUnavailable, resp.StatusCode)
+	}
+
+	var body httpPriceResponse
+	decoder := json.NewDecoder(io.LimitReader(resp.Body, 1<<20))
+	decoder.UseNumber()
+	if err := decoder.Decode(&body); err != nil {
+		return "", fmt.Errorf("decode price feed response: %w", err)
+	}
+	if body.Symbol != "" && !strings.EqualFold(body.Symbol, stockSymbol) {
+		return "", fmt.Errorf("price feed returned symbol %q for %q", body.Symbol, stockSymbol)
+	}
+
+	price, err := decimal.Parse(body.Price.String())
+	if err != nil {
+		return "", fmt.Errorf("price feed returned invalid price: %w", err)
+	}
+	if price.Sign() <= 0 {
+		return "", fmt.Errorf("price feed returned non-positive price %s", price)
+	}
+
+	return roundAmount(price).String(), nil
+}
@@ -0,0 +1,102 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestHTTPProvider(t *testing.T, timeout time.Duration, handler http.HandlerFunc) *HTTPPriceProvider {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	provider, err := NewHTTPPriceProvider(server.URL+"/prices/", "secret", timeout)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestHTTPPriceProvider(t *testing.T) {
+	provider := newTestHTTPProvider(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/prices/M&M" || r.Header.Get("Authorization") != "Bearer secret" {
+			t.Errorf("request %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		w.Write([]byte(`{"symbol": "M&M", "price": 2450.12345}`))
+	})
+
+	price, err := provider.GetPrice(context.Background(), "M&M")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if price != "2450.1234" {
+		t.Errorf("price = %s, want 2450.1234", price)
+	}
+}
+
+func TestHTTPPriceProviderErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		unavailable bool
+	}{
+		{name: "not found", status: http.StatusNotFound, unavailable: true},
+		{name: "server error", status: http.StatusBadGateway, body: `{"price": "1.00"}`, unavailable: true},
+		{name: "malformed JSON", status: http.StatusOK, body: `{"price": `},
+		{name: "wrong symbol", status: http.StatusOK, body: `{"symbol": "INFY", "price": "1500"}`},
+		{name: "invalid price", status: http.StatusOK, body: `{"price": "n/a"}`},
+		{name: "zero price", status: http.StatusOK, body: `{"price": 0}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := newTestHTTPProvider(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			})
+
+			price, err := provider.GetPrice(context.Background(), "TCS")
+			if err == nil {
+				t.Fatalf("got price %s, want an error", price)
+			}
+			if errors.Is(err, ErrPriceUnavailable) != tt.unavailable {
+				t.Errorf("err = %v, want ErrPriceUnavailable %v", err, tt.unavailable)
+			}
+		})
+	}
+}
+
+func TestHTTPPriceProviderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	provider := newTestHTTPProvider(t, 20*time.Millisecond, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	})
+
+	start := time.Now()
+	_, err := provider.GetPrice(context.Background(), "TCS")
+	if !errors.Is(err, ErrPriceUnavailable) {
+		t.Fatalf("err = %v, want ErrPriceUnavailable", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("GetPrice took %v despite a 20ms timeout", elapsed)
+	}
+}
+
+func TestHTTPPriceProviderCanceled(t *testing.T) {
+	provider := newTestHTTPProvider(t, time.Second, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"price": "1.00"}`))
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := provider.GetPrice(ctx, "TCS"); !errors.Is(err, ErrPriceUnavailable) {
+		t.Errorf("err = %v, want ErrPriceUnavailable", err)
+	}
+}
@@ -2,19 +2,19 @@ package services
 
 import (
 	"context"
-	"database/sql"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
-// StartPriceUpdateJob starts a background job that updates stock prices every hour
-func StartPriceUpdateJob(ctx context.Context, db *sql.DB, stockPriceService *StockPriceService, logger *logrus.Logger) {
+// StartPriceUpdateJob starts a background job that updates stock prices every hour.
+// Its queries run under ctx, so cancelling ctx on shutdown also stops a run in progress.
+func StartPriceUpdateJob(ctx context.Context, stockPriceService *StockPriceService, portfolioService *PortfolioService, corporateActionService *CorporateActionService, logger *logrus.Logger) {
 	ticker := time.NewTicker(1 * time.Hour)
 	defer ticker.Stop()
 
 	// Run immediately on start
-	updatePrices(db, stockPriceService, logger)
+	updatePrices(ctx, stockPriceService, portfolioService, corporateActionService, logger)
 
 	for {
 		select {
@@ -22,27 +22,49 @@ func StartPriceUpdateJob(ctx context.Context, db *sql.DB, stockPriceService *Sto
 			logger.Info("Price update job stopped")
 			return
 		case <-ticker.C:
-			updatePrices(db, stockPriceService, logger)
+			updatePrices(ctx, stockPriceService, portfolioService, corporateActionService, logger)
 		}
 	}
 }
 
-func updatePrices(db *sql.DB, stockPriceService *StockPriceService, logger *logrus.Logger) {
+func updatePrices(ctx context.Context, stockPriceService *StockPriceService, portfolioService *PortfolioService, corporateActionService *CorporateActionService, logger *logrus.Logger) {
 	logger.Info("Starting hourly price update")
 
 	// Update stock prices
-	if err := stockPriceService.UpdatePrices(db); err != nil {
+	if err := stockPriceService.UpdatePrices(ctx); err != nil {
+		if interrupted(ctx, logger) {
+			return
+		}
 		logger.WithError(err).Error("Failed to update stock prices")
 		return
 	}
 
+	// Apply corporate actions that became effective before valuing holdings
+	if err := corporateActionService.ApplyDueActions(ctx); err != nil {
+		if interrupted(ctx, logger) {
+			return
+		}
+		logger.WithError(err).Error("Failed to apply corporate actions")
+	}
+
 	// Update portfolio snapshots (for yesterday's data)
-	portfolioService := NewPortfolioService(db, stockPriceService, logger)
-	if err := portfolioService.UpdatePortfolioSnapshots(); err != nil {
+	if err := portfolioService.UpdatePortfolioSnapshots(ctx); err != nil {
+		if interrupted(ctx, logger) {
+			return
+		}
 		logger.WithError(err).Error("Failed to update portfolio snapshots")
 		return
 	}
 
-	logger.Info("Hourly price update completed")
+	logger.WithField("price_cache", stockPriceService.CacheStats()).Info("Hourly price update completed")
 }
 
+// interrupted reports whether a failed step was cut short by ctx, e.g. on shutdown,
+// rather than failing by itself
+func interrupted(ctx context.Context, logger *logrus.Logger) bool {
+	if ctx.Err() == nil {
+		return false
+	}
+	logger.Info("Hourly price update interrupted")
+	return true
+}
@@ -0,0 +1,267 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrRewardNotFound      = errors.New("reward not found")
+	ErrRewardFullyReversed = errors.New("reward already fully reversed")
+	ErrInvalidAdjustment   = errors.New("invalid adjustment quantity")
+	ErrRewardRestated      = errors.New("reward restated by a corporate action")
+)
+
+const (
+	AdjustmentTypeReversal   = "REVERSAL"
+	AdjustmentTypeAdjustment = "ADJUSTMENT"
+)
+
+// reversalEntryTypes names the entry that undoes an original reward entry.
+// Entry types not listed are reversed as "<type>_REVERSAL".
+var reversalEntryTypes = map[string]string{
+	"STOCK_CREDIT": "STOCK_DEBIT",
+	"CASH_DEBIT":   "CASH_CREDIT",
+}
+
+func reversalEntryType(entryType string) string {
+	if reversal, ok := reversalEntryTypes[entryType]; ok {
+		return reversal
+	}
+	return entryType + "_REVERSAL"
+}
+
+func originalEntryType(entryType string) (string, bool) {
+	for original, reversal := range reversalEntryTypes {
+		if reversal == entryType {
+			return original, true
+		}
+	}
+	if original, ok := strings.CutSuffix(entryType, "_REVERSAL"); ok {
+		return original, true
+	}
+	return entryType, false
+}
+
+func oppositeSide(side string) string {
+	if side == SideDebit {
+		return SideCredit
+	}
+	return SideDebit
+}
+
+// ReverseReward fully reverses whatever quantity of a reward is still outstanding
+func (s *RewardService) ReverseReward(ctx context.Context, rewardID, reason string) (*models.RewardAdjustment, error) {
+	return s.adjustReward(ctx, rewardID, nil, AdjustmentTypeReversal, reason)
+}
+
+// AdjustReward reduces a reward by quantity, leaving the rest in place
+func (s *RewardService) AdjustReward(ctx context.Context, rewardID, quantity, reason string) (*models.RewardAdjustment, error) {
+	qty, err := decimal.Parse(quantity)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAdjustment, err)
+	}
+	if qty.Sign() <= 0 || qty.Scale() > decimal.QuantityScale {
+		return nil, fmt.Errorf("%w: must be positive with at most %d decimal places", ErrInvalidAdjustment, decimal.QuantityScale)
+	}
+	return s.adjustReward(ctx, rewardID, &qty, AdjustmentTypeAdjustment, reason)
+}
+
+// adjustReward writes a reward_adjustments row and compensating ledger entries
+// proportional to the share of the outstanding quantity being removed.
+// A nil quantity removes everything that is left.
+func (s *RewardService) adjustReward(ctx context.Context, rewardID string, quantity *decimal.Decimal, adjustmentType, reason string) (*models.RewardAdjustment, error) {
+	var adjustment *models.RewardAdjustment
+	err := s.store.WithContext(ctx).InTx(func(tx repository.Store) error {
+		// Lock the reward so concurrent adjustments are applied one after another
+		reward, err := tx.Rewards().GetForUpdate(rewardID)
+		if errors.Is(err, repository.ErrNotFound) {
+			return ErrRewardNotFound
+		} else if err != nil {
+			return err
+		}
+
+		// Once a split or rename has restated the holding, the reward's own symbol and
+		// quantity no longer describe what the user holds; those need a manual correction
+		restated, err := tx.Rewards().RestatedAfter(reward.StockSymbol, reward.RewardTimestamp.In(s.location))
+		if err != nil {
+			return err
+		}
+		if restated {
+			return ErrRewardRestated
+		}
+
+		adjustedQuantity, err := tx.Rewards().AdjustedQuantity(rewardID)
+		if err != nil {
+			return err
+		}
+
+		original, err := decimal.Parse(reward.Quantity)
+		if err != nil {
+			return err
+		}
+		adjusted, err := decimal.Parse(adjustedQuantity)
+		if err != nil {
+			return err
+		}
+		outstanding := original.Add(adjusted)
+		if outstanding.Sign() <= 0 {
+			return ErrRewardFullyReversed
+		}
+
+		removed := outstanding
+		if quantity != nil {
+			if quantity.Cmp(outstanding) > 0 {
+				return fmt.Errorf("%w: only %s outstanding", ErrInvalidAdjustment, outstanding)
+			}
+			removed = *quantity
+		}
+		removed = removed.Round(decimal.QuantityScale, decimal.RoundDown)
+		fullReversal := removed.Equal(outstanding)
+
+		legs, err := remainingRewardLegs(tx.Ledger(), rewardID)
+		if err != nil {
+			return err
+		}
+
+		adjustment = &models.RewardAdjustment{
+			RewardEventID:     rewardID,
+			AdjustmentType:    adjustmentType,
+			Quantity:          removed.Neg().String(),
+			RemainingQuantity: outstanding.Sub(removed).String(),
+			Reason:            reason,
+		}
+		if err := tx.Rewards().CreateAdjustment(adjustment); err != nil {
+			return err
+		}
+
+		// Every leg still outstanding on the reward is reversed on the opposite side, in
+		// proportion to the quantity removed; the last reversal takes exactly what is left
+		// so nothing is stranded by rounding. The user's stock leg absorbs any rounding
+		// difference, which also keeps rewards posted before journals existed in balance.
+		lines := make([]models.JournalLine, 0, len(legs))
+		balancing := -1
+		debits := decimal.Zero(decimal.AmountScale)
+		credits := decimal.Zero(decimal.AmountScale)
+		for _, leg := range legs {
+			amount := leg.amount
+			if !fullReversal {
+				amount, err = amount.Mul(removed).Div(outstanding, decimal.AmountScale, amountRounding)
+				if err != nil {
+					return err
+				}
+			}
+
+			line := models.JournalLine{
+				EntryType:   reversalEntryType(leg.entryType),
+				AccountCode: leg.accountCode,
+				Side:        oppositeSide(leg.side),
+				Amount:      amount,
+				Description: fmt.Sprintf("%s reversal", leg.entryType),
+			}
+			if leg.stockSymbol != "" {
+				line.StockSymbol = leg.stockSymbol
+				line.Quantity = removed.String()
+			}
+			if leg.entryType == "STOCK_CREDIT" {
+				balancing = len(lines)
+			}
+			if line.Side == SideDebit {
+				debits = debits.Add(amount)
+			} else {
+				credits = credits.Add(amount)
+			}
+			lines = append(lines, line)
+		}
+
+		if imbalance := debits.Sub(credits); !imbalance.IsZero() && balancing >= 0 {
+			if lines[balancing].Side == SideDebit {
+				lines[balancing].Amount = lines[balancing].Amount.Sub(imbalance)
+			} else {
+				lines[balancing].Amount = lines[balancing].Amount.Add(imbalance)
+			}
+		}
+
+		_, err = PostJournal(tx.Ledger(), models.Journal{
+			JournalType:   JournalTypeRewardAdjustment,
+			RewardEventID: rewardID,
+			AdjustmentID:  adjustment.ID,
+			Description:   fmt.Sprintf("%s of %s %s", adjustmentType, removed, reward.StockSymbol),
+			Lines:         lines,
+		})
+		if err != nil {
+			return err
+		}
+
+		return invalidateSnapshots(tx, s.location, reward.UserID, adjustment.CreatedAt)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"reward_id":       rewardID,
+		"adjustment_id":   adjustment.ID,
+		"adjustment_type": adjustmentType,
+		"quantity":        adjustment.Quantity,
+	}).Info("Reward adjusted")
+
+	return adjustment, nil
+}
+
+// rewardLeg is what remains of one original ledger leg of a reward
+type rewardLeg struct {
+	entryType   string
+	accountCode string
+	side        string
+	stockSymbol string
+	amount      decimal.Decimal
+}
+
+// remainingRewardLegs returns the reward's original ledger legs with the
+// amounts already reversed by earlier adjustments subtracted
+func remainingRewardLegs(ledger repository.LedgerRepository, rewardID string) ([]*rewardLeg, error) {
+	entries, err := ledger.RewardEntries(rewardID)
+	if err != nil {
+		return nil, err
+	}
+
+	var legs []*rewardLeg
+	byType := make(map[string]*rewardLeg)
+	for _, entry := range entries {
+		amt, err := decimal.Parse(entry.Amount)
+		if err != nil {
+			return nil, err
+		}
+
+		if original, isReversal := originalEntryType(entry.EntryType); isReversal {
+			if leg, ok := byType[original]; ok {
+				leg.amount = leg.amount.Sub(amt)
+			}
+			continue
+		}
+
+		leg, ok := byType[entry.EntryType]
+		if !ok {
+			leg = &rewardLeg{
+				entryType:   entry.EntryType,
+				accountCode: entry.AccountCode.String,
+				side:        entry.Side,
+				stockSymbol: entry.StockSymbol.String,
+				amount:      decimal.Zero(decimal.AmountScale),
+			}
+			byType[entry.EntryType] = leg
+			legs = append(legs, leg)
+		}
+		leg.amount = leg.amount.Add(amt)
+	}
+
+	return legs, nil
+}
@@ -0,0 +1,165 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"testing"
+	"time"
+)
+
+// newAdjustmentStore prices X at 333.3333, so a third of a reward's legs do not
+// round to amounts that balance
+func newAdjustmentStore(t *testing.T) *repository.MemoryStore {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	store.SetInstrument(models.Instrument{StockSymbol: "X", Status: InstrumentActive, Exchange: "NSE"})
+	if err := store.Prices().Save("X", "333.3333", time.Now().Add(-time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+// adjustmentEntries returns the entries posted for an adjustment by entry type,
+// failing unless their debits and credits balance
+func adjustmentEntries(t *testing.T, store repository.Store, rewardID, adjustmentID string) map[string]models.LedgerEntry {
+	t.Helper()
+	entries, err := store.Ledger().RewardEntries(rewardID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byType := make(map[string]models.LedgerEntry)
+	balance := decimal.Zero(decimal.AmountScale)
+	for _, entry := range entries {
+		if entry.AdjustmentID.String != adjustmentID {
+			continue
+		}
+		byType[entry.EntryType] = entry
+		amount := decimal.MustParse(entry.Amount)
+		if entry.Side == SideCredit {
+			amount = amount.Neg()
+		}
+		balance = balance.Add(amount)
+	}
+	if len(byType) == 0 {
+		t.Fatalf("no entries posted for adjustment %s", adjustmentID)
+	}
+	if !balance.IsZero() {
+		t.Errorf("adjustment %s is out of balance by %s", adjustmentID, balance)
+	}
+	return byType
+}
+
+func TestAdjustRewardBalancesToThePaisa(t *testing.T) {
+	store := newAdjustmentStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+
+	reward, err := service.CreateReward(ctx, "u1", "X", "3", "NSE", "evt-1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	adjustment, err := service.AdjustReward(ctx, reward.ID, "1", "overpaid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment.AdjustmentType != AdjustmentTypeAdjustment || adjustment.Quantity != "-1.000000" || adjustment.RemainingQuantity != "2.000000" {
+		t.Errorf("adjustment = %+v", adjustment)
+	}
+
+	// A third of 999.9999 is 333.3333 on every trade-value leg, but a third of the fee
+	// expense and a third of each fee disagree in the last place; the user's stock leg
+	// takes the difference
+	entries := adjustmentEntries(t, store, reward.ID, adjustment.ID)
+	want := map[string]string{
+		"STOCK_PURCHASE_REVERSAL": "333.3333",
+		"CASH_CREDIT":             "333.3333",
+		"REWARD_EXPENSE_REVERSAL": "333.3333",
+		"STOCK_DEBIT":             "333.3334",
+	}
+	for entryType, amount := range want {
+		if got := entries[entryType].Amount; got != amount {
+			t.Errorf("%s = %s, want %s", entryType, got, amount)
+		}
+	}
+	if stock := entries["STOCK_DEBIT"]; stock.Side != SideDebit || stock.Quantity.String != "1.000000" {
+		t.Errorf("STOCK_DEBIT = %s %s of %s", stock.Side, stock.Amount, stock.Quantity.String)
+	}
+}
+
+func TestReverseReward(t *testing.T) {
+	store := newAdjustmentStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+
+	reward, err := service.CreateReward(ctx, "u1", "X", "3", "NSE", "evt-1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AdjustReward(ctx, reward.ID, "1", "overpaid"); err != nil {
+		t.Fatal(err)
+	}
+	reversal, err := service.ReverseReward(ctx, reward.ID, "cancelled")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reversal.AdjustmentType != AdjustmentTypeReversal || reversal.Quantity != "-2.000000" || reversal.RemainingQuantity != "0.000000" {
+		t.Errorf("reversal = %+v", reversal)
+	}
+	adjustmentEntries(t, store, reward.ID, reversal.ID)
+
+	// Together the adjustments take every leg back to zero, rounding included
+	legs, err := remainingRewardLegs(store.Ledger(), reward.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(legs) != 9 {
+		t.Errorf("%d legs, want 9", len(legs))
+	}
+	for _, leg := range legs {
+		if !leg.amount.IsZero() {
+			t.Errorf("%s still has %s after a full reversal", leg.entryType, leg.amount)
+		}
+	}
+
+	if _, err := service.ReverseReward(ctx, reward.ID, "again"); !errors.Is(err, ErrRewardFullyReversed) {
+		t.Errorf("reversing again: err = %v, want %v", err, ErrRewardFullyReversed)
+	}
+	if _, err := service.AdjustReward(ctx, reward.ID, "1", "again"); !errors.Is(err, ErrRewardFullyReversed) {
+		t.Errorf("adjusting a reversed reward: err = %v, want %v", err, ErrRewardFullyReversed)
+	}
+}
+
+func TestAdjustRewardQuantity(t *testing.T) {
+	store := newAdjustmentStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+
+	reward, err := service.CreateReward(ctx, "u1", "X", "3", "NSE", "evt-1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.AdjustReward(ctx, reward.ID, "1", "overpaid"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, quantity := range []string{"2.000001", "3", "0", "-1", "0.0000001", "abc"} {
+		if _, err := service.AdjustReward(ctx, reward.ID, quantity, "too much"); !errors.Is(err, ErrInvalidAdjustment) {
+			t.Errorf("AdjustReward(%s) = %v, want %v", quantity, err, ErrInvalidAdjustment)
+		}
+	}
+	if _, err := service.AdjustReward(ctx, "missing", "1", "typo"); !errors.Is(err, ErrRewardNotFound) {
+		t.Errorf("unknown reward: err = %v, want %v", err, ErrRewardNotFound)
+	}
+
+	// Refused adjustments leave nothing behind, and the whole outstanding quantity can still go
+	adjustment, err := service.AdjustReward(ctx, reward.ID, "2", "rest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if adjustment.RemainingQuantity != "0.000000" {
+		t.Errorf("remaining = %s, want 0.000000", adjustment.RemainingQuantity)
+	}
+}
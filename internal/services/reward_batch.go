@@ -0,0 +1,239 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidBatchMode = errors.New("invalid batch mode")
+
+// errDryRun rolls back the transaction of a dry run
+var errDryRun = errors.New("dry run")
+
+const (
+	// BatchModeAtomic writes every reward of a batch or none of them
+	BatchModeAtomic = "atomic"
+	// BatchModeBestEffort writes each reward on its own, whatever happens to the others
+	BatchModeBestEffort = "best_effort"
+)
+
+// Per-item outcomes of a reward batch
+const (
+	BatchStatusCreated    = "created"
+	BatchStatusDuplicate  = "duplicate"   // event_id already recorded with the same payload, possibly earlier in the batch
+	BatchStatusConflict   = "conflict"    // event_id already recorded with a different payload
+	BatchStatusInvalid    = "invalid"     // Rejected by validation; nothing was written for it
+	BatchStatusFailed     = "failed"      // Unexpected error; see the logs
+	BatchStatusRolledBack = "rolled_back" // Atomic batch: would have been created, undone with the rest
+	BatchStatusSkipped    = "skipped"     // Not attempted: another item of an atomic batch failed, or the deadline passed
+)
+
+// ParseBatchMode validates a batch mode name
+func ParseBatchMode(mode string) (string, error) {
+	switch mode {
+	case BatchModeAtomic, BatchModeBestEffort:
+		return mode, nil
+	}
+	return "", fmt.Errorf("%w: %q, use %s or %s", ErrInvalidBatchMode, mode, BatchModeAtomic, BatchModeBestEffort)
+}
+
+// BatchReward is one reward of a batch. Invalid is set when the item already failed
+// request validation; it is reported as invalid without being attempted.
+type BatchReward struct {
+	UserID          string
+	StockSymbol     string
+	Quantity        string
+	Exchange        string
+	EventID         string
+	RewardTimestamp time.Time
+	Invalid         error
+}
+
+// CreateRewardBatch creates many rewards in one call, reusing CreateReward's validation and
+// event_id duplicate detection, and reports an outcome per item in input order.
+// In atomic mode the first item that is not created rolls back the whole batch.
+// A dry run reports the same outcomes but rolls everything back.
+// Once ctx is done a best-effort batch reports the items it did not reach as skipped,
+// while an atomic batch fails with ctx's error.
+func (s *RewardService) CreateRewardBatch(ctx context.Context, rewards []BatchReward, mode string, dryRun bool) (*models.RewardBatch, error) {
+	if _, err := ParseBatchMode(mode); err != nil {
+		return nil, err
+	}
+
+	batch := &models.RewardBatch{Mode: mode, DryRun: dryRun, Results: make([]models.RewardBatchResult, len(rewards))}
+	items := make([]*pendingReward, len(rewards))
+	invalid := false
+	for i, r := range rewards {
+		batch.Results[i] = models.RewardBatchResult{Index: i, EventID: r.EventID}
+		err := r.Invalid
+		if err == nil {
+			items[i], err = s.newReward(r.UserID, r.StockSymbol, r.Quantity, r.Exchange, r.EventID, r.RewardTimestamp)
+		}
+		if err != nil {
+			batch.Results[i].Status = BatchStatusInvalid
+			batch.Results[i].Error = err.Error()
+			invalid = true
+		}
+	}
+
+	process := func(store repository.Store) {
+		if mode == BatchModeAtomic {
+			if invalid {
+				// Nothing is attempted when the batch cannot succeed as a whole
+				markPending(batch.Results, BatchStatusSkipped)
+				batch.RolledBack = true
+			} else {
+				s.createAtomicBatch(store, batch, items)
+			}
+			return
+		}
+		for i, item := range items {
+			if item == nil {
+				continue
+			}
+			if ctx.Err() != nil {
+				// Out of time; what is left is reported as skipped
+				break
+			}
+			err := store.InTx(func(tx repository.Store) error {
+				return s.createReward(tx, item)
+			})
+			s.recordBatchResult(&batch.Results[i], item, err)
+		}
+		markPending(batch.Results, BatchStatusSkipped)
+	}
+
+	store := s.store.WithContext(ctx)
+	if dryRun {
+		// One transaction around everything, so later items still see earlier ones
+		// (e.g. a repeated event_id) before it is all rolled back
+		err := store.InTx(func(tx repository.Store) error {
+			process(tx)
+			return errDryRun
+		})
+		if !errors.Is(err, errDryRun) {
+			return nil, err
+		}
+	} else {
+		process(store)
+	}
+	if batch.RolledBack && ctx.Err() != nil {
+		// Time ran out before the atomic batch could be written; nothing about it was wrong
+		return nil, ctx.Err()
+	}
+
+	for _, result := range batch.Results {
+		switch result.Status {
+		case BatchStatusCreated:
+			batch.Created++
+		case BatchStatusDuplicate:
+			batch.Duplicates++
+		case BatchStatusConflict:
+			batch.Conflicts++
+		case BatchStatusInvalid:
+			batch.Invalid++
+		case BatchStatusFailed:
+			batch.Failed++
+		}
+	}
+
+	s.logger.WithFields(logrus.Fields{
+		"mode":       mode,
+		"dry_run":    dryRun,
+		"items":      len(rewards),
+		"created":    batch.Created,
+		"duplicates": batch.Duplicates,
+		"conflicts":  batch.Conflicts,
+		"invalid":    batch.Invalid,
+		"failed":     batch.Failed,
+	}).Info("Reward batch processed")
+
+	return batch, nil
+}
+
+// createAtomicBatch creates every item in one transaction, stopping at the first failure.
+// Replayed items are already recorded with the same payload, so they do not fail the
+// batch; retrying a committed batch reports every item as a duplicate.
+func (s *RewardService) createAtomicBatch(store repository.Store, batch *models.RewardBatch, items []*pendingReward) {
+	failed := -1
+	err := store.InTx(func(tx repository.Store) error {
+		for i, item := range items {
+			err := s.createReward(tx, item)
+			var duplicate *DuplicateEventError
+			if errors.As(err, &duplicate) {
+				// Detected before anything is written, so the transaction carries on
+				s.recordBatchResult(&batch.Results[i], item, err)
+				continue
+			}
+			if err != nil {
+				failed = i
+				return err
+			}
+			batch.Results[i].Status = BatchStatusCreated
+		}
+		return nil
+	})
+	if err == nil {
+		for i, item := range items {
+			if batch.Results[i].Status == BatchStatusCreated {
+				batch.Results[i].RewardID = item.reward.ID
+			}
+		}
+		return
+	}
+
+	if failed >= 0 {
+		s.recordBatchResult(&batch.Results[failed], items[failed], err)
+	} else {
+		// The commit itself failed
+		s.logger.WithError(err).Error("Failed to commit reward batch")
+	}
+	for i := range batch.Results {
+		if batch.Results[i].Status == BatchStatusCreated {
+			batch.Results[i].Status = BatchStatusRolledBack
+		}
+	}
+	markPending(batch.Results, BatchStatusSkipped)
+	batch.RolledBack = true
+}
+
+// recordBatchResult classifies the outcome of creating one batch item
+func (s *RewardService) recordBatchResult(result *models.RewardBatchResult, item *pendingReward, err error) {
+	var duplicate *DuplicateEventError
+	var conflict *EventConflictError
+	switch {
+	case err == nil:
+		result.Status = BatchStatusCreated
+		result.RewardID = item.reward.ID
+	case errors.As(err, &duplicate):
+		result.Status = BatchStatusDuplicate
+		result.RewardID = duplicate.Reward.ID
+		result.Error = err.Error()
+	case errors.As(err, &conflict):
+		result.Status = BatchStatusConflict
+		result.RewardID = conflict.RewardID
+		result.Error = err.Error()
+	case errors.Is(err, ErrNoFeeSchedule), errors.Is(err, ErrUnknownSymbol), errors.Is(err, ErrRewardPredatesCorporateAction):
+		result.Status = BatchStatusInvalid
+		result.Error = err.Error()
+	default:
+		s.logger.WithError(err).WithField("event_id", item.reward.EventID).Error("Failed to create batch reward")
+		result.Status = BatchStatusFailed
+		result.Error = "failed to create reward"
+	}
+}
+
+// markPending gives every result without a status the given one
+func markPending(results []models.RewardBatchResult, status string) {
+	for i := range results {
+		if results[i].Status == "" {
+			results[i].Status = status
+		}
+	}
+}
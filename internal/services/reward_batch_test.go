@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
+	"testing"
+)
+
+func TestAtomicBatchReplay(t *testing.T) {
+	service := newTestRewardService(newTestStore(t))
+	ctx := context.Background()
+	rewards := []BatchReward{
+		{UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "batch-1"},
+		{UserID: "u2", StockSymbol: "INFY", Quantity: "2.5", EventID: "batch-2"},
+	}
+
+	first, err := service.CreateRewardBatch(ctx, rewards, BatchModeAtomic, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.RolledBack || first.Created != 2 {
+		t.Fatalf("first run: rolled back %v, created %d; want 2 created", first.RolledBack, first.Created)
+	}
+
+	replay, err := service.CreateRewardBatch(ctx, rewards, BatchModeAtomic, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replay.RolledBack {
+		t.Fatal("replaying a committed atomic batch rolled it back")
+	}
+	for i, result := range replay.Results {
+		if result.Status != BatchStatusDuplicate {
+			t.Errorf("item %d: status %q, want %q", i, result.Status, BatchStatusDuplicate)
+		}
+		if result.RewardID != first.Results[i].RewardID {
+			t.Errorf("item %d: reward %q, want the recorded %q", i, result.RewardID, first.Results[i].RewardID)
+		}
+	}
+}
+
+func TestAtomicBatchReplayWithNewItem(t *testing.T) {
+	service := newTestRewardService(newTestStore(t))
+	ctx := context.Background()
+	committed := BatchReward{UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "batch-1"}
+	if _, err := service.CreateRewardBatch(ctx, []BatchReward{committed}, BatchModeAtomic, false); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := service.CreateRewardBatch(ctx, []BatchReward{
+		committed,
+		{UserID: "u2", StockSymbol: "INFY", Quantity: "1", EventID: "batch-2"},
+	}, BatchModeAtomic, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if batch.RolledBack || batch.Duplicates != 1 || batch.Created != 1 {
+		t.Fatalf("rolled back %v, duplicates %d, created %d; want 1 duplicate and 1 created",
+			batch.RolledBack, batch.Duplicates, batch.Created)
+	}
+}
+
+func TestAtomicBatchConflictRollsBack(t *testing.T) {
+	service := newTestRewardService(newTestStore(t))
+	ctx := context.Background()
+	if _, err := service.CreateRewardBatch(ctx, []BatchReward{
+		{UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "batch-1"},
+	}, BatchModeAtomic, false); err != nil {
+		t.Fatal(err)
+	}
+
+	batch, err := service.CreateRewardBatch(ctx, []BatchReward{
+		{UserID: "u2", StockSymbol: "INFY", Quantity: "1", EventID: "batch-2"},
+		{UserID: "u1", StockSymbol: "TCS", Quantity: "5", EventID: "batch-1"},
+	}, BatchModeAtomic, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !batch.RolledBack {
+		t.Fatal("an event_id reused with a different payload did not roll the batch back")
+	}
+	if got := batch.Results[0].Status; got != BatchStatusRolledBack {
+		t.Errorf("item 0: status %q, want %q", got, BatchStatusRolledBack)
+	}
+	if got := batch.Results[1].Status; got != BatchStatusConflict {
+		t.Errorf("item 1: status %q, want %q", got, BatchStatusConflict)
+	}
+}
+
+// failingStore fails posting the journal of rewards to failUser, as a database error
+// would after the reward row was already inserted
+type failingStore struct {
+	repository.Store
+	failUser string
+}
+
+func (s *failingStore) WithContext(ctx context.Context) repository.Store {
+	return &failingStore{Store: s.Store.WithContext(ctx), failUser: s.failUser}
+}
+
+func (s *failingStore) InTx(fn func(tx repository.Store) error) error {
+	return s.Store.InTx(func(tx repository.Store) error {
+		return fn(&failingStore{Store: tx, failUser: s.failUser})
+	})
+}
+
+func (s *failingStore) Ledger() repository.LedgerRepository {
+	return &failingLedger{LedgerRepository: s.Store.Ledger(), failUser: s.failUser}
+}
+
+type failingLedger struct {
+	repository.LedgerRepository
+	failUser string
+}
+
+func (l *failingLedger) PostJournal(j models.Journal) (string, error) {
+	if strings.HasSuffix(j.Description, " to user "+l.failUser) {
+		return "", errors.New("pq: deadlock detected")
+	}
+	return l.LedgerRepository.PostJournal(j)
+}
+
+func TestDryRunBatchItemFailsInDatabase(t *testing.T) {
+	store := &failingStore{Store: newTestStore(t), failUser: "u-fail"}
+	service := newTestRewardService(store)
+
+	batch, err := service.CreateRewardBatch(context.Background(), []BatchReward{
+		{UserID: "u1", StockSymbol: "TCS", Quantity: "1", EventID: "batch-1"},
+		{UserID: "u-fail", StockSymbol: "TCS", Quantity: "1", EventID: "batch-2"},
+		// Only a conflict if the failed item's reward row were still visible
+		{UserID: "u3", StockSymbol: "INFY", Quantity: "1", EventID: "batch-2"},
+	}, BatchModeBestEffort, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{BatchStatusCreated, BatchStatusFailed, BatchStatusCreated}
+	for i, result := range batch.Results {
+		if result.Status != want[i] {
+			t.Errorf("item %d: status %q (%s), want %q", i, result.Status, result.Error, want[i])
+		}
+	}
+	if _, err := store.Rewards().GetByEventID("batch-1"); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("dry run left a reward behind: err = %v", err)
+	}
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"stocky/internal/decimal"
+	"stocky/internal/models"
+	"strings"
+	"time"
+)
+
+var ErrEventConflict = errors.New("event_id reused with a different payload")
+
+// DuplicateEventError answers a repeated event_id whose payload matches the recorded
+// reward, so a retry can be given the original result
+type DuplicateEventError struct {
+	Reward *models.RewardEvent
+}
+
+func (e *DuplicateEventError) Error() string {
+	return ErrDuplicateEvent.Error()
+}
+
+func (e *DuplicateEventError) Unwrap() error {
+	return ErrDuplicateEvent
+}
+
+// FieldConflict is a payload field on which a reused event_id disagrees with the recorded reward
+type FieldConflict struct {
+	Field     string `json:"field"`
+	Existing  string `json:"existing"`
+	Requested string `json:"requested"`
+}
+
+// EventConflictError refuses an event_id reused with a different payload and lists the differences
+type EventConflictError struct {
+	EventID   string
+	RewardID  string // The reward recorded under EventID
+	Conflicts []FieldConflict
+}
+
+func (e *EventConflictError) Error() string {
+	fields := make([]string, len(e.Conflicts))
+	for i, c := range e.Conflicts {
+		fields[i] = fmt.Sprintf("%s %q != %q", c.Field, c.Requested, c.Existing)
+	}
+	return fmt.Sprintf("%s: %s", ErrEventConflict, strings.Join(fields, ", "))
+}
+
+func (e *EventConflictError) Unwrap() error {
+	return ErrEventConflict
+}
+
+// ErrorDetails names the recorded reward and the fields that differ from it
+func (e *EventConflictError) ErrorDetails() interface{} {
+	return map[string]interface{}{
+		"event_id":  e.EventID,
+		"reward_id": e.RewardID,
+		"conflicts": e.Conflicts,
+	}
+}
+
+// rewardPayload is the canonical form of what an issuer asked for. Two requests with the
+// same event_id are a replay when their payloads agree, and conflicting reuse otherwise.
+type rewardPayload struct {
+	UserID          string `json:"user_id"`
+	StockSymbol     string `json:"stock_symbol"`
+	Quantity        string `json:"quantity"`         // At QuantityScale, so "10" and "10.0" agree
+	Exchange        string `json:"exchange"`         // Normalized, so "" and "NSE" agree
+	RewardTimestamp string `json:"reward_timestamp"` // UTC to the microsecond; empty when left to default
+}
+
+func newRewardPayload(reward *models.RewardEvent, qty decimal.Decimal, timestampGiven bool) rewardPayload {
+	payload := rewardPayload{
+		UserID:      reward.UserID,
+		StockSymbol: reward.StockSymbol,
+		Quantity:    qty.Round(decimal.QuantityScale, decimal.RoundHalfUp).String(),
+		Exchange:    reward.Exchange,
+	}
+	if timestampGiven {
+		payload.RewardTimestamp = canonicalTimestamp(reward.RewardTimestamp)
+	}
+	return payload
+}
+
+// RewardPayload is the canonical payload of a reward that is not recorded, so that two
+// uses of an event_id can be compared the way CreateReward compares a reuse with the record
+type RewardPayload struct {
+	payload rewardPayload
+}
+
+// RewardPayload validates r like CreateReward and returns its canonical payload
+func (s *RewardService) RewardPayload(r BatchReward) (RewardPayload, error) {
+	if r.Invalid != nil {
+		return RewardPayload{}, r.Invalid
+	}
+	pending, err := s.newReward(r.UserID, r.StockSymbol, r.Quantity, r.Exchange, r.EventID, r.RewardTimestamp)
+	if err != nil {
+		return RewardPayload{}, err
+	}
+	return RewardPayload{payload: pending.payload}, nil
+}
+
+// Conflicts lists the fields on which p disagrees with first, the payload its event_id was
+// first used with. No conflicts means CreateReward would report p as a duplicate.
+func (p RewardPayload) Conflicts(first RewardPayload) []FieldConflict {
+	return p.payload.conflicts(first.payload)
+}
+
+// recordedPayload is the payload of a stored reward
+func recordedPayload(reward *models.RewardEvent) (rewardPayload, error) {
+	qty, err := decimal.Parse(reward.Quantity)
+	if err != nil {
+		return rewardPayload{}, err
+	}
+	return newRewardPayload(reward, qty, true), nil
+}
+
+// hash is the SHA-256 of the payload's JSON encoding, whose field order is fixed
+func (p rewardPayload) hash() string {
+	data, _ := json.Marshal(p)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// conflicts lists the fields on which p disagrees with the recorded payload.
+// A request that left reward_timestamp to default matches any recorded timestamp.
+func (p rewardPayload) conflicts(recorded rewardPayload) []FieldConflict {
+	var conflicts []FieldConflict
+	compare := func(field, requested, existing string) {
+		if requested != existing {
+			conflicts = append(conflicts, FieldConflict{Field: field, Existing: existing, Requested: requested})
+		}
+	}
+	compare("user_id", p.UserID, recorded.UserID)
+	compare("stock_symbol", p.StockSymbol, recorded.StockSymbol)
+	compare("quantity", p.Quantity, recorded.Quantity)
+	compare("exchange", p.Exchange, recorded.Exchange)
+	if p.RewardTimestamp != "" {
+		compare("reward_timestamp", p.RewardTimestamp, recorded.RewardTimestamp)
+	}
+	return conflicts
+}
+
+// canonicalTimestamp formats t at the microsecond precision Postgres stores
+func canonicalTimestamp(t time.Time) string {
+	return t.UTC().Truncate(time.Microsecond).Format(time.RFC3339Nano)
+}
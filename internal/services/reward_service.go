@@ -1,10 +1,13 @@
 package services
 
 import (
-	"database/sql"
+	"context"
 	"errors"
 	"fmt"
+	"stocky/internal/decimal"
 	"stocky/internal/models"
+	"stocky/internal/repository"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
@@ -13,208 +16,320 @@ import (
 
 var (
 	ErrDuplicateEvent = errors.New("duplicate reward event")
+	ErrUnknownSymbol  = errors.New("unknown stock symbol")
+	// A corporate action applied after the reward's date already converted the holdings
+	// it covers, so the reward would be left unconverted
+	ErrRewardPredatesCorporateAction = errors.New("reward_timestamp is before an applied corporate action on the symbol")
 )
 
 type RewardService struct {
-	db     *sql.DB
-	logger *logrus.Logger
+	store         repository.Store
+	logger        *logrus.Logger
+	maxBackdate   time.Duration  // Oldest reward_timestamp accepted; 0 accepts any
+	maxFutureSkew time.Duration  // How far reward_timestamp may be ahead of this service's clock
+	location      *time.Location // Business timezone that decides which day a reward falls on
 }
 
-func NewRewardService(db *sql.DB, logger *logrus.Logger) *RewardService {
+func NewRewardService(store repository.Store, maxBackdate, maxFutureSkew time.Duration, location *time.Location, logger *logrus.Logger) *RewardService {
 	return &RewardService{
-		db:     db,
-		logger: logger,
+		store:         store,
+		logger:        logger,
+		maxBackdate:   maxBackdate,
+		maxFutureSkew: maxFutureSkew,
+		location:      location,
 	}
 }
 
-// CreateReward creates a reward event and corresponding ledger entries
-func (s *RewardService) CreateReward(userID, stockSymbol, quantity, eventID string, rewardTimestamp time.Time) (*models.RewardEvent, error) {
-	tx, err := s.db.Begin()
+// CreateReward creates a reward event and corresponding ledger entries.
+// Fees are charged under the exchange's fee schedule in effect at rewardTimestamp,
+// which defaults to now when zero.
+// A backdated reward marks the user's snapshots from its date onwards for recomputation.
+// Invalid fields are reported together in a *ValidationError.
+// A repeated event_id returns a *DuplicateEventError with the recorded reward when the
+// payload matches, and an *EventConflictError when it does not.
+func (s *RewardService) CreateReward(ctx context.Context, userID, stockSymbol, quantity, exchange, eventID string, rewardTimestamp time.Time) (*models.RewardEvent, error) {
+	pending, err := s.newReward(userID, stockSymbol, quantity, exchange, eventID, rewardTimestamp)
 	if err != nil {
 		return nil, err
 	}
-	defer tx.Rollback()
+
+	err = s.store.WithContext(ctx).InTx(func(tx repository.Store) error {
+		return s.createReward(tx, pending)
+	})
+	if err != nil {
+		return nil, err
+	}
+	reward := pending.reward
+
+	s.logger.WithFields(logrus.Fields{
+		"reward_id":    reward.ID,
+		"user_id":      userID,
+		"stock_symbol": stockSymbol,
+		"quantity":     quantity,
+	}).Info("Reward created successfully")
+
+	return reward, nil
+}
+
+// pendingReward is a validated reward ready to insert
+type pendingReward struct {
+	reward  *models.RewardEvent
+	qty     decimal.Decimal
+	payload rewardPayload
+}
+
+// newReward validates a reward and builds the event to insert
+func (s *RewardService) newReward(userID, stockSymbol, quantity, exchange, eventID string, rewardTimestamp time.Time) (*pendingReward, error) {
+	var v ValidationError
+	qty := CheckRewardFields(&v, userID, stockSymbol, quantity, exchange, eventID)
+	timestampGiven := !rewardTimestamp.IsZero()
+	if !timestampGiven {
+		rewardTimestamp = time.Now()
+	}
+	s.checkRewardTimestamp(&v, rewardTimestamp)
+	if err := v.Err(); err != nil {
+		return nil, err
+	}
+
+	reward := &models.RewardEvent{
+		ID:              uuid.New().String(),
+		UserID:          userID,
+		StockSymbol:     stockSymbol,
+		Quantity:        quantity,
+		RewardTimestamp: rewardTimestamp,
+		EventID:         eventID,
+		Exchange:        normalizeExchange(exchange),
+	}
+	payload := newRewardPayload(reward, qty, timestampGiven)
+	reward.PayloadHash = payload.hash()
+	return &pendingReward{reward: reward, qty: qty, payload: payload}, nil
+}
+
+// createReward inserts a reward and posts its journal using tx
+func (s *RewardService) createReward(tx repository.Store, pending *pendingReward) error {
+	reward, qty := pending.reward, pending.qty
+	userID, stockSymbol, quantity, exchange := reward.UserID, reward.StockSymbol, reward.Quantity, reward.Exchange
 
 	// Check for duplicate event_id
-	var existingID string
-	err = tx.QueryRow("SELECT id FROM reward_events WHERE event_id = $1", eventID).Scan(&existingID)
+	existing, err := tx.Rewards().GetByEventID(reward.EventID)
 	if err == nil {
-		// Duplicate found
-		s.logger.WithFields(logrus.Fields{
-			"event_id": eventID,
-			"existing_id": existingID,
-		}).Warn("Duplicate reward event detected")
-		return nil, ErrDuplicateEvent
-	} else if err != sql.ErrNoRows {
-		return nil, err
+		return s.duplicateEvent(pending, existing)
+	} else if !errors.Is(err, repository.ErrNotFound) {
+		return err
 	}
 
-	// Insert reward event
-	rewardID := uuid.New().String()
-	_, err = tx.Exec(`
-		INSERT INTO reward_events (id, user_id, stock_symbol, quantity, reward_timestamp, event_id)
-		VALUES ($1, $2, $3, $4, $5, $6)
-	`, rewardID, userID, stockSymbol, quantity, rewardTimestamp, eventID)
+	restated, err := tx.Rewards().RestatedAfter(stockSymbol, reward.RewardTimestamp.In(s.location))
 	if err != nil {
-		return nil, err
+		return err
+	}
+	if restated {
+		return fmt.Errorf("%w: %s", ErrRewardPredatesCorporateAction, stockSymbol)
 	}
 
-	// Get current stock price for calculations
-	var currentPrice string
-	err = tx.QueryRow(`
-		SELECT price FROM stock_prices 
-		WHERE stock_symbol = $1 
-		ORDER BY price_timestamp DESC 
-		LIMIT 1
-	`, stockSymbol).Scan(&currentPrice)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
+	cost, err := s.costReward(tx, stockSymbol, qty, exchange, reward.RewardTimestamp)
+	if err != nil {
+		return err
 	}
 
-	// If no price found, use a default price (in production, this would fetch from API)
-	if err == sql.ErrNoRows {
-		currentPrice = "100.0000" // Default price
-		s.logger.WithField("stock_symbol", stockSymbol).Warn("No price found, using default")
+	// Insert reward event
+	reward.FeeScheduleID = cost.schedule.ID
+	if err := tx.Rewards().Create(reward); err != nil {
+		return err
+	}
+
+	tradeValue := cost.tradeValue
+
+	// Post the reward as a balanced journal:
+	//   - the shares bought go into stock inventory against company cash
+	//   - fees are expensed against what is owed to the broker and tax authorities
+	//   - the shares are granted to the user as a reward expense and a stock liability
+	inventoryAccount := SymbolAccount(AccountStockInventory, stockSymbol)
+	liabilityAccount := SymbolAccount(AccountUserStockLiability, stockSymbol)
+	_, err = PostJournal(tx.Ledger(), models.Journal{
+		JournalType:   JournalTypeReward,
+		RewardEventID: reward.ID,
+		Description:   fmt.Sprintf("Reward of %s %s to user %s", quantity, stockSymbol, userID),
+		Lines: []models.JournalLine{
+			rewardLine("STOCK_PURCHASE", inventoryAccount, SideDebit, stockSymbol, quantity, tradeValue, "Stock bought for reward"),
+			rewardLine("CASH_DEBIT", AccountCompanyCash, SideCredit, "", "", tradeValue, "Cash outflow for stock purchase"),
+			rewardLine("FEE_EXPENSE", AccountFeeExpense, SideDebit, "", "", cost.fees.total(), "Transaction fees"),
+			rewardLine("BROKERAGE_FEE", AccountBrokeragePayable, SideCredit, "", "", cost.fees.brokerage, "Brokerage fee"),
+			rewardLine("STT_FEE", AccountSTTPayable, SideCredit, "", "", cost.fees.stt, "Securities Transaction Tax"),
+			rewardLine("GST_FEE", AccountGSTPayable, SideCredit, "", "", cost.fees.gst, "GST on brokerage"),
+			rewardLine("OTHER_FEE", AccountOtherFeesPayable, SideCredit, "", "", cost.fees.otherFees, "Other regulatory fees"),
+			rewardLine("REWARD_EXPENSE", AccountRewardExpense, SideDebit, "", "", tradeValue, "Stock reward expense"),
+			rewardLine("STOCK_CREDIT", liabilityAccount, SideCredit, stockSymbol, quantity, tradeValue, "Stock reward credit"),
+		},
+	})
+	if err != nil {
+		return err
 	}
 
-	// Calculate fees (hypothetical values)
-	// In production, these would be calculated based on actual NSE/BSE rates
-	brokerage := calculateBrokerage(quantity, currentPrice)
-	stt := calculateSTT(quantity, currentPrice)
-	gst := calculateGST(brokerage)
-	otherFees := calculateOtherFees(quantity, currentPrice)
-	totalFees := addAmounts(brokerage, stt, gst, otherFees)
-
-	// Calculate total cash outflow
-	totalCashOutflow := addAmounts(multiplyAmounts(quantity, currentPrice), totalFees)
-
-	// Create ledger entries
-	ledgerEntries := []struct {
-		entryType   string
-		accountType string
-		stockSymbol sql.NullString
-		quantity    sql.NullString
-		amount      string
-		description string
-	}{
-		{"STOCK_CREDIT", "STOCK", sql.NullString{String: stockSymbol, Valid: true}, sql.NullString{String: quantity, Valid: true}, "0.0000", "Stock reward credit"},
-		{"CASH_DEBIT", "CASH", sql.NullString{Valid: false}, sql.NullString{Valid: false}, totalCashOutflow, "Cash outflow for stock purchase"},
-		{"BROKERAGE_FEE", "FEES", sql.NullString{Valid: false}, sql.NullString{Valid: false}, brokerage, "Brokerage fee"},
-		{"STT_FEE", "FEES", sql.NullString{Valid: false}, sql.NullString{Valid: false}, stt, "Securities Transaction Tax"},
-		{"GST_FEE", "FEES", sql.NullString{Valid: false}, sql.NullString{Valid: false}, gst, "GST on brokerage"},
-		{"OTHER_FEE", "FEES", sql.NullString{Valid: false}, sql.NullString{Valid: false}, otherFees, "Other regulatory fees"},
-	}
-
-	for _, entry := range ledgerEntries {
-		_, err = tx.Exec(`
-			INSERT INTO ledger_entries (id, reward_event_id, entry_type, account_type, stock_symbol, quantity, amount, description)
-			VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, $6, $7)
-		`, rewardID, entry.entryType, entry.accountType, entry.stockSymbol, entry.quantity, entry.amount, entry.description)
+	return invalidateSnapshots(tx, s.location, userID, reward.RewardTimestamp)
+}
+
+// duplicateEvent tells a replay of the recorded reward from conflicting reuse of its event_id.
+// Matching hashes are a replay; otherwise the fields are compared, which also covers rewards
+// recorded before hashes were stored and requests that left reward_timestamp to default.
+func (s *RewardService) duplicateEvent(pending *pendingReward, existing *models.RewardEvent) error {
+	fields := logrus.Fields{
+		"event_id":    existing.EventID,
+		"existing_id": existing.ID,
+	}
+	if existing.PayloadHash != pending.reward.PayloadHash {
+		recorded, err := recordedPayload(existing)
 		if err != nil {
-			return nil, err
+			return err
+		}
+		if conflicts := pending.payload.conflicts(recorded); len(conflicts) > 0 {
+			conflictErr := &EventConflictError{EventID: existing.EventID, RewardID: existing.ID, Conflicts: conflicts}
+			s.logger.WithFields(fields).WithError(conflictErr).Warn("Reward event_id reused with a different payload")
+			return conflictErr
 		}
 	}
 
-	if err = tx.Commit(); err != nil {
+	s.logger.WithFields(fields).Info("Duplicate reward event replayed")
+	return &DuplicateEventError{Reward: existing}
+}
+
+// PreviewReward returns the fee breakdown a reward would be charged if issued at the given time,
+// without recording anything. quantity is validated as for CreateReward.
+func (s *RewardService) PreviewReward(ctx context.Context, stockSymbol, quantity, exchange string, at time.Time) (*models.FeeBreakdown, error) {
+	var v ValidationError
+	qty := checkQuantity(&v, quantity)
+	if err := v.Err(); err != nil {
 		return nil, err
 	}
+	exchange = normalizeExchange(exchange)
 
-	s.logger.WithFields(logrus.Fields{
-		"reward_id": rewardID,
-		"user_id": userID,
-		"stock_symbol": stockSymbol,
-		"quantity": quantity,
-	}).Info("Reward created successfully")
+	cost, err := s.costReward(s.store.WithContext(ctx), stockSymbol, qty, exchange, at)
+	if err != nil {
+		return nil, err
+	}
 
-	return &models.RewardEvent{
-		ID:             rewardID,
-		UserID:         userID,
-		StockSymbol:    stockSymbol,
-		Quantity:       quantity,
-		RewardTimestamp: rewardTimestamp,
-		EventID:        eventID,
+	totalFees := cost.fees.total()
+	return &models.FeeBreakdown{
+		StockSymbol:   stockSymbol,
+		Quantity:      quantity,
+		Exchange:      exchange,
+		FeeScheduleID: cost.schedule.ID,
+		EffectiveFrom: cost.schedule.EffectiveFrom,
+		Price:         cost.price.String(),
+		TradeValue:    cost.tradeValue.String(),
+		Brokerage:     cost.fees.brokerage.String(),
+		STT:           cost.fees.stt.String(),
+		GST:           cost.fees.gst.String(),
+		OtherFees:     cost.fees.otherFees.String(),
+		TotalFees:     totalFees.String(),
+		TotalCost:     cost.tradeValue.Add(totalFees).String(),
 	}, nil
 }
 
-// GetTodayStocks returns all stock rewards for a user today
-func (s *RewardService) GetTodayStocks(userID string) ([]models.TodayStock, error) {
-	rows, err := s.db.Query(`
-		SELECT stock_symbol, quantity, reward_timestamp
-		FROM reward_events
-		WHERE user_id = $1 
-		AND DATE(reward_timestamp) = CURRENT_DATE
-		ORDER BY reward_timestamp DESC
-	`, userID)
+// rewardCost is what the company pays to buy the shares for a reward
+type rewardCost struct {
+	schedule   *models.FeeSchedule
+	price      decimal.Decimal
+	tradeValue decimal.Decimal
+	fees       fees
+}
+
+// costReward prices a reward at the latest stored price and applies the fee schedule in effect at the given time.
+// Only symbols in the instrument master can be rewarded.
+func (s *RewardService) costReward(store repository.Store, stockSymbol string, qty decimal.Decimal, exchange string, at time.Time) (*rewardCost, error) {
+	if _, err := store.Prices().Instrument(stockSymbol); errors.Is(err, repository.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownSymbol, stockSymbol)
+	} else if err != nil {
+		return nil, err
+	}
+
+	schedule, err := feeScheduleAt(store.FeeSchedules(), exchange, at.In(s.location))
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
 
-	var stocks []models.TodayStock
-	for rows.Next() {
-		var stock models.TodayStock
-		var timestamp time.Time
-		if err := rows.Scan(&stock.StockSymbol, &stock.Quantity, &timestamp); err != nil {
-			return nil, err
-		}
-		stock.RewardedAt = timestamp.Format(time.RFC3339)
-		stocks = append(stocks, stock)
+	// Get current stock price for calculations
+	var currentPrice string
+	latest, err := store.Prices().Latest(stockSymbol)
+	if err == nil {
+		currentPrice = latest.Price
+	} else if errors.Is(err, repository.ErrNotFound) {
+		// If no price found, use a default price (in production, this would fetch from API)
+		currentPrice = "100.0000" // Default price
+		s.logger.WithField("stock_symbol", stockSymbol).Warn("No price found, using default")
+	} else if err != nil {
+		return nil, err
 	}
 
-	return stocks, rows.Err()
-}
+	price, err := decimal.Parse(currentPrice)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stored price for %s: %w", stockSymbol, err)
+	}
 
-// Helper functions for fee calculations
-func calculateBrokerage(quantity, price string) string {
-	// Hypothetical: 0.05% of transaction value
-	value := multiplyAmounts(quantity, price)
-	return divideAmount(value, "10000") // 0.05% = divide by 10000
-}
+	tradeValue := roundAmount(qty.Mul(price))
+	fees, err := calculateFees(schedule, tradeValue)
+	if err != nil {
+		return nil, err
+	}
 
-func calculateSTT(quantity, price string) string {
-	// Hypothetical: 0.1% of transaction value
-	value := multiplyAmounts(quantity, price)
-	return divideAmount(value, "1000") // 0.1% = divide by 1000
+	return &rewardCost{
+		schedule:   schedule,
+		price:      price,
+		tradeValue: tradeValue,
+		fees:       fees,
+	}, nil
 }
 
-func calculateGST(brokerage string) string {
-	// Hypothetical: 18% GST on brokerage
-	// GST = brokerage * 0.18
-	return multiplyAmounts(brokerage, "0.18")
+// rewardLine builds one leg of a reward journal; only stock legs carry a symbol and quantity
+func rewardLine(entryType, accountCode, side, stockSymbol, quantity string, amount decimal.Decimal, description string) models.JournalLine {
+	return models.JournalLine{
+		EntryType:   entryType,
+		AccountCode: accountCode,
+		Side:        side,
+		StockSymbol: stockSymbol,
+		Quantity:    quantity,
+		Amount:      amount,
+		Description: description,
+	}
 }
 
-func calculateOtherFees(quantity, price string) string {
-	// Hypothetical: Fixed 10 INR per transaction
-	return "10.0000"
+// normalizeExchange upper-cases an exchange code, defaulting to NSE
+func normalizeExchange(exchange string) string {
+	exchange = strings.ToUpper(strings.TrimSpace(exchange))
+	if exchange == "" {
+		return DefaultExchange
+	}
+	return exchange
 }
 
-// Amount arithmetic helpers (using string to maintain precision)
-func addAmounts(amounts ...string) string {
-	// Simple addition - in production, use proper decimal library
-	// For now, we'll use a simple approach
-	var total float64
-	for _, amt := range amounts {
-		var val float64
-		_, _ = fmt.Sscanf(amt, "%f", &val)
-		total += val
-	}
-	return fmt.Sprintf("%.4f", total)
+// GetTodayStocks returns all stock rewards for a user today in loc, net of reversals.
+// A nil loc means the business timezone.
+func (s *RewardService) GetTodayStocks(ctx context.Context, userID string, loc *time.Location) ([]models.TodayStock, error) {
+	loc = orLocation(loc, s.location)
+	start, end, err := dayBounds(todayIn(loc), loc)
+	if err != nil {
+		return nil, err
+	}
+	return s.store.WithContext(ctx).Rewards().RewardsBetween(userID, start, end)
 }
 
-func multiplyAmounts(a, b string) string {
-	var valA, valB float64
-	_, _ = fmt.Sscanf(a, "%f", &valA)
-	_, _ = fmt.Sscanf(b, "%f", &valB)
-	return fmt.Sprintf("%.4f", valA*valB)
+// amountRounding is the rounding mode applied whenever a value is reduced to
+// INR precision. Banker's rounding avoids systematic drift when many postings are summed.
+const amountRounding = decimal.RoundHalfEven
+
+// roundAmount rounds a value to the NUMERIC(18, 4) scale used for INR amounts
+func roundAmount(d decimal.Decimal) decimal.Decimal {
+	return d.Round(decimal.AmountScale, amountRounding)
 }
 
-func divideAmount(a, b string) string {
-	var valA, valB float64
-	_, _ = fmt.Sscanf(a, "%f", &valA)
-	_, _ = fmt.Sscanf(b, "%f", &valB)
-	if valB == 0 {
-		return "0.0000"
+// valueOf returns quantity * price rounded to INR precision
+func valueOf(quantity, price string) (decimal.Decimal, error) {
+	qty, err := decimal.Parse(quantity)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid quantity %q: %w", quantity, err)
+	}
+	p, err := decimal.Parse(price)
+	if err != nil {
+		return decimal.Decimal{}, fmt.Errorf("invalid price %q: %w", price, err)
 	}
-	return fmt.Sprintf("%.4f", valA/valB)
+	return roundAmount(qty.Mul(p)), nil
 }
-
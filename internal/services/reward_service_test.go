@@ -0,0 +1,171 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"stocky/internal/decimal"
+	"testing"
+	"time"
+)
+
+func TestRewardBeforeAppliedCorporateAction(t *testing.T) {
+	store := newTestStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+	now := time.Now().In(testLocation)
+	store.AddAppliedCorporateAction("TCS", now.AddDate(0, 0, -3))
+
+	_, err := service.CreateReward(ctx, "u1", "TCS", "10", "NSE", "before-action", now.AddDate(0, 0, -5))
+	if !errors.Is(err, ErrRewardPredatesCorporateAction) {
+		t.Fatalf("reward dated before the action: err = %v, want %v", err, ErrRewardPredatesCorporateAction)
+	}
+	if code := AsError(err).Code; code != CodeConflict {
+		t.Errorf("code = %s, want %s", code, CodeConflict)
+	}
+
+	if _, err := service.CreateReward(ctx, "u1", "TCS", "10", "NSE", "after-action", now.AddDate(0, 0, -1)); err != nil {
+		t.Fatalf("reward dated after the action: %v", err)
+	}
+	if _, err := service.CreateReward(ctx, "u1", "INFY", "10", "NSE", "other-symbol", now.AddDate(0, 0, -5)); err != nil {
+		t.Fatalf("reward on a symbol without actions: %v", err)
+	}
+}
+
+func TestRewardThenCorporateAction(t *testing.T) {
+	store := newTestStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+	now := time.Now().In(testLocation)
+
+	// Booked before the action, so applying it converts the reward with the other holdings
+	reward, err := service.CreateReward(ctx, "u1", "TCS", "10", "NSE", "booked-first", now.AddDate(0, 0, -5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.AddAppliedCorporateAction("TCS", now.AddDate(0, 0, -3))
+
+	// The same reward can no longer be booked, or be reversed at its original quantity
+	_, err = service.CreateReward(ctx, "u2", "TCS", "10", "NSE", "booked-late", now.AddDate(0, 0, -5))
+	if !errors.Is(err, ErrRewardPredatesCorporateAction) {
+		t.Errorf("late booking: err = %v, want %v", err, ErrRewardPredatesCorporateAction)
+	}
+	if _, err := service.ReverseReward(ctx, reward.ID, "test"); !errors.Is(err, ErrRewardRestated) {
+		t.Errorf("reversal: err = %v, want %v", err, ErrRewardRestated)
+	}
+}
+
+func TestCreateReward(t *testing.T) {
+	store := newTestStore(t)
+	service := newTestRewardService(store)
+
+	reward, err := service.CreateReward(context.Background(), "u1", "TCS", "10", "", "evt-1", time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reward.StockSymbol != "TCS" || reward.Exchange != "NSE" || reward.FeeScheduleID == "" {
+		t.Errorf("reward = %+v, want TCS on NSE under a fee schedule", reward)
+	}
+
+	entries, err := store.Ledger().RewardEntries(reward.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	debits, credits := decimal.Zero(decimal.AmountScale), decimal.Zero(decimal.AmountScale)
+	for _, e := range entries {
+		amount, err := decimal.Parse(e.Amount)
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch e.Side {
+		case SideDebit:
+			debits = debits.Add(amount)
+		case SideCredit:
+			credits = credits.Add(amount)
+		}
+		if e.EntryType == "STOCK_CREDIT" && e.Amount != "35000.0000" {
+			t.Errorf("STOCK_CREDIT amount = %s, want 35000.0000", e.Amount)
+		}
+	}
+	if len(entries) != 9 {
+		t.Errorf("got %d ledger entries, want 9", len(entries))
+	}
+	if debits.Cmp(credits) != 0 {
+		t.Errorf("journal does not balance: debits %s, credits %s", debits, credits)
+	}
+}
+
+func TestCreateRewardDuplicate(t *testing.T) {
+	store := newTestStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+	at := time.Now().Add(-time.Minute)
+
+	reward, err := service.CreateReward(ctx, "u1", "TCS", "10", "NSE", "evt-1", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.CreateReward(ctx, "u1", "TCS", "10.000000", "NSE", "evt-1", at)
+	var duplicate *DuplicateEventError
+	if !errors.As(err, &duplicate) {
+		t.Fatalf("replay: err = %v, want *DuplicateEventError", err)
+	}
+	if duplicate.Reward.ID != reward.ID {
+		t.Errorf("replay answered reward %s, want %s", duplicate.Reward.ID, reward.ID)
+	}
+
+	userIDs, err := store.Rewards().UserIDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	holdings, err := store.Rewards().Holdings("u1", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(userIDs) != 1 || len(holdings) != 1 || holdings[0].Quantity != "10" {
+		t.Errorf("holdings after replay = %+v, want a single reward of 10", holdings)
+	}
+}
+
+func TestCreateRewardConflict(t *testing.T) {
+	store := newTestStore(t)
+	service := newTestRewardService(store)
+	ctx := context.Background()
+	at := time.Now().Add(-time.Minute)
+
+	reward, err := service.CreateReward(ctx, "u1", "TCS", "10", "NSE", "evt-1", at)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = service.CreateReward(ctx, "u1", "TCS", "12", "NSE", "evt-1", at)
+	var conflict *EventConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("reuse: err = %v, want *EventConflictError", err)
+	}
+	if conflict.RewardID != reward.ID || len(conflict.Conflicts) != 1 || conflict.Conflicts[0].Field != "quantity" {
+		t.Errorf("conflict = %+v, want quantity differing from reward %s", conflict, reward.ID)
+	}
+	if code := AsError(err).Code; code != CodeDuplicateEvent {
+		t.Errorf("code = %s, want %s", code, CodeDuplicateEvent)
+	}
+}
+
+func TestPreviewRewardValidatesQuantity(t *testing.T) {
+	service := newTestRewardService(newTestStore(t))
+	ctx := context.Background()
+
+	for _, quantity := range []string{"", "ten", "0", "-1", "0.0000001", "1000000000000"} {
+		_, err := service.PreviewReward(ctx, "TCS", quantity, "NSE", time.Now())
+		var validation *ValidationError
+		if !errors.As(err, &validation) || len(validation.Fields) != 1 || validation.Fields[0].Field != "quantity" {
+			t.Errorf("quantity %q: err = %v, want a quantity ValidationError", quantity, err)
+		}
+	}
+
+	preview, err := service.PreviewReward(ctx, "TCS", "10", "", time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if preview.Exchange != "NSE" || preview.TradeValue != "35000.0000" {
+		t.Errorf("preview = %+v, want 10 TCS on NSE worth 35000.0000", preview)
+	}
+}
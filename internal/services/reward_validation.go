@@ -0,0 +1,131 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"stocky/internal/decimal"
+	"strings"
+	"time"
+)
+
+var ErrValidation = errors.New("validation failed")
+
+// FieldError is one invalid field of a request
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError refuses a request and lists every invalid field, not just the first
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	fields := make([]string, len(e.Fields))
+	for i, f := range e.Fields {
+		fields[i] = f.Field + " " + f.Message
+	}
+	return fmt.Sprintf("%s: %s", ErrValidation, strings.Join(fields, "; "))
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrValidation
+}
+
+// ErrorDetails lists the invalid fields for API clients
+func (e *ValidationError) ErrorDetails() interface{} {
+	return map[string]interface{}{"fields": e.Fields}
+}
+
+// Add records an invalid field
+func (e *ValidationError) Add(field, message string) {
+	e.Fields = append(e.Fields, FieldError{Field: field, Message: message})
+}
+
+// Err returns e when any field is invalid, and nil otherwise
+func (e *ValidationError) Err() error {
+	if len(e.Fields) == 0 {
+		return nil
+	}
+	return e
+}
+
+var (
+	// User IDs come from issuers' own systems: up to 255 letters, digits and . _ : @ -,
+	// starting with a letter or digit
+	userIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._:@-]{0,254}$`)
+	// NSE/BSE trading symbols, e.g. RELIANCE, M&M, BAJAJ-AUTO
+	stockSymbolPattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9&._-]{0,49}$`)
+	exchangePattern    = regexp.MustCompile(`^[A-Z]{2,20}$`)
+
+	// maxQuantity is the first value too large for NUMERIC(18, 6)
+	maxQuantity = decimal.MustParse("1000000000000")
+)
+
+const maxEventIDLength = 255
+
+// CheckRewardFields validates the fields of a reward that do not depend on configuration,
+// adding a FieldError for each problem. exchange is checked after normalizeExchange.
+func CheckRewardFields(v *ValidationError, userID, stockSymbol, quantity, exchange, eventID string) decimal.Decimal {
+	switch {
+	case userID == "":
+		v.Add("user_id", "is required")
+	case !userIDPattern.MatchString(userID):
+		v.Add("user_id", "must be at most 255 letters, digits or . _ : @ -, starting with a letter or digit")
+	}
+
+	switch {
+	case stockSymbol == "":
+		v.Add("stock_symbol", "is required")
+	case !stockSymbolPattern.MatchString(stockSymbol):
+		v.Add("stock_symbol", "must be at most 50 upper-case letters, digits or & . _ -")
+	}
+
+	qty := checkQuantity(v, quantity)
+
+	if !exchangePattern.MatchString(normalizeExchange(exchange)) {
+		v.Add("exchange", "must be an exchange code such as NSE or BSE")
+	}
+
+	switch {
+	case eventID == "":
+		v.Add("event_id", "is required")
+	case len(eventID) > maxEventIDLength:
+		v.Add("event_id", fmt.Sprintf("must be at most %d characters", maxEventIDLength))
+	}
+
+	return qty
+}
+
+// checkQuantity validates a reward quantity, adding a FieldError if it is not a positive
+// number that fits NUMERIC(18, 6), and returns the parsed value
+func checkQuantity(v *ValidationError, quantity string) decimal.Decimal {
+	qty, err := decimal.Parse(quantity)
+	switch {
+	case quantity == "":
+		v.Add("quantity", "is required")
+	case err != nil:
+		v.Add("quantity", "must be a decimal number")
+	case qty.Sign() <= 0:
+		v.Add("quantity", "must be positive")
+	case !qty.Round(decimal.QuantityScale, decimal.RoundDown).Equal(qty):
+		v.Add("quantity", fmt.Sprintf("must have at most %d decimal places", decimal.QuantityScale))
+	case qty.Cmp(maxQuantity) >= 0:
+		v.Add("quantity", fmt.Sprintf("must be less than %s", maxQuantity))
+	}
+	return qty
+}
+
+// checkRewardTimestamp refuses rewards dated too far in the future, which clock skew
+// between issuers and this service cannot explain, or before the backdating window
+func (s *RewardService) checkRewardTimestamp(v *ValidationError, rewardTimestamp time.Time) {
+	now := time.Now()
+	if rewardTimestamp.After(now.Add(s.maxFutureSkew)) {
+		v.Add("reward_timestamp", fmt.Sprintf("must not be more than %s in the future", s.maxFutureSkew))
+	}
+	if s.maxBackdate > 0 && now.Sub(rewardTimestamp) > s.maxBackdate {
+		v.Add("reward_timestamp", fmt.Sprintf("is beyond the backdating window of %s", s.maxBackdate))
+	}
+}
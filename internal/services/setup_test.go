@@ -0,0 +1,46 @@
+package services
+
+import (
+	"io"
+	"stocky/internal/models"
+	"stocky/internal/repository"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// testLocation is the business timezone the service tests run in
+var testLocation = mustLoadLocation("Asia/Kolkata")
+
+func mustLoadLocation(name string) *time.Location {
+	loc, err := LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+func discardLogger() *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(io.Discard)
+	return logger
+}
+
+// newTestStore returns an in-memory store with TCS and INFY in the instrument master,
+// priced an hour ago
+func newTestStore(t *testing.T) *repository.MemoryStore {
+	t.Helper()
+	store := repository.NewMemoryStore()
+	for symbol, price := range map[string]string{"TCS": "3500.0000", "INFY": "1500.0000"} {
+		store.SetInstrument(models.Instrument{StockSymbol: symbol, Status: InstrumentActive, Exchange: "NSE"})
+		if err := store.Prices().Save(symbol, price, time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return store
+}
+
+func newTestRewardService(store repository.Store) *RewardService {
+	return NewRewardService(store, 30*24*time.Hour, 5*time.Minute, testLocation, discardLogger())
+}
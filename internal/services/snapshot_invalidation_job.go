@@ -0,0 +1,31 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StartSnapshotInvalidationJob starts a background job that recomputes snapshots
+// invalidated by backdated rewards and adjustments every interval
+func StartSnapshotInvalidationJob(ctx context.Context, portfolioService *PortfolioService, interval time.Duration, logger *logrus.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			logger.Info("Snapshot invalidation job stopped")
+			return
+		case <-ticker.C:
+			recomputed, err := portfolioService.RecomputeInvalidatedSnapshots(ctx)
+			if err != nil {
+				logger.WithError(err).Error("Failed to recompute invalidated snapshots")
+			}
+			if recomputed > 0 {
+				logger.WithField("users", recomputed).Info("Invalidated snapshots recomputed")
+			}
+		}
+	}
+}
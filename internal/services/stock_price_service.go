@@ -1,121 +1,197 @@
 package services
 
 import (
-	"database/sql"
+	"context"
+	"errors"
 	"fmt"
-	"math/rand"
+	"stocky/internal/decimal"
+	"stocky/internal/repository"
 	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+var ErrInvalidPrice = errors.New("invalid price")
+
 type StockPriceService struct {
-	logger *logrus.Logger
-	// Cache for prices to avoid frequent DB queries
-	priceCache map[string]string
+	store    repository.Store
+	provider PriceProvider
+	logger   *logrus.Logger
+	// Provider prices, shared by request handlers and the price update job
+	cache *PriceCache
+	// Prices older than this are flagged stale; zero disables the check
+	staleAfter time.Duration
 }
 
-func NewStockPriceService(logger *logrus.Logger) *StockPriceService {
+func NewStockPriceService(store repository.Store, provider PriceProvider, cache *PriceCache, staleAfter time.Duration, logger *logrus.Logger) *StockPriceService {
 	return &StockPriceService{
+		store:      store,
+		provider:   provider,
 		logger:     logger,
-		priceCache: make(map[string]string),
+		cache:      cache,
+		staleAfter: staleAfter,
 	}
 }
 
-// GetCurrentPrice returns the current price for a stock symbol
-// This is a hypothetical service that returns random prices
-func (s *StockPriceService) GetCurrentPrice(stockSymbol string) (string, error) {
-	// Check cache first
-	if price, ok := s.priceCache[stockSymbol]; ok {
+// GetCurrentPrice returns the current price for a stock symbol from the configured provider,
+// served from the cache while it is fresh
+func (s *StockPriceService) GetCurrentPrice(ctx context.Context, stockSymbol string) (CachedPrice, error) {
+	cached, err := s.cache.Get(ctx, stockSymbol, func(ctx context.Context) (string, error) {
+		price, err := s.provider.GetPrice(ctx, stockSymbol)
+		if err != nil {
+			return "", err
+		}
+
+		s.logger.WithFields(logrus.Fields{
+			"stock_symbol": stockSymbol,
+			"price":        price,
+			"provider":     s.provider.Name(),
+		}).Debug("Fetched stock price")
 		return price, nil
+	})
+	if err != nil {
+		return CachedPrice{}, err
 	}
 
-	// Generate a random price between 100 and 5000 INR
-	// In production, this would fetch from NSE/BSE API
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
-	basePrice := 100.0 + r.Float64()*4900.0
-	price := fmt.Sprintf("%.4f", basePrice)
-
-	// Cache the price
-	s.priceCache[stockSymbol] = price
-
-	s.logger.WithFields(logrus.Fields{
-		"stock_symbol": stockSymbol,
-		"price": price,
-	}).Debug("Generated stock price")
-
-	return price, nil
+	if cached.Stale {
+		s.logger.WithFields(logrus.Fields{
+			"stock_symbol": stockSymbol,
+			"fetched_at":   cached.FetchedAt,
+		}).Warn("Price provider unavailable, serving cached price")
+	}
+	return cached, nil
 }
 
-// UpdatePrices fetches and stores latest prices for all stocks
-func (s *StockPriceService) UpdatePrices(db *sql.DB) error {
-	// Get all unique stock symbols from reward events
-	rows, err := db.Query(`
-		SELECT DISTINCT stock_symbol 
-		FROM reward_events
-	`)
-	if err != nil {
-		return err
-	}
-	defer rows.Close()
+// CacheStats reports how provider price reads have been served
+func (s *StockPriceService) CacheStats() PriceCacheStats {
+	return s.cache.Stats()
+}
 
-	var symbols []string
-	for rows.Next() {
-		var symbol string
-		if err := rows.Scan(&symbol); err != nil {
-			return err
-		}
-		symbols = append(symbols, symbol)
-	}
+// UpdatePrices fetches and stores latest prices for all stocks. It stops between
+// symbols once ctx is done, keeping the prices already stored.
+func (s *StockPriceService) UpdatePrices(ctx context.Context) error {
+	prices := s.store.WithContext(ctx).Prices()
 
-	if err = rows.Err(); err != nil {
+	// Get every symbol that is currently held, including symbols introduced by corporate actions.
+	// Suspended and delisted instruments are not trading, so no new price is fetched for them.
+	symbols, err := prices.TradingSymbols()
+	if err != nil {
 		return err
 	}
 
 	// Update prices for each symbol
 	now := time.Now()
 	for _, symbol := range symbols {
-		price, err := s.GetCurrentPrice(symbol)
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Always go to the provider here; the cache only serves reads
+		price, err := s.provider.GetPrice(ctx, symbol)
 		if err != nil {
 			s.logger.WithError(err).WithField("stock_symbol", symbol).Error("Failed to get price")
 			continue
 		}
 
 		// Store price in database
-		_, err = db.Exec(`
-			INSERT INTO stock_prices (stock_symbol, price, price_timestamp)
-			VALUES ($1, $2, $3)
-			ON CONFLICT (stock_symbol, price_timestamp) DO UPDATE
-			SET price = EXCLUDED.price
-		`, symbol, price, now)
-		if err != nil {
+		if err := prices.Save(symbol, price, now); err != nil {
 			s.logger.WithError(err).WithField("stock_symbol", symbol).Error("Failed to store price")
 			continue
 		}
 
 		// Update cache
-		s.priceCache[symbol] = price
+		s.cache.Set(symbol, price, now)
 	}
 
 	s.logger.WithField("count", len(symbols)).Info("Updated stock prices")
 	return nil
 }
 
-// GetLatestPrice gets the latest price from database
-func (s *StockPriceService) GetLatestPrice(db *sql.DB, stockSymbol string) (string, error) {
-	var price string
-	err := db.QueryRow(`
-		SELECT price FROM stock_prices 
-		WHERE stock_symbol = $1 
-		ORDER BY price_timestamp DESC 
-		LIMIT 1
-	`, stockSymbol).Scan(&price)
-
-	if err == sql.ErrNoRows {
-		// No price in DB, generate one
-		return s.GetCurrentPrice(stockSymbol)
+// ImportPrice stores a historical price taken at the given time, replacing any price
+// already stored for the same symbol and timestamp. The cache only holds provider
+// prices, so it is left alone. A dry run only validates.
+func (s *StockPriceService) ImportPrice(ctx context.Context, stockSymbol, price string, at time.Time, dryRun bool) error {
+	if stockSymbol == "" {
+		return fmt.Errorf("%w: stock_symbol is required", ErrInvalidPrice)
 	}
+	amount, err := decimal.Parse(price)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidPrice, err)
+	}
+	if amount.Sign() <= 0 || amount.Scale() > decimal.AmountScale {
+		return fmt.Errorf("%w: must be positive with at most %d decimal places", ErrInvalidPrice, decimal.AmountScale)
+	}
+	if at.IsZero() || at.After(time.Now()) {
+		return fmt.Errorf("%w: price_timestamp must not be in the future", ErrInvalidPrice)
+	}
+
+	if dryRun {
+		return nil
+	}
+	return s.store.WithContext(ctx).Prices().Save(stockSymbol, amount.Round(decimal.AmountScale, amountRounding).String(), at)
+}
 
-	return price, err
+// PriceQuote is the price used to value a holding together with the instrument's status
+// and the reference data shown alongside it
+type PriceQuote struct {
+	Price       string
+	Status      string
+	CompanyName string
+	Exchange    string
+	PricedAt    *time.Time // When the price was taken; nil when there is no price (valued at zero)
+	Stale       bool       // Trading instrument whose price is older than the staleness threshold
 }
 
+// GetLatestPrice gets the latest price from database.
+// Instruments that are not trading are valued at their last valid price, or at zero
+// when a delisted instrument is written off; a price is never invented for them.
+// Only prices of trading instruments can be stale: a suspended or delisted
+// instrument's last valid price is final until it trades again.
+func (s *StockPriceService) GetLatestPrice(ctx context.Context, stockSymbol string) (*PriceQuote, error) {
+	prices := s.store.WithContext(ctx).Prices()
+	instrument, err := getInstrument(prices, stockSymbol)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &PriceQuote{Status: instrument.Status, CompanyName: instrument.CompanyName, Exchange: instrument.Exchange}
+	if writtenOffBefore(instrument, time.Now()) {
+		quote.Price = "0.0000"
+		return quote, nil
+	}
+
+	latest, err := prices.Latest(stockSymbol)
+	if err == nil {
+		quote.Price = latest.Price
+		quote.PricedAt = &latest.PriceTimestamp
+	} else if errors.Is(err, repository.ErrNotFound) {
+		if instrument.Status != InstrumentActive {
+			s.logger.WithFields(logrus.Fields{
+				"stock_symbol": stockSymbol,
+				"status":       instrument.Status,
+			}).Warn("No last valid price for non-trading instrument, valuing at 0")
+			quote.Price = "0.0000"
+			return quote, nil
+		}
+
+		// No price in DB, fetch one
+		cached, err := s.GetCurrentPrice(ctx, stockSymbol)
+		if err != nil {
+			return nil, err
+		}
+		quote.Price = cached.Price
+		quote.PricedAt = &cached.FetchedAt
+	} else {
+		return nil, err
+	}
+
+	if instrument.Status == InstrumentActive {
+		quote.Stale = s.isStale(*quote.PricedAt)
+	}
+	return quote, nil
+}
+
+// isStale reports whether a price taken at pricedAt is too old to be shown as current
+func (s *StockPriceService) isStale(pricedAt time.Time) bool {
+	return s.staleAfter > 0 && time.Since(pricedAt) > s.staleAfter
+}
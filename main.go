@@ -2,29 +2,41 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
+	"stocky/internal/auth"
 	"stocky/internal/config"
 	"stocky/internal/database"
 	"stocky/internal/handlers"
+	"stocky/internal/idempotency"
+	"stocky/internal/middleware"
+	"stocky/internal/ratelimit"
+	"stocky/internal/repository"
 	"stocky/internal/services"
+	"sync"
 	"syscall"
 	"time"
+	_ "time/tzdata" // Timezones resolve even on hosts without a zoneinfo database
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
 func main() {
-	// Load configuration
-	cfg := config.Load()
-
 	// Initialize logger
 	logger := logrus.New()
 	logger.SetFormatter(&logrus.JSONFormatter{})
 	logger.SetLevel(logrus.InfoLevel)
 
+	// Load configuration
+	cfg, err := config.Load()
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid configuration")
+	}
+
 	// Initialize database
 	db, err := database.NewConnection(cfg.DatabaseURL)
 	if err != nil {
@@ -32,37 +44,209 @@ func main() {
 	}
 	defer db.Close()
 
+	// "stocky migrate ..." manages the schema and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		code := runMigrate(db, os.Args[2:], logger)
+		db.Close()
+		os.Exit(code)
+	}
+
 	// Run migrations
-	if err := database.RunMigrations(db); err != nil {
-		logger.WithError(err).Fatal("Failed to run migrations")
+	if cfg.AutoMigrate {
+		if err := database.RunMigrations(db); err != nil {
+			logger.WithError(err).Fatal("Failed to run migrations")
+		}
 	}
 
 	// Initialize services
-	rewardService := services.NewRewardService(db, logger)
-	stockPriceService := services.NewStockPriceService(logger)
-	portfolioService := services.NewPortfolioService(db, stockPriceService, logger)
+	priceProvider, err := services.NewPriceProvider(cfg, logger)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize price provider")
+	}
+	logger.WithField("provider", priceProvider.Name()).Info("Price provider configured")
+
+	location, err := services.LoadLocation(cfg.BusinessTimezone)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid business timezone")
+	}
+
+	batchMode, err := services.ParseBatchMode(cfg.RewardBatchMode)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid reward batch mode")
+	}
+
+	store := repository.NewPostgresStore(db)
+	rewardService := services.NewRewardService(store, cfg.RewardMaxBackdate, cfg.RewardMaxFutureSkew, location, logger)
+	stockPriceService := services.NewStockPriceService(store, priceProvider, services.NewPriceCache(cfg.PriceCacheTTL, cfg.PriceCacheMaxAge, cfg.PriceFeedTimeout), cfg.PriceStaleAfter, logger)
+	portfolioService := services.NewPortfolioService(store, stockPriceService, cfg.PriceRejectStale, location, logger)
+	corporateActionService := services.NewCorporateActionService(store, portfolioService, location, logger)
+	instrumentService := services.NewInstrumentService(store, logger)
+	ledgerService := services.NewLedgerService(store, location, logger)
+	feeService := services.NewFeeService(store, logger)
+
+	// "stocky backfill-snapshots ..." regenerates historical snapshots and exits
+	if len(os.Args) > 1 && os.Args[1] == "backfill-snapshots" {
+		code := runBackfillSnapshots(portfolioService, location, os.Args[2:], logger)
+		db.Close()
+		os.Exit(code)
+	}
+
+	// "stocky import rewards|prices|instruments ..." loads a CSV or JSON Lines file and exits
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		code := runImport(rewardService, stockPriceService, instrumentService, location, os.Args[2:], logger)
+		db.Close()
+		os.Exit(code)
+	}
+
+	// Initialize authentication
+	apiKeys, err := auth.ParseAPIKeys(cfg.AuthAPIKeys)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to parse API keys")
+	}
+	jwtVerifier, err := auth.NewJWTVerifier(cfg.JWTHMACSecret, cfg.JWTRSAPublicKeyFile, cfg.JWTIssuer, cfg.JWTAudience)
+	if err != nil {
+		logger.WithError(err).Fatal("Failed to initialize JWT verifier")
+	}
+	authenticator := auth.NewAuthenticator(apiKeys, jwtVerifier)
+	if !authenticator.Enabled() {
+		logger.Warn("No API keys or JWT keys configured, all API requests will be rejected")
+	}
+
+	// Initialize rate limiting
+	writePolicy, err := ratelimit.ParsePolicy("write", cfg.RateLimitWrite)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid write rate limit")
+	}
+	readPolicy, err := ratelimit.ParsePolicy("read", cfg.RateLimitRead)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid read rate limit")
+	}
+	var limiter ratelimit.Limiter
+	switch cfg.RateLimitBackend {
+	case "memory":
+		limiter = ratelimit.NewMemoryLimiter()
+	case "postgres":
+		limiter = ratelimit.NewPostgresLimiter(db)
+	case "off":
+		logger.Warn("Rate limiting disabled")
+	default:
+		logger.WithField("backend", cfg.RateLimitBackend).Fatal("Unknown rate limit backend")
+	}
+	rateLimit := func(policy ratelimit.Policy) gin.HandlerFunc {
+		if limiter == nil {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RateLimit(limiter, policy, logger)
+	}
+
+	// Initialize idempotency keys
+	var idempotencyStore idempotency.Store
+	switch cfg.IdempotencyBackend {
+	case "memory":
+		idempotencyStore = idempotency.NewMemoryStore(cfg.IdempotencyTTL)
+	case "postgres":
+		idempotencyStore = idempotency.NewPostgresStore(db, cfg.IdempotencyTTL)
+	case "off":
+		logger.Warn("Idempotency keys disabled")
+	default:
+		logger.WithField("backend", cfg.IdempotencyBackend).Fatal("Unknown idempotency backend")
+	}
+	idempotent := gin.HandlerFunc(func(c *gin.Context) { c.Next() })
+	if idempotencyStore != nil {
+		idempotent = middleware.Idempotency(idempotencyStore, logger)
+	}
+
+	// Initialize request deadlines
+	timeouts, err := middleware.ParseTimeouts(cfg.RequestTimeouts)
+	if err != nil {
+		logger.WithError(err).Fatal("Invalid request timeouts")
+	}
 
 	// Start hourly price update job
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	go services.StartPriceUpdateJob(ctx, db, stockPriceService, logger)
+	var jobs sync.WaitGroup
+	jobs.Add(1)
+	go func() {
+		defer jobs.Done()
+		services.StartPriceUpdateJob(ctx, stockPriceService, portfolioService, corporateActionService, logger)
+	}()
+
+	// Recompute snapshots that backdated rewards and adjustments made stale
+	if cfg.SnapshotInvalidationPeriod > 0 {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			services.StartSnapshotInvalidationJob(ctx, portfolioService, cfg.SnapshotInvalidationPeriod, logger)
+		}()
+	}
+
+	// Delete idle rate limit buckets
+	if pruner, ok := limiter.(*ratelimit.PostgresLimiter); ok {
+		jobs.Add(1)
+		go func() {
+			defer jobs.Done()
+			pruner.RunPruner(ctx, 10*time.Minute)
+		}()
+	}
 
 	// Initialize handlers
-	rewardHandler := handlers.NewRewardHandler(rewardService, logger)
+	rewardHandler := handlers.NewRewardHandler(rewardService, cfg.RewardBatchMax, batchMode, logger)
 	portfolioHandler := handlers.NewPortfolioHandler(portfolioService, logger)
+	corporateActionHandler := handlers.NewCorporateActionHandler(corporateActionService, logger)
+	instrumentHandler := handlers.NewInstrumentHandler(instrumentService, logger)
+	ledgerHandler := handlers.NewLedgerHandler(ledgerService, logger)
+	feeHandler := handlers.NewFeeHandler(feeService, logger)
 
 	// Setup router
 	router := gin.Default()
-	router.Use(gin.Recovery())
+	// Errors writes every failure, including panics, as the JSON error envelope
+	router.Use(middleware.RequestID(), middleware.Errors(logger), gin.CustomRecovery(func(c *gin.Context, recovered interface{}) {
+		c.Error(fmt.Errorf("panic: %v", recovered))
+		c.Abort()
+	}), middleware.Timeout(cfg.RequestTimeout, timeouts))
+	router.NoRoute(func(c *gin.Context) {
+		c.Error(services.NewError(services.CodeNotFound, "route not found"))
+	})
 
 	// API routes
 	api := router.Group("/api/v1")
+	api.Use(middleware.Authenticate(authenticator, logger))
+	{
+		issuers := api.Group("", middleware.RequireRole(auth.RoleIssuer, auth.RoleAdmin), rateLimit(writePolicy), idempotent)
+		issuers.POST("/reward", rewardHandler.CreateReward)
+		issuers.POST("/reward/preview", rewardHandler.PreviewReward)
+		issuers.POST("/reward/:id/reverse", rewardHandler.ReverseReward)
+		issuers.POST("/reward/:id/adjust", rewardHandler.AdjustReward)
+		issuers.POST("/rewards/batch", rewardHandler.CreateRewardBatch)
+
+		// Users may only read their own data; admin and finance may read anyone's
+		users := api.Group("", middleware.RequireSelfOrRole("userId", auth.RoleAdmin, auth.RoleFinance), rateLimit(readPolicy))
+		users.GET("/today-stocks/:userId", rewardHandler.GetTodayStocks)
+		users.GET("/historical-inr/:userId", portfolioHandler.GetHistoricalINR)
+		users.GET("/stats/:userId", portfolioHandler.GetStats)
+		users.GET("/portfolio/:userId", portfolioHandler.GetPortfolio) // Bonus endpoint
+	}
+
+	// Admin routes
+	admin := api.Group("/admin")
 	{
-		api.POST("/reward", rewardHandler.CreateReward)
-		api.GET("/today-stocks/:userId", rewardHandler.GetTodayStocks)
-		api.GET("/historical-inr/:userId", portfolioHandler.GetHistoricalINR)
-		api.GET("/stats/:userId", portfolioHandler.GetStats)
-		api.GET("/portfolio/:userId", portfolioHandler.GetPortfolio) // Bonus endpoint
+		reports := admin.Group("", middleware.RequireRole(auth.RoleAdmin, auth.RoleFinance))
+		reports.GET("/corporate-actions", corporateActionHandler.ListCorporateActions)
+		reports.GET("/instruments", instrumentHandler.ListInstruments)
+		reports.GET("/instruments/:symbol", instrumentHandler.GetInstrument)
+		reports.GET("/trial-balance", ledgerHandler.GetTrialBalance)
+		reports.GET("/fee-schedules", feeHandler.ListFeeSchedules)
+
+		operations := admin.Group("", middleware.RequireRole(auth.RoleAdmin), idempotent)
+		operations.POST("/corporate-actions", corporateActionHandler.CreateCorporateAction)
+		operations.POST("/corporate-actions/:id/apply", corporateActionHandler.ApplyCorporateAction)
+		operations.POST("/instruments", instrumentHandler.CreateInstrument)
+		operations.PUT("/instruments/:symbol", instrumentHandler.UpdateInstrument)
+		operations.DELETE("/instruments/:symbol", instrumentHandler.DeleteInstrument)
+		operations.PUT("/instruments/:symbol/status", instrumentHandler.SetInstrumentStatus)
+		operations.POST("/fee-schedules", feeHandler.CreateFeeSchedule)
+		operations.POST("/snapshots/backfill", portfolioHandler.BackfillSnapshots)
 	}
 
 	// Health check
@@ -70,10 +254,14 @@ func main() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
-	// Start server
+	// Start server. Requests run under serverCtx, so work still in flight when
+	// shutdown gives up waiting for it is cancelled.
+	serverCtx, stopRequests := context.WithCancel(context.Background())
+	defer stopRequests()
 	server := &http.Server{
-		Addr:    ":" + cfg.Port,
-		Handler: router,
+		Addr:        ":" + cfg.Port,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return serverCtx },
 	}
 
 	// Graceful shutdown
@@ -91,14 +279,16 @@ func main() {
 	<-quit
 
 	logger.Info("Shutting down server...")
-	cancel() // Stop price update job
+	cancel() // Stop the background jobs, cancelling their queries
 
 	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
 		logger.WithError(err).Error("Server forced to shutdown")
+		stopRequests()
 	}
+	jobs.Wait()
 
 	logger.Info("Server exited")
 }
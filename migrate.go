@@ -0,0 +1,107 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"stocky/internal/database"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/sirupsen/logrus"
+)
+
+const migrateUsage = `usage: stocky migrate <command>
+
+commands:
+  up            apply all pending migrations
+  down [N]      roll back the last N applied migrations (default 1)
+  status        list migrations and when they were applied
+  to <version>  migrate up or down to version (0 rolls back everything)`
+
+// runMigrate handles the "migrate" subcommand and returns the process exit code
+func runMigrate(db *sql.DB, args []string, logger *logrus.Logger) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	migrator, err := database.NewMigrator(db)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load migrations")
+		return 1
+	}
+
+	var done []database.Migration
+	switch args[0] {
+	case "up":
+		done, err = migrator.Up()
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps <= 0 {
+				fmt.Fprintln(os.Stderr, "down: N must be a positive integer")
+				return 2
+			}
+		}
+		done, err = migrator.Down(steps)
+	case "to":
+		if len(args) < 2 {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil || version < 0 {
+			fmt.Fprintln(os.Stderr, "to: version must be a non-negative integer")
+			return 2
+		}
+		done, err = migrator.To(version)
+	case "status":
+		return printMigrationStatus(migrator, logger)
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	for _, mig := range done {
+		logger.WithFields(logrus.Fields{
+			"version": mig.Version,
+			"name":    mig.Name,
+		}).Info("Migration run")
+	}
+	if err != nil {
+		logger.WithError(err).Error("Migration failed")
+		return 1
+	}
+	if len(done) == 0 {
+		logger.Info("Nothing to migrate")
+	}
+	return 0
+}
+
+func printMigrationStatus(migrator *database.Migrator, logger *logrus.Logger) int {
+	statuses, err := migrator.Status()
+	if err != nil {
+		logger.WithError(err).Error("Failed to read migration status")
+		return 1
+	}
+
+	writeMigrationStatus(os.Stdout, statuses)
+	return 0
+}
+
+// writeMigrationStatus prints one aligned row per migration, oldest first
+func writeMigrationStatus(out io.Writer, statuses []database.MigrationStatus) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED AT")
+	for _, status := range statuses {
+		appliedAt := "pending"
+		if status.AppliedAt != nil {
+			appliedAt = status.AppliedAt.Format("2006-01-02 15:04:05 MST")
+		}
+		fmt.Fprintf(w, "%04d\t%s\t%s\n", status.Version, status.Name, appliedAt)
+	}
+	w.Flush()
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"bytes"
+	"stocky/internal/database"
+	"testing"
+	"time"
+)
+
+func TestWriteMigrationStatus(t *testing.T) {
+	appliedAt := time.Date(2024, 4, 1, 9, 30, 0, 0, time.UTC)
+	var out bytes.Buffer
+	writeMigrationStatus(&out, []database.MigrationStatus{
+		{Migration: database.Migration{Version: 1, Name: "initial_schema"}, AppliedAt: &appliedAt},
+		{Migration: database.Migration{Version: 12, Name: "idempotency_keys"}},
+	})
+
+	want := "VERSION  NAME              APPLIED AT\n" +
+		"0001     initial_schema    2024-04-01 09:30:00 UTC\n" +
+		"0012     idempotency_keys  pending\n"
+	if out.String() != want {
+		t.Errorf("status =\n%s\nwant\n%s", out.String(), want)
+	}
+}